@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"caia-ai-cli/pkg/txn"
+)
+
+// TableInfo describes the contents of a CSV or TSV file
+type TableInfo struct {
+	Delimiter string        `json:"delimiter"`
+	Header    bool          `json:"header"`
+	Columns   []TableColumn `json:"columns"`
+	// Rows counts the records after the header
+	Rows int `json:"rows"`
+}
+
+// TableColumn is a column of a CSV file with the type inferred from its values
+type TableColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+const (
+	// csvSheet is the sheet a CSV file is loaded into so the Excel actions
+	// apply to it; CSV files have no sheets of their own
+	csvSheet = "Sheet1"
+	// maxTableFileSize is the largest CSV file actions load into memory
+	maxTableFileSize = 32 << 20
+	// tableSampleRows is how many records column types are inferred from
+	tableSampleRows = 1000
+	// maxTableRecordSize is the largest record indexing reads; a longer one
+	// means the file is not really a table
+	maxTableRecordSize = 1 << 20
+)
+
+// csvActionTypes are the Excel actions that make sense for a CSV file
+var csvActionTypes = []string{
+	"read_sheet", "read_range", "set_cell", "add_row",
+	"insert_rows", "delete_rows", "insert_cols", "delete_cols", "sort_range",
+}
+
+var (
+	integerPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+	dateLayouts    = []string{
+		"2006-01-02", "2006-01-02 15:04:05", "2006-01-02T15:04:05Z07:00", "2006/01/02",
+		"01/02/2006", "02.01.2006", "Jan 2, 2006", "2 Jan 2006",
+	}
+	utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+)
+
+// isCSVFile reports whether filename refers to a CSV or TSV file
+func isCSVFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv", ".tsv", ".tab":
+		return true
+	}
+	return false
+}
+
+// csvDelimiter returns the field separator of a CSV file: a tab for .tsv
+// files, otherwise whichever of , ; tab and | is most common in the first
+// line, preferring commas
+func csvDelimiter(filename string, data []byte) rune {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".tsv", ".tab":
+		return '\t'
+	}
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	best, count := ',', bytes.Count(line, []byte(","))
+	for _, d := range []rune{';', '\t', '|'} {
+		if n := bytes.Count(line, []byte(string(d))); n > count {
+			best, count = d, n
+		}
+	}
+	return best
+}
+
+// parseCSV reads all records of a CSV file. Rows may have different lengths.
+func parseCSV(data []byte, delimiter rune) ([][]string, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, utf8BOM)))
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	return r.ReadAll()
+}
+
+// formatCSV writes rows as a CSV file, padding them to the widest row
+func formatCSV(rows [][]string, delimiter rune, bom bool) ([]byte, error) {
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+
+	var buf bytes.Buffer
+	if bom {
+		buf.Write(utf8BOM)
+	}
+	w := csv.NewWriter(&buf)
+	w.Comma = delimiter
+	for _, row := range rows {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// tableWorkbook loads the records of a CSV file into csvSheet of a new
+// workbook, as text
+func tableWorkbook(rows [][]string) (*excelize.File, error) {
+	f := excelize.NewFile()
+	for i, row := range rows {
+		if err := setTextRow(f, csvSheet, i+1, row); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// setTextRow writes values as text, so CSV fields come back unchanged
+func setTextRow(f *excelize.File, sheet string, row int, values []string) error {
+	cells := make([]interface{}, len(values))
+	for i, v := range values {
+		cells[i] = v
+	}
+	cell, _ := excelize.CoordinatesToCellName(1, row)
+	return f.SetSheetRow(sheet, cell, &cells)
+}
+
+// loadTable reads a CSV file, from tx so staged changes are included, and
+// loads it into a workbook
+func loadTable(filename string, tx *txn.Tx) (*excelize.File, []byte, error) {
+	data, err := tx.ReadFile(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading file: %v", err)
+	}
+	if len(data) > maxTableFileSize {
+		return nil, nil, fmt.Errorf("%s is larger than %d MB; read it as text instead", filename, maxTableFileSize>>20)
+	}
+	rows, err := parseCSV(data, csvDelimiter(filename, data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing %s: %v", filename, err)
+	}
+	f, err := tableWorkbook(rows)
+	return f, data, err
+}
+
+// prepareTableActions checks that the actions for a CSV file are ones that
+// apply to it and points them at csvSheet, whatever sheet Claude named
+func prepareTableActions(action *Action) error {
+	for i := range action.Actions {
+		a := &action.Actions[i]
+		supported := false
+		for _, t := range csvActionTypes {
+			supported = supported || t == a.Type
+		}
+		if !supported {
+			return fmt.Errorf("action %d (%s) is not supported for CSV files; use one of %s, or convert the "+
+				"file with import_csv on a workbook", i+1, a.Type, strings.Join(csvActionTypes, ", "))
+		}
+		a.Sheet = csvSheet
+	}
+	return nil
+}
+
+// readTable performs the read actions of action on a CSV file
+func readTable(action Action, tx *txn.Tx) (string, error) {
+	f, _, err := loadTable(action.Filename, tx)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return readWorkbook(f, action)
+}
+
+// resolveTableActions applies the create or edit actions of action to a CSV
+// file and returns its new content, which is then reviewed and written like
+// any other edit
+func resolveTableActions(action Action, tx *txn.Tx) (string, error) {
+	var (
+		f    *excelize.File
+		data []byte
+		err  error
+	)
+	if action.Operation == "edit" {
+		if f, data, err = loadTable(action.Filename, tx); err != nil {
+			return "", err
+		}
+	} else {
+		f = excelize.NewFile()
+	}
+	defer f.Close()
+
+	for _, a := range action.Actions {
+		// Rows stay text; add_row would store numbers and booleans typed
+		if a.Type == "add_row" {
+			rows, err := f.GetRows(csvSheet)
+			if err != nil {
+				return "", err
+			}
+			err = setTextRow(f, csvSheet, len(rows)+1, a.Row)
+			if err != nil {
+				return "", fmt.Errorf("error adding row: %v", err)
+			}
+			continue
+		}
+		if err := applyExcelAction(f, a, tx); err != nil {
+			return "", err
+		}
+	}
+
+	rows, err := f.GetRows(csvSheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return "", err
+	}
+	content, err := formatCSV(rows, csvDelimiter(action.Filename, data), bytes.HasPrefix(data, utf8BOM))
+	if err != nil {
+		return "", fmt.Errorf("error writing %s: %v", action.Filename, err)
+	}
+	return string(content), nil
+}
+
+// importCSV copies the records of a CSV file into a sheet, creating it if
+// needed, with the first record at a.Cell or A1. Numbers and booleans are
+// stored typed so formulas and charts can use them.
+func importCSV(f *excelize.File, a ExcelAction, tx *txn.Tx) error {
+	data, err := tx.ReadFile(a.File)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxTableFileSize {
+		return fmt.Errorf("the file is larger than %d MB", maxTableFileSize>>20)
+	}
+	rows, err := parseCSV(data, csvDelimiter(a.File, data))
+	if err != nil {
+		return err
+	}
+	if !sheetExists(f, a.Sheet) {
+		if _, err := f.NewSheet(a.Sheet); err != nil {
+			return err
+		}
+	}
+
+	start := "A1"
+	if a.Cell != "" {
+		start = a.Cell
+	}
+	col, row, err := excelize.CellNameToCoordinates(start)
+	if err != nil {
+		return err
+	}
+	for i, record := range rows {
+		cells := make([]interface{}, len(record))
+		for j, v := range record {
+			cells[j] = typedValue(v)
+		}
+		cell, _ := excelize.CoordinatesToCellName(col, row+i)
+		if err := f.SetSheetRow(a.Sheet, cell, &cells); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportCSV writes the values of a sheet as they are displayed to a CSV
+// file, like Excel's Save As CSV. The file is staged in tx. Overwriting an
+// existing file is reviewed as a diff like any other edit.
+func exportCSV(f *excelize.File, a ExcelAction, tx *txn.Tx) error {
+	rows, err := f.GetRows(a.Sheet)
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		calcFormulas(f, a.Sheet, i+1, 1, row)
+	}
+	content, err := formatCSV(rows, csvDelimiter(a.File, nil), false)
+	if err != nil {
+		return err
+	}
+	if current, err := tx.ReadFile(a.File); err == nil {
+		// An unchanged file needs no review
+		if bytes.Equal(current, content) {
+			return nil
+		}
+		reviewed, ok := reviewEdit(Action{Operation: "edit", Filename: a.File, Content: string(content)}, tx)
+		if !ok {
+			return errOperationCancelled
+		}
+		content = []byte(reviewed)
+	}
+	tx.WriteFile(a.File, content, filePerm(a.File))
+	return nil
+}
+
+// exportTargets lists the files written by export_csv actions for the
+// confirmation prompt
+func exportTargets(actions []ExcelAction) string {
+	var files []string
+	for _, a := range actions {
+		if a.Type == "export_csv" {
+			files = append(files, a.File)
+		}
+	}
+	if len(files) == 0 {
+		return ""
+	}
+	return " and export sheets to " + strings.Join(files, ", ")
+}
+
+// describeExports lists the CSV files written by export_csv actions for the
+// result sent to Claude
+func describeExports(actions []ExcelAction) string {
+	var b strings.Builder
+	for _, a := range actions {
+		if a.Type == "export_csv" {
+			fmt.Fprintf(&b, "; exported sheet %s to %s", a.Sheet, a.File)
+		}
+	}
+	return b.String()
+}
+
+// typedValue converts a CSV field to a number or boolean when it is one.
+// Numbers with leading zeros stay text.
+func typedValue(v string) interface{} {
+	if jsonNumber.MatchString(v) {
+		var n float64
+		if _, err := fmt.Sscan(v, &n); err == nil {
+			return n
+		}
+	}
+	switch strings.ToLower(v) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return v
+}
+
+// errRecordTooLarge stops indexing a CSV file with a record over
+// maxTableRecordSize
+var errRecordTooLarge = errors.New("record too large")
+
+// tableReader reads a CSV file for indexing. It fails once ctx is done or a
+// record grows past its limit, so one huge record cannot stall indexing.
+type tableReader struct {
+	ctx   context.Context
+	r     io.Reader
+	n     int64 // bytes read so far
+	limit int64 // n may not go past this until the next record starts
+}
+
+func (t *tableReader) Read(p []byte) (int, error) {
+	if err := t.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if t.n >= t.limit {
+		return 0, errRecordTooLarge
+	}
+	if int64(len(p)) > t.limit-t.n {
+		p = p[:t.limit-t.n]
+	}
+	n, err := t.r.Read(p)
+	t.n += int64(n)
+	return n, err
+}
+
+// readTableInfo fills in the header, column types and row count of a CSV
+// file. Records are streamed; reading stops when ctx is done or a record is
+// larger than maxTableRecordSize, leaving the table out.
+func readTableInfo(ctx context.Context, path string, fileInfo *FileInfo) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	tr := &tableReader{ctx: ctx, r: file, limit: maxTableRecordSize}
+	br := bufio.NewReader(tr)
+	head, _ := br.Peek(4096)
+	if bytes.HasPrefix(head, utf8BOM) {
+		br.Discard(len(utf8BOM))
+		head = head[len(utf8BOM):]
+	}
+	delimiter := csvDelimiter(path, head)
+	r := csv.NewReader(br)
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.ReuseRecord = true
+
+	table := &TableInfo{Delimiter: string(delimiter)}
+	var types []map[string]bool // the value types seen in each column
+	first := true
+	for {
+		// Bytes already buffered are not counted, so a record may exceed the
+		// limit by up to the size of the buffer
+		tr.limit = tr.n + maxTableRecordSize
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return
+		}
+		if isEmptyRow(record) {
+			continue
+		}
+
+		if first {
+			first = false
+			if looksLikeHeader(record) {
+				table.Header = true
+				for _, name := range headerNames(record, 1) {
+					table.Columns = append(table.Columns, TableColumn{Name: name})
+				}
+				continue
+			}
+		}
+		table.Rows++
+		if table.Rows > tableSampleRows {
+			continue
+		}
+		for i, v := range record {
+			for len(types) <= i {
+				types = append(types, make(map[string]bool))
+			}
+			if v = strings.TrimSpace(v); v != "" {
+				types[i][valueType(v)] = true
+			}
+		}
+	}
+
+	// Columns beyond the header, or all of them without one, are named by letter
+	for i := len(table.Columns); i < len(types); i++ {
+		name, _ := excelize.ColumnNumberToName(i + 1)
+		table.Columns = append(table.Columns, TableColumn{Name: name})
+	}
+	for i := range table.Columns {
+		table.Columns[i].Type = "empty"
+		if i < len(types) {
+			table.Columns[i].Type = columnType(types[i])
+		}
+	}
+	fileInfo.Table = table
+}
+
+// valueType classifies a CSV field
+func valueType(v string) string {
+	switch {
+	case integerPattern.MatchString(v):
+		return "integer"
+	case jsonNumber.MatchString(v):
+		return "number"
+	case strings.EqualFold(v, "true") || strings.EqualFold(v, "false"):
+		return "boolean"
+	}
+	for _, layout := range dateLayouts {
+		if _, err := time.Parse(layout, v); err == nil {
+			return "date"
+		}
+	}
+	return "text"
+}
+
+// columnType combines the types of a column's values: integers mixed with
+// other numbers are numbers, and any other mix is text
+func columnType(seen map[string]bool) string {
+	switch {
+	case len(seen) == 0:
+		return "empty"
+	case len(seen) == 1:
+		for t := range seen {
+			return t
+		}
+	case len(seen) == 2 && seen["integer"] && seen["number"]:
+		return "number"
+	}
+	return "text"
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"caia-ai-cli/pkg/txn"
+)
+
+func TestCSVDelimiter(t *testing.T) {
+	tests := []struct {
+		file string
+		data string
+		want rune
+	}{
+		{"a.csv", "a,b,c\n1,2,3\n", ','},
+		{"a.csv", "a;b;c\n1,5;2,5;3\n", ';'},
+		{"a.csv", "a|b|c\n", '|'},
+		{"a.csv", "a\tb\tc\n", '\t'},
+		{"a.csv", "a,b;c\n", ','},
+		{"a.csv", "", ','},
+		{"a.csv", "one column\n", ','},
+		{"a.csv", "a;b\nc,d,e,f\n", ';'},
+		{"a.TSV", "a,b,c\n", '\t'},
+		{"a.tab", "", '\t'},
+	}
+	for _, tt := range tests {
+		if got := csvDelimiter(tt.file, []byte(tt.data)); got != tt.want {
+			t.Errorf("csvDelimiter(%q, %q) = %q, want %q", tt.file, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestReadTableInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data string
+		want *TableInfo
+	}{
+		{
+			name: "header and types",
+			file: "a.csv",
+			data: "id,price,paid,date,note,zip\n1,2.5,true,2024-01-31,x,01234\n2,3,FALSE,01/31/2024,,98765\n",
+			want: &TableInfo{Delimiter: ",", Header: true, Rows: 2, Columns: []TableColumn{
+				{"id", "integer"}, {"price", "number"}, {"paid", "boolean"},
+				{"date", "date"}, {"note", "text"}, {"zip", "text"},
+			}},
+		},
+		{
+			name: "no header",
+			file: "a.csv",
+			data: "1;a\n2;b\n\n3;c\n",
+			want: &TableInfo{Delimiter: ";", Rows: 3, Columns: []TableColumn{{"A", "integer"}, {"B", "text"}}},
+		},
+		{
+			name: "columns beyond the header",
+			file: "a.tsv",
+			data: "\xef\xbb\xbfname\n\"a, b\"\t1\n",
+			want: &TableInfo{Delimiter: "\t", Header: true, Rows: 1, Columns: []TableColumn{{"name", "text"}, {"B", "integer"}}},
+		},
+		{
+			name: "empty column",
+			file: "a.csv",
+			data: "a,b\n1,\n",
+			want: &TableInfo{Delimiter: ",", Header: true, Rows: 1, Columns: []TableColumn{{"a", "integer"}, {"b", "empty"}}},
+		},
+		{
+			name: "record too large",
+			file: "a.csv",
+			data: "a,b\n\"" + strings.Repeat("x", 2*maxTableRecordSize) + "\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempWorkspace(t, map[string]string{tt.file: tt.data})
+			var info FileInfo
+			readTableInfo(context.Background(), tt.file, &info)
+			if !reflect.DeepEqual(info.Table, tt.want) {
+				t.Errorf("readTableInfo() = %+v, want %+v", info.Table, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	tx := txn.New()
+	tx.WriteFile("data.csv", []byte("name;count;zip;ok\na;3;01234;true\n"), 0644)
+	f := workbook(t)
+
+	err := applyExcelAction(f, ExcelAction{Type: "import_csv", Sheet: "Data", File: "data.csv", Cell: "B2"}, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := f.GetRows("Data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{nil, {"", "name", "count", "zip", "ok"}, {"", "a", "3", "01234", "TRUE"}}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("imported rows = %q, want %q", rows, want)
+	}
+	for cell, want := range map[string]excelize.CellType{"C3": excelize.CellTypeUnset, "D3": excelize.CellTypeSharedString, "E3": excelize.CellTypeBool} {
+		if got, _ := f.GetCellType("Data", cell); got != want {
+			t.Errorf("type of %s = %v, want %v", cell, got, want)
+		}
+	}
+
+	tx.WriteFile("big.csv", make([]byte, maxTableFileSize+1), 0644)
+	err = applyExcelAction(f, ExcelAction{Type: "import_csv", Sheet: "Big", File: "big.csv"}, tx)
+	if err == nil || !strings.Contains(err.Error(), "larger than 32 MB") {
+		t.Errorf("importing a large file error = %v", err)
+	}
+	if sheetExists(f, "Big") {
+		t.Error("importing a large file created its sheet")
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	f := workbook(t,
+		ExcelAction{Type: "add_row", Sheet: "Sheet1", Row: []string{"name", "amount"}},
+		ExcelAction{Type: "add_row", Sheet: "Sheet1", Row: []string{"a, b", "1.5"}},
+		ExcelAction{Type: "set_number_format", Sheet: "Sheet1", Range: "B2", Format: "currency"},
+	)
+	const exported = "name,amount\n\"a, b\",$1.50\n"
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		file     string
+		answer   string // the answer to the review, if there is one
+		want     string // the staged file, or "" if nothing is staged
+		canceled bool
+	}{
+		{name: "new file", file: "out.csv", want: exported},
+		{name: "tab separated", file: "out.tsv", want: "name\tamount\na, b\t$1.50\n"},
+		{name: "overwrite accepted", files: map[string]string{"out.csv": "old\n"}, file: "out.csv", answer: "y\n", want: exported},
+		{name: "overwrite rejected", files: map[string]string{"out.csv": "old\n"}, file: "out.csv", answer: "n\n", canceled: true},
+		{name: "unchanged file", files: map[string]string{"out.csv": exported}, file: "out.csv"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempWorkspace(t, tt.files)
+			if tt.answer != "" {
+				answer(t, tt.answer)
+			}
+			tx := txn.New()
+			err := applyExcelAction(f, ExcelAction{Type: "export_csv", Sheet: "Sheet1", File: tt.file}, tx)
+			if tt.canceled {
+				if !errors.Is(err, errOperationCancelled) {
+					t.Errorf("export_csv error = %v, want it cancelled", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if tx.Len() != 0 {
+					t.Errorf("export_csv staged %v, want nothing", tx.Paths())
+				}
+				return
+			}
+			got, err := tx.ReadFile(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("exported %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveTableActions(t *testing.T) {
+	inTempWorkspace(t, map[string]string{"a.csv": "\xef\xbb\xbfname;zip\nb;01234\na;98765\n"})
+	action := Action{Operation: "edit", Filename: "a.csv", Actions: []ExcelAction{
+		{Type: "add_row", Row: []string{"c", "00001"}},
+		{Type: "sort_range", Range: "A1:B4", SortKeys: []SortKey{{Column: "A"}}},
+		{Type: "set_cell", Cell: "B5", Value: "x;y"},
+	}}
+	if err := prepareTableActions(&action); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := resolveTableActions(action, txn.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "\xef\xbb\xbfname;zip\na;98765\nb;01234\nc;00001\n;\"x;y\"\n"
+	if got != want {
+		t.Errorf("resolveTableActions() = %q, want %q", got, want)
+	}
+
+	action.Actions = []ExcelAction{{Type: "add_chart"}}
+	if err := prepareTableActions(&action); err == nil || !strings.Contains(err.Error(), "not supported for CSV files") {
+		t.Errorf("prepareTableActions() with a chart error = %v", err)
+	}
+}
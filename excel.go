@@ -0,0 +1,831 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+
+	"caia-ai-cli/pkg/txn"
+)
+
+// ExcelAction is one step of reading, creating or editing a workbook. Which
+// fields are used depends on Type; see validateExcelAction.
+type ExcelAction struct {
+	Type    string      `json:"type"`
+	Sheet   string      `json:"sheet"`
+	Cell    string      `json:"cell,omitempty"`
+	Value   string      `json:"value,omitempty"`
+	Row     []string    `json:"row,omitempty"`
+	Formula string      `json:"formula,omitempty"`
+	Range   string      `json:"range,omitempty"`
+	Style   *ExcelStyle `json:"style,omitempty"`
+	Format  string      `json:"format,omitempty"`
+	Columns string      `json:"columns,omitempty"`
+	Width   float64     `json:"width,omitempty"`
+	Chart   *ExcelChart `json:"chart,omitempty"`
+	Limit   int         `json:"limit,omitempty"`
+	Offset  int         `json:"offset,omitempty"`
+	Header  *bool       `json:"header,omitempty"`
+	Rows    string      `json:"rows,omitempty"`
+	NewName string      `json:"new_name,omitempty"`
+	// SortKeys are applied in order, later keys breaking ties
+	SortKeys []SortKey `json:"sort_keys,omitempty"`
+	// File is the CSV or TSV file of import_csv and export_csv
+	File string `json:"file,omitempty"`
+}
+
+// ExcelStyle is the formatting applied by set_style. Fields that are not set
+// keep the cell's current formatting.
+type ExcelStyle struct {
+	Bold      bool    `json:"bold,omitempty"`
+	Italic    bool    `json:"italic,omitempty"`
+	Underline bool    `json:"underline,omitempty"`
+	FontSize  float64 `json:"font_size,omitempty"`
+	FontColor string  `json:"font_color,omitempty"`
+	FillColor string  `json:"fill_color,omitempty"`
+	Align     string  `json:"align,omitempty"`
+	VAlign    string  `json:"valign,omitempty"`
+	WrapText  bool    `json:"wrap_text,omitempty"`
+	Border    bool    `json:"border,omitempty"`
+}
+
+// ExcelChart describes the chart drawn by add_chart from the action's range.
+// The first row of the range holds the series names, the first column the
+// categories and every further column one series.
+type ExcelChart struct {
+	Type       string `json:"type"`
+	Title      string `json:"title,omitempty"`
+	XAxisTitle string `json:"x_axis_title,omitempty"`
+	YAxisTitle string `json:"y_axis_title,omitempty"`
+	// DataSheet holds the range when it is not the sheet the chart is on
+	DataSheet string `json:"data_sheet,omitempty"`
+}
+
+// chartTypes maps the chart types add_chart accepts to excelize's
+var chartTypes = map[string]excelize.ChartType{
+	"line":    excelize.Line,
+	"bar":     excelize.Bar,
+	"column":  excelize.Col,
+	"pie":     excelize.Pie,
+	"scatter": excelize.Scatter,
+}
+
+// excelActionTypes lists the action types in the order the tool schema
+// offers them
+var excelActionTypes = []string{
+	"create_sheet", "set_cell", "add_row", "read_sheet", "read_range",
+	"set_formula", "set_style", "set_number_format", "set_col_width", "freeze_panes", "merge_cells",
+	"add_chart", "insert_rows", "delete_rows", "insert_cols", "delete_cols", "sort_range",
+	"delete_sheet", "rename_sheet", "import_csv", "export_csv",
+}
+
+// numberFormats are shorthands accepted by set_number_format in place of a
+// format code
+var numberFormats = map[string]string{
+	"integer":  "#,##0",
+	"decimal":  "#,##0.00",
+	"currency": "$#,##0.00",
+	"percent":  "0.00%",
+	"date":     "yyyy-mm-dd",
+	"datetime": "yyyy-mm-dd hh:mm",
+	"text":     "@",
+}
+
+const (
+	// maxRangeCells bounds the ranges that are formatted or sorted, since
+	// that is done cell by cell
+	maxRangeCells = 100000
+	// maxInsertedLines caps the rows or columns inserted or deleted at once
+	maxInsertedLines = 10000
+	// maxColWidth is Excel's limit on column widths
+	maxColWidth = 255
+	// renameSheet is the temporary name of a sheet whose name only changes
+	// case
+	renameSheet = "~rename~"
+)
+
+var colorPattern = regexp.MustCompile(`^#?[0-9A-Fa-f]{6}$`)
+
+// validateExcelActions checks the fields of every action so mistakes are
+// reported to Claude before the user is asked to confirm anything
+func validateExcelActions(actions []ExcelAction) error {
+	for i, a := range actions {
+		if err := validateExcelAction(a); err != nil {
+			return fmt.Errorf("action %d (%s): %v", i+1, a.Type, err)
+		}
+	}
+	return nil
+}
+
+func validateExcelAction(a ExcelAction) error {
+	known := false
+	for _, t := range excelActionTypes {
+		known = known || t == a.Type
+	}
+	if !known {
+		return fmt.Errorf("unknown action type %q; use one of %s", a.Type, strings.Join(excelActionTypes, ", "))
+	}
+	if a.Sheet == "" {
+		return fmt.Errorf("sheet is required")
+	}
+
+	switch a.Type {
+	case "read_sheet", "read_range":
+		if a.Range != "" {
+			if _, _, _, _, err := parseRange(a.Range); err != nil {
+				return err
+			}
+		}
+		if a.Limit < 0 || a.Limit > maxReadRows {
+			return fmt.Errorf("limit must be between 1 and %d, got %d", maxReadRows, a.Limit)
+		}
+		if a.Offset < 0 {
+			return fmt.Errorf("offset cannot be negative")
+		}
+	case "set_cell", "freeze_panes":
+		return validateCell(a.Cell)
+	case "set_formula":
+		if strings.TrimPrefix(a.Formula, "=") == "" {
+			return fmt.Errorf("formula is required, e.g. =SUM(B2:B10)")
+		}
+		return validateCell(a.Cell)
+	case "set_style":
+		if a.Style == nil {
+			return fmt.Errorf("style is required")
+		}
+		if err := validateStyle(*a.Style); err != nil {
+			return err
+		}
+		return validateRangeSize(a.Range)
+	case "set_number_format":
+		if a.Format == "" {
+			return fmt.Errorf("format is required: a format code such as #,##0.00 or one of integer, " +
+				"decimal, currency, percent, date, datetime, text")
+		}
+		return validateRangeSize(a.Range)
+	case "set_col_width":
+		if _, _, err := parseColumns(a.Columns); err != nil {
+			return err
+		}
+		if a.Width <= 0 || a.Width > maxColWidth {
+			return fmt.Errorf("width must be between 0 and %d characters, got %g", maxColWidth, a.Width)
+		}
+	case "merge_cells":
+		c1, r1, c2, r2, err := parseRange(a.Range)
+		if err != nil {
+			return err
+		}
+		if c1 == c2 && r1 == r2 {
+			return fmt.Errorf("range %s is a single cell; merge at least two cells", a.Range)
+		}
+	case "add_chart":
+		if a.Chart == nil {
+			return fmt.Errorf("chart is required")
+		}
+		if _, ok := chartTypes[a.Chart.Type]; !ok {
+			return fmt.Errorf("invalid chart type %q; use line, bar, column, pie or scatter", a.Chart.Type)
+		}
+		c1, r1, c2, r2, err := parseRange(a.Range)
+		if err != nil {
+			return err
+		}
+		if c2 == c1 || r2 == r1 {
+			return fmt.Errorf("range %s needs a header row and a category column followed by at least one "+
+				"column of values, e.g. A1:C13", a.Range)
+		}
+		return validateCell(a.Cell)
+	case "insert_rows", "delete_rows":
+		first, last, err := parseRows(a.Rows)
+		if err != nil {
+			return err
+		}
+		if last-first >= maxInsertedLines {
+			return fmt.Errorf("rows %s spans more than %d rows", a.Rows, maxInsertedLines)
+		}
+	case "insert_cols", "delete_cols":
+		first, last, err := parseColumns(a.Columns)
+		if err != nil {
+			return err
+		}
+		n1, _ := excelize.ColumnNameToNumber(first)
+		n2, _ := excelize.ColumnNameToNumber(last)
+		if n2-n1 >= maxInsertedLines {
+			return fmt.Errorf("columns %s spans more than %d columns", a.Columns, maxInsertedLines)
+		}
+	case "sort_range":
+		return validateSortKeys(a)
+	case "rename_sheet":
+		return validateSheetName(a.NewName)
+	case "import_csv", "export_csv":
+		if !isCSVFile(a.File) {
+			return fmt.Errorf("file must name a .csv or .tsv file, got %q", a.File)
+		}
+		if a.Cell != "" {
+			return validateCell(a.Cell)
+		}
+	}
+	return nil
+}
+
+func validateCell(cell string) error {
+	if cell == "" {
+		return fmt.Errorf("cell is required, e.g. B2")
+	}
+	if _, _, err := excelize.CellNameToCoordinates(cell); err != nil {
+		return fmt.Errorf("invalid cell %q; use A1 notation such as B2", cell)
+	}
+	return nil
+}
+
+func validateRangeSize(ref string) error {
+	c1, r1, c2, r2, err := parseRange(ref)
+	if err != nil {
+		return err
+	}
+	if cells := (c2 - c1 + 1) * (r2 - r1 + 1); cells > maxRangeCells {
+		return fmt.Errorf("range %s has %d cells; at most %d can be changed at once", ref, cells, maxRangeCells)
+	}
+	return nil
+}
+
+func validateSortKeys(a ExcelAction) error {
+	if err := validateRangeSize(a.Range); err != nil {
+		return err
+	}
+	if len(a.SortKeys) == 0 {
+		return fmt.Errorf("sort_keys is required, e.g. [{\"column\": \"B\", \"descending\": true}]")
+	}
+	c1, _, c2, _, _ := parseRange(a.Range)
+	for _, key := range a.SortKeys {
+		n, err := excelize.ColumnNameToNumber(key.Column)
+		if err != nil {
+			return fmt.Errorf("invalid sort column %q; use a column letter such as B", key.Column)
+		}
+		if n < c1 || n > c2 {
+			return fmt.Errorf("sort column %s is outside range %s", key.Column, a.Range)
+		}
+	}
+	return nil
+}
+
+// validateSheetName applies Excel's rules for sheet names
+func validateSheetName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("new_name is required")
+	case utf8.RuneCountInString(name) > excelize.MaxSheetNameLength:
+		return fmt.Errorf("sheet name %q is longer than %d characters", name, excelize.MaxSheetNameLength)
+	case strings.ContainsAny(name, ":\\/?*[]"):
+		return fmt.Errorf("sheet name %q cannot contain any of : \\ / ? * [ ]", name)
+	case strings.HasPrefix(name, "'") || strings.HasSuffix(name, "'"):
+		return fmt.Errorf("sheet name %q cannot start or end with a quote", name)
+	}
+	return nil
+}
+
+// parseRows returns the first and last row of a row reference such as 5 or
+// 5:9
+func parseRows(ref string) (int, int, error) {
+	if ref == "" {
+		return 0, 0, fmt.Errorf("rows is required, e.g. 5 or 5:9")
+	}
+	first, last, found := strings.Cut(ref, ":")
+	if !found {
+		last = first
+	}
+	n1, err1 := strconv.Atoi(strings.TrimSpace(first))
+	n2, err2 := strconv.Atoi(strings.TrimSpace(last))
+	if err1 != nil || err2 != nil || n1 < 1 || n2 < 1 || n1 > excelize.TotalRows || n2 > excelize.TotalRows {
+		return 0, 0, fmt.Errorf("invalid rows %q; use row numbers such as 5 or 5:9", ref)
+	}
+	return min(n1, n2), max(n1, n2), nil
+}
+
+// sheetExists reports whether a workbook has a sheet
+func sheetExists(f *excelize.File, sheet string) bool {
+	index, err := f.GetSheetIndex(sheet)
+	return err == nil && index >= 0
+}
+
+func validateStyle(s ExcelStyle) error {
+	for _, color := range []string{s.FontColor, s.FillColor} {
+		if color != "" && !colorPattern.MatchString(color) {
+			return fmt.Errorf("invalid color %q; use hex RGB such as #1F4E78", color)
+		}
+	}
+	if s.FontSize < 0 || s.FontSize > 409 {
+		return fmt.Errorf("font_size must be between 1 and 409, got %g", s.FontSize)
+	}
+	switch s.Align {
+	case "", "left", "center", "right":
+	default:
+		return fmt.Errorf("invalid align %q; use left, center or right", s.Align)
+	}
+	switch s.VAlign {
+	case "", "top", "center", "bottom":
+	default:
+		return fmt.Errorf("invalid valign %q; use top, center or bottom", s.VAlign)
+	}
+	return nil
+}
+
+// parseRange returns the corners of an A1 range such as A1:D10, or of a
+// single cell, with the top-left corner first
+func parseRange(ref string) (col1, row1, col2, row2 int, err error) {
+	if ref == "" {
+		return 0, 0, 0, 0, fmt.Errorf("range is required, e.g. A1:D10")
+	}
+	first, last, found := strings.Cut(ref, ":")
+	if !found {
+		last = first
+	}
+	col1, row1, err1 := excelize.CellNameToCoordinates(first)
+	col2, row2, err2 := excelize.CellNameToCoordinates(last)
+	if err1 != nil || err2 != nil {
+		return 0, 0, 0, 0, fmt.Errorf("invalid range %q; use A1 notation such as A1:D10", ref)
+	}
+	return min(col1, col2), min(row1, row2), max(col1, col2), max(row1, row2), nil
+}
+
+// parseColumns returns the first and last column of a column reference such
+// as C or A:D
+func parseColumns(ref string) (string, string, error) {
+	if ref == "" {
+		return "", "", fmt.Errorf("columns is required, e.g. B or A:D")
+	}
+	first, last, found := strings.Cut(strings.ToUpper(ref), ":")
+	if !found {
+		last = first
+	}
+	n1, err1 := excelize.ColumnNameToNumber(first)
+	n2, err2 := excelize.ColumnNameToNumber(last)
+	if err1 != nil || err2 != nil {
+		return "", "", fmt.Errorf("invalid columns %q; use letters such as B or A:D", ref)
+	}
+	if n1 > n2 {
+		first, last = last, first
+	}
+	return first, last, nil
+}
+
+// handleExcelOperation performs an Excel action and returns a description of
+// the result, including the sheet contents for read operations. Created and
+// edited workbooks are staged in tx rather than saved directly.
+func handleExcelOperation(action Action, tx *txn.Tx) (string, error) {
+	switch action.Operation {
+	case "read":
+		data, err := tx.ReadFile(action.Filename)
+		if err != nil {
+			return "", fmt.Errorf("error opening file: %v", err)
+		}
+		f, err := excelize.OpenReader(bytes.NewReader(data))
+		if err != nil {
+			return "", fmt.Errorf("error opening file: %v", err)
+		}
+		defer f.Close()
+		return readWorkbook(f, action)
+
+	case "create":
+		f := excelize.NewFile()
+		defer f.Close()
+
+		for _, a := range action.Actions {
+			if err := applyExcelAction(f, a, tx); err != nil {
+				return "", err
+			}
+		}
+
+		buf, err := f.WriteToBuffer()
+		if err != nil {
+			return "", fmt.Errorf("error saving file: %v", err)
+		}
+		tx.WriteFile(action.Filename, buf.Bytes(), 0644)
+
+		return fmt.Sprintf("Excel file created: %s%s", action.Filename, describeExports(action.Actions)), nil
+
+	case "edit":
+		// Start from the staged workbook if an earlier action in the changeset
+		// already changed it
+		data, err := tx.ReadFile(action.Filename)
+		if err != nil {
+			return "", fmt.Errorf("error opening file: %v", err)
+		}
+		f, err := excelize.OpenReader(bytes.NewReader(data))
+		if err != nil {
+			return "", fmt.Errorf("error opening file: %v", err)
+		}
+		defer f.Close()
+
+		changed := false
+		for _, a := range action.Actions {
+			if err := applyExcelAction(f, a, tx); err != nil {
+				return "", err
+			}
+			changed = changed || a.Type != "export_csv"
+		}
+
+		// Exporting sheets leaves the workbook as it is
+		if !changed {
+			return fmt.Sprintf("Exported from %s%s", action.Filename, describeExports(action.Actions)), nil
+		}
+		buf, err := f.WriteToBuffer()
+		if err != nil {
+			return "", fmt.Errorf("error saving changes: %v", err)
+		}
+		tx.WriteFile(action.Filename, buf.Bytes(), filePerm(action.Filename))
+
+		return fmt.Sprintf("Changes saved to: %s%s", action.Filename, describeExports(action.Actions)), nil
+
+	default:
+		return "", fmt.Errorf("unknown operation: %s", action.Operation)
+	}
+}
+
+// readWorkbook performs the read actions of action on f. Records go to
+// Claude; the terminal only shows what was read.
+func readWorkbook(f *excelize.File, action Action) (string, error) {
+	var output strings.Builder
+	for _, a := range action.Actions {
+		if a.Type != "read_sheet" && a.Type != "read_range" {
+			continue
+		}
+		records, read, total, err := readRange(f, a)
+		if err != nil {
+			return "", err
+		}
+		fmt.Printf("\nRead %d of %d records from sheet '%s' of %s\n", read, total, a.Sheet, action.Filename)
+		if output.Len() > 0 {
+			output.WriteString("\n")
+		}
+		output.WriteString(records)
+	}
+	if output.Len() == 0 {
+		return "", fmt.Errorf("no read_range actions given; available sheets: %s",
+			strings.Join(f.GetSheetList(), ", "))
+	}
+	return fmt.Sprintf("Contents of %s:\n\n%s", action.Filename, output.String()), nil
+}
+
+// applyExcelAction performs one create or edit action on a workbook. Read
+// actions are ignored. CSV files are imported from and exported to tx.
+func applyExcelAction(f *excelize.File, a ExcelAction, tx *txn.Tx) error {
+	switch a.Type {
+	case "create_sheet":
+		// New workbooks start with Sheet1, which is kept rather than duplicated
+		if sheetExists(f, a.Sheet) {
+			return nil
+		}
+		if _, err := f.NewSheet(a.Sheet); err != nil {
+			return fmt.Errorf("error creating sheet %s: %v", a.Sheet, err)
+		}
+	case "set_cell":
+		if err := f.SetCellValue(a.Sheet, a.Cell, a.Value); err != nil {
+			return fmt.Errorf("error setting cell %s in sheet %s: %v", a.Cell, a.Sheet, err)
+		}
+	case "add_row":
+		return appendRow(f, a.Sheet, a.Row)
+	case "set_formula":
+		if err := f.SetCellFormula(a.Sheet, a.Cell, strings.TrimPrefix(a.Formula, "=")); err != nil {
+			return fmt.Errorf("error setting formula in cell %s of sheet %s: %v", a.Cell, a.Sheet, err)
+		}
+	case "set_style":
+		err := updateStyle(f, a.Sheet, a.Range, func(style *excelize.Style) {
+			applyStyle(style, *a.Style)
+		})
+		if err != nil {
+			return fmt.Errorf("error styling %s in sheet %s: %v", a.Range, a.Sheet, err)
+		}
+	case "set_number_format":
+		code := a.Format
+		if shorthand, ok := numberFormats[strings.ToLower(code)]; ok {
+			code = shorthand
+		}
+		err := updateStyle(f, a.Sheet, a.Range, func(style *excelize.Style) {
+			style.NumFmt = 0
+			style.DecimalPlaces = nil
+			style.CustomNumFmt = &code
+		})
+		if err != nil {
+			return fmt.Errorf("error formatting %s in sheet %s: %v", a.Range, a.Sheet, err)
+		}
+	case "set_col_width":
+		first, last, err := parseColumns(a.Columns)
+		if err == nil {
+			err = f.SetColWidth(a.Sheet, first, last, a.Width)
+		}
+		if err != nil {
+			return fmt.Errorf("error setting the width of columns %s in sheet %s: %v", a.Columns, a.Sheet, err)
+		}
+	case "freeze_panes":
+		if err := freezePanes(f, a.Sheet, a.Cell); err != nil {
+			return fmt.Errorf("error freezing panes at %s in sheet %s: %v", a.Cell, a.Sheet, err)
+		}
+	case "merge_cells":
+		first, last, _ := strings.Cut(a.Range, ":")
+		if err := f.MergeCell(a.Sheet, first, last); err != nil {
+			return fmt.Errorf("error merging %s in sheet %s: %v", a.Range, a.Sheet, err)
+		}
+	case "add_chart":
+		if err := addChart(f, a); err != nil {
+			return fmt.Errorf("error adding %s chart to sheet %s: %v", a.Chart.Type, a.Sheet, err)
+		}
+	case "insert_rows", "delete_rows", "insert_cols", "delete_cols":
+		if err := changeLines(f, a); err != nil {
+			return fmt.Errorf("error in %s on sheet %s: %v", a.Type, a.Sheet, err)
+		}
+	case "sort_range":
+		if !sheetExists(f, a.Sheet) {
+			return fmt.Errorf("error sorting %s: sheet %s does not exist", a.Range, a.Sheet)
+		}
+		if err := sortRange(f, a); err != nil {
+			return fmt.Errorf("error sorting %s in sheet %s: %v", a.Range, a.Sheet, err)
+		}
+	case "delete_sheet":
+		switch {
+		case !sheetExists(f, a.Sheet):
+			return fmt.Errorf("error deleting sheet %s: it does not exist", a.Sheet)
+		case f.SheetCount == 1:
+			return fmt.Errorf("error deleting sheet %s: a workbook needs at least one sheet", a.Sheet)
+		}
+		if err := f.DeleteSheet(a.Sheet); err != nil {
+			return fmt.Errorf("error deleting sheet %s: %v", a.Sheet, err)
+		}
+	case "import_csv":
+		if err := importCSV(f, a, tx); err != nil {
+			return fmt.Errorf("error importing %s into sheet %s: %v", a.File, a.Sheet, err)
+		}
+	case "export_csv":
+		if err := exportCSV(f, a, tx); err != nil {
+			return fmt.Errorf("error exporting sheet %s to %s: %w", a.Sheet, a.File, err)
+		}
+	case "rename_sheet":
+		switch {
+		case !sheetExists(f, a.Sheet):
+			return fmt.Errorf("error renaming sheet %s: it does not exist", a.Sheet)
+		case !strings.EqualFold(a.Sheet, a.NewName) && sheetExists(f, a.NewName):
+			return fmt.Errorf("error renaming sheet %s: a sheet named %s already exists", a.Sheet, a.NewName)
+		}
+		source := a.Sheet
+		// excelize ignores renames that only change the case, so those go
+		// through a temporary name
+		if source != a.NewName && strings.EqualFold(source, a.NewName) && !sheetExists(f, renameSheet) {
+			if err := f.SetSheetName(source, renameSheet); err != nil {
+				return fmt.Errorf("error renaming sheet %s: %v", a.Sheet, err)
+			}
+			source = renameSheet
+		}
+		if err := f.SetSheetName(source, a.NewName); err != nil {
+			return fmt.Errorf("error renaming sheet %s: %v", a.Sheet, err)
+		}
+	}
+	return nil
+}
+
+// changeLines inserts or deletes the rows or columns of a. Inserted lines
+// take the given positions and the lines there move down or right.
+func changeLines(f *excelize.File, a ExcelAction) error {
+	if !sheetExists(f, a.Sheet) {
+		return fmt.Errorf("sheet %s does not exist", a.Sheet)
+	}
+	switch a.Type {
+	case "insert_rows", "delete_rows":
+		first, last, err := parseRows(a.Rows)
+		if err != nil {
+			return err
+		}
+		if a.Type == "insert_rows" {
+			return f.InsertRows(a.Sheet, first, last-first+1)
+		}
+		for row := last; row >= first; row-- {
+			if err := f.RemoveRow(a.Sheet, row); err != nil {
+				return err
+			}
+		}
+	default:
+		first, last, err := parseColumns(a.Columns)
+		if err != nil {
+			return err
+		}
+		n1, _ := excelize.ColumnNameToNumber(first)
+		n2, _ := excelize.ColumnNameToNumber(last)
+		if a.Type == "insert_cols" {
+			return f.InsertCols(a.Sheet, first, n2-n1+1)
+		}
+		for col := n2; col >= n1; col-- {
+			name, _ := excelize.ColumnNumberToName(col)
+			if err := f.RemoveCol(a.Sheet, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// appendRow adds values after the last used row of a sheet, storing numbers
+// and booleans as such
+func appendRow(f *excelize.File, sheet string, values []string) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	// Convert each value in the row to the appropriate type
+	var rowInterface []interface{}
+	for _, val := range values {
+		// Try to convert string numbers to float64
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			rowInterface = append(rowInterface, f)
+			continue
+		}
+		// Try to convert string "true"/"false" to bool
+		if b, err := strconv.ParseBool(val); err == nil {
+			rowInterface = append(rowInterface, b)
+			continue
+		}
+		// Keep as string if no conversion possible
+		rowInterface = append(rowInterface, val)
+	}
+
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		return fmt.Errorf("error getting rows from sheet %s: %v", sheet, err)
+	}
+	err = f.SetSheetRow(sheet, fmt.Sprintf("A%d", len(rows)+1), &rowInterface)
+	if err != nil {
+		return fmt.Errorf("error adding row to sheet %s: %v", sheet, err)
+	}
+	return nil
+}
+
+// updateStyle changes the style of every cell in a range with update,
+// keeping the rest of each cell's formatting. Cells that share a style
+// share the updated one too.
+func updateStyle(f *excelize.File, sheet, ref string, update func(*excelize.Style)) error {
+	col1, row1, col2, row2, err := parseRange(ref)
+	if err != nil {
+		return err
+	}
+
+	updated := make(map[int]int)
+	for row := row1; row <= row2; row++ {
+		for col := col1; col <= col2; col++ {
+			cell, err := excelize.CoordinatesToCellName(col, row)
+			if err != nil {
+				return err
+			}
+			current, err := f.GetCellStyle(sheet, cell)
+			if err != nil {
+				return err
+			}
+			id, ok := updated[current]
+			if !ok {
+				style, err := f.GetStyle(current)
+				if err != nil {
+					return err
+				}
+				update(style)
+				if id, err = f.NewStyle(style); err != nil {
+					return err
+				}
+				updated[current] = id
+			}
+			if err := f.SetCellStyle(sheet, cell, cell, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyStyle copies the set fields of s onto style
+func applyStyle(style *excelize.Style, s ExcelStyle) {
+	if style.Font == nil {
+		style.Font = &excelize.Font{}
+	}
+	style.Font.Bold = style.Font.Bold || s.Bold
+	style.Font.Italic = style.Font.Italic || s.Italic
+	if s.Underline {
+		style.Font.Underline = "single"
+	}
+	if s.FontSize > 0 {
+		style.Font.Size = s.FontSize
+	}
+	if s.FontColor != "" {
+		style.Font.Color = strings.TrimPrefix(s.FontColor, "#")
+	}
+	if s.FillColor != "" {
+		style.Fill = excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{strings.TrimPrefix(s.FillColor, "#")}}
+	}
+
+	if s.Align != "" || s.VAlign != "" || s.WrapText {
+		if style.Alignment == nil {
+			style.Alignment = &excelize.Alignment{}
+		}
+		if s.Align != "" {
+			style.Alignment.Horizontal = s.Align
+		}
+		if s.VAlign != "" {
+			style.Alignment.Vertical = s.VAlign
+		}
+		style.Alignment.WrapText = style.Alignment.WrapText || s.WrapText
+	}
+
+	if s.Border {
+		style.Border = nil
+		for _, side := range []string{"left", "top", "right", "bottom"} {
+			style.Border = append(style.Border, excelize.Border{Type: side, Color: "000000", Style: 1})
+		}
+	}
+}
+
+// freezePanes keeps the rows above and the columns left of cell in view.
+// Freezing at A1 unfreezes the sheet.
+func freezePanes(f *excelize.File, sheet, cell string) error {
+	col, row, err := excelize.CellNameToCoordinates(cell)
+	if err != nil {
+		return err
+	}
+	if col == 1 && row == 1 {
+		return f.SetPanes(sheet, &excelize.Panes{})
+	}
+
+	pane := "bottomRight"
+	switch {
+	case col == 1:
+		pane = "bottomLeft"
+	case row == 1:
+		pane = "topRight"
+	}
+	return f.SetPanes(sheet, &excelize.Panes{
+		Freeze:      true,
+		XSplit:      col - 1,
+		YSplit:      row - 1,
+		TopLeftCell: cell,
+		ActivePane:  pane,
+		Selection:   []excelize.Selection{{SQRef: cell, ActiveCell: cell, Pane: pane}},
+	})
+}
+
+// addChart draws a chart of a.Range with its top-left corner at a.Cell
+func addChart(f *excelize.File, a ExcelAction) error {
+	dataSheet := a.Chart.DataSheet
+	if dataSheet == "" {
+		dataSheet = a.Sheet
+	}
+	if !sheetExists(f, dataSheet) {
+		return fmt.Errorf("sheet %s does not exist", dataSheet)
+	}
+	col1, row1, col2, row2, err := parseRange(a.Range)
+	if err != nil {
+		return err
+	}
+
+	categories := columnRef(dataSheet, col1, row1+1, row2)
+	var series []excelize.ChartSeries
+	for col := col1 + 1; col <= col2; col++ {
+		series = append(series, excelize.ChartSeries{
+			Name:       columnRef(dataSheet, col, row1, row1),
+			Categories: categories,
+			Values:     columnRef(dataSheet, col, row1+1, row2),
+		})
+	}
+
+	chart := &excelize.Chart{
+		Type:   chartTypes[a.Chart.Type],
+		Series: series,
+		Legend: excelize.ChartLegend{Position: "bottom"},
+	}
+	switch {
+	case a.Chart.Type == "pie":
+		// A pie shows one series, with a slice per category
+		chart.Series = series[:1]
+		chart.PlotArea.ShowPercent = true
+	case len(series) == 1:
+		chart.Legend.Position = "none"
+	}
+	if a.Chart.Title != "" {
+		chart.Title = []excelize.RichTextRun{{Text: a.Chart.Title}}
+	}
+	if a.Chart.XAxisTitle != "" {
+		chart.XAxis.Title = []excelize.RichTextRun{{Text: a.Chart.XAxisTitle}}
+	}
+	if a.Chart.YAxisTitle != "" {
+		chart.YAxis.Title = []excelize.RichTextRun{{Text: a.Chart.YAxisTitle}}
+	}
+	return f.AddChart(a.Sheet, a.Cell, chart)
+}
+
+// columnRef returns an absolute reference to rows first to last of a
+// column, such as 'Sales'!$B$2:$B$13
+func columnRef(sheet string, col, first, last int) string {
+	name, _ := excelize.ColumnNumberToName(col)
+	quoted := "'" + strings.ReplaceAll(sheet, "'", "''") + "'"
+	if first == last {
+		return fmt.Sprintf("%s!$%s$%d", quoted, name, first)
+	}
+	return fmt.Sprintf("%s!$%s$%d:$%s$%d", quoted, name, first, name, last)
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"caia-ai-cli/pkg/txn"
+)
+
+// workbook applies actions to a new workbook
+func workbook(t *testing.T, actions ...ExcelAction) *excelize.File {
+	t.Helper()
+	if err := validateExcelActions(actions); err != nil {
+		t.Fatal(err)
+	}
+	f := excelize.NewFile()
+	t.Cleanup(func() { f.Close() })
+	tx := txn.New()
+	for _, a := range actions {
+		if err := applyExcelAction(f, a, tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f
+}
+
+// cellValue returns the formatted value of a cell
+func cellValue(t *testing.T, f *excelize.File, sheet, cell string) string {
+	t.Helper()
+	value, err := f.GetCellValue(sheet, cell)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestValidateExcelAction(t *testing.T) {
+	yes := true
+	tests := []struct {
+		name   string
+		action ExcelAction
+		err    string // substring of the error, or "" if the action is valid
+	}{
+		{name: "unknown type", action: ExcelAction{Type: "paint", Sheet: "S"}, err: "unknown action type"},
+		{name: "no sheet", action: ExcelAction{Type: "set_cell", Cell: "A1"}, err: "sheet is required"},
+		{name: "set_cell", action: ExcelAction{Type: "set_cell", Sheet: "S", Cell: "B2"}},
+		{name: "invalid cell", action: ExcelAction{Type: "set_cell", Sheet: "S", Cell: "2B"}, err: "invalid cell"},
+		{name: "missing cell", action: ExcelAction{Type: "freeze_panes", Sheet: "S"}, err: "cell is required"},
+		{name: "formula", action: ExcelAction{Type: "set_formula", Sheet: "S", Cell: "A1", Formula: "=1+1"}},
+		{name: "empty formula", action: ExcelAction{Type: "set_formula", Sheet: "S", Cell: "A1", Formula: "="}, err: "formula is required"},
+		{name: "style", action: ExcelAction{Type: "set_style", Sheet: "S", Range: "A1:B2", Style: &ExcelStyle{FontColor: "#1F4E78"}}},
+		{name: "no style", action: ExcelAction{Type: "set_style", Sheet: "S", Range: "A1"}, err: "style is required"},
+		{name: "invalid color", action: ExcelAction{Type: "set_style", Sheet: "S", Range: "A1", Style: &ExcelStyle{FillColor: "red"}}, err: "invalid color"},
+		{name: "invalid align", action: ExcelAction{Type: "set_style", Sheet: "S", Range: "A1", Style: &ExcelStyle{Align: "middle"}}, err: "invalid align"},
+		{name: "font size", action: ExcelAction{Type: "set_style", Sheet: "S", Range: "A1", Style: &ExcelStyle{FontSize: 500}}, err: "font_size"},
+		{name: "range too large", action: ExcelAction{Type: "set_style", Sheet: "S", Range: "A1:Z10000", Style: &ExcelStyle{Bold: true}}, err: "at most"},
+		{name: "no format", action: ExcelAction{Type: "set_number_format", Sheet: "S", Range: "A1"}, err: "format is required"},
+		{name: "invalid range", action: ExcelAction{Type: "set_number_format", Sheet: "S", Range: "A1:?", Format: "percent"}, err: "invalid range"},
+		{name: "column width", action: ExcelAction{Type: "set_col_width", Sheet: "S", Columns: "a:c", Width: 20}},
+		{name: "width too large", action: ExcelAction{Type: "set_col_width", Sheet: "S", Columns: "A", Width: 300}, err: "width must be"},
+		{name: "invalid columns", action: ExcelAction{Type: "set_col_width", Sheet: "S", Columns: "1", Width: 10}, err: "invalid columns"},
+		{name: "merge one cell", action: ExcelAction{Type: "merge_cells", Sheet: "S", Range: "B2:B2"}, err: "single cell"},
+		{name: "chart", action: ExcelAction{Type: "add_chart", Sheet: "S", Range: "A1:B5", Cell: "D2", Chart: &ExcelChart{Type: "pie"}}},
+		{name: "no chart", action: ExcelAction{Type: "add_chart", Sheet: "S", Range: "A1:B5", Cell: "D2"}, err: "chart is required"},
+		{name: "chart type", action: ExcelAction{Type: "add_chart", Sheet: "S", Range: "A1:B5", Cell: "D2", Chart: &ExcelChart{Type: "area"}}, err: "invalid chart type"},
+		{name: "chart without values", action: ExcelAction{Type: "add_chart", Sheet: "S", Range: "A1:A5", Cell: "D2", Chart: &ExcelChart{Type: "line"}}, err: "at least one column of values"},
+		{name: "chart without placement", action: ExcelAction{Type: "add_chart", Sheet: "S", Range: "A1:B5", Chart: &ExcelChart{Type: "line"}}, err: "cell is required"},
+		{name: "read range", action: ExcelAction{Type: "read_range", Sheet: "S", Range: "A1:C9", Limit: 10, Offset: 5, Header: &yes}},
+		{name: "read limit", action: ExcelAction{Type: "read_range", Sheet: "S", Limit: maxReadRows + 1}, err: "limit must be"},
+		{name: "read offset", action: ExcelAction{Type: "read_sheet", Sheet: "S", Offset: -1}, err: "offset cannot be negative"},
+		{name: "insert rows", action: ExcelAction{Type: "insert_rows", Sheet: "S", Rows: "9:5"}},
+		{name: "invalid rows", action: ExcelAction{Type: "delete_rows", Sheet: "S", Rows: "0"}, err: "invalid rows"},
+		{name: "too many rows", action: ExcelAction{Type: "insert_rows", Sheet: "S", Rows: "1:10001"}, err: "more than 10000 rows"},
+		{name: "most rows at once", action: ExcelAction{Type: "delete_rows", Sheet: "S", Rows: "1:10000"}},
+		{name: "too many columns", action: ExcelAction{Type: "insert_cols", Sheet: "S", Columns: "A:NTQ"}, err: "more than 10000 columns"},
+		{name: "most columns at once", action: ExcelAction{Type: "delete_cols", Sheet: "S", Columns: "A:NTP"}},
+		{name: "sort", action: ExcelAction{Type: "sort_range", Sheet: "S", Range: "A1:C9", SortKeys: []SortKey{{Column: "c"}}}},
+		{name: "sort without keys", action: ExcelAction{Type: "sort_range", Sheet: "S", Range: "A1:C9"}, err: "sort_keys is required"},
+		{name: "sort outside the range", action: ExcelAction{Type: "sort_range", Sheet: "S", Range: "A1:C9", SortKeys: []SortKey{{Column: "D"}}}, err: "outside range"},
+		{name: "rename", action: ExcelAction{Type: "rename_sheet", Sheet: "S", NewName: "Totals 2024"}},
+		{name: "rename without a name", action: ExcelAction{Type: "rename_sheet", Sheet: "S"}, err: "new_name is required"},
+		{name: "rename to an invalid name", action: ExcelAction{Type: "rename_sheet", Sheet: "S", NewName: "a/b"}, err: "cannot contain"},
+		{name: "rename to a long name", action: ExcelAction{Type: "rename_sheet", Sheet: "S", NewName: strings.Repeat("x", 32)}, err: "longer than 31"},
+		{name: "import", action: ExcelAction{Type: "import_csv", Sheet: "S", File: "data.TSV", Cell: "B2"}},
+		{name: "import from a workbook", action: ExcelAction{Type: "import_csv", Sheet: "S", File: "data.xlsx"}, err: ".csv or .tsv"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateExcelActions([]ExcelAction{tt.action})
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("validateExcelActions() error = %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("validateExcelActions() error = %v, want one containing %q", err, tt.err)
+			case err != nil && !strings.HasPrefix(err.Error(), "action 1 ("+tt.action.Type+")"):
+				t.Errorf("validateExcelActions() error %q does not name the action", err)
+			}
+		})
+	}
+}
+
+func TestFormulasAreCalculated(t *testing.T) {
+	inTempWorkspace(t, nil)
+	f := workbook(t,
+		ExcelAction{Type: "add_row", Sheet: "Sheet1", Row: []string{"Item", "Price"}},
+		ExcelAction{Type: "add_row", Sheet: "Sheet1", Row: []string{"a", "2.5"}},
+		ExcelAction{Type: "add_row", Sheet: "Sheet1", Row: []string{"b", "4"}},
+		ExcelAction{Type: "set_cell", Sheet: "Sheet1", Cell: "A4", Value: "Total"},
+		ExcelAction{Type: "set_formula", Sheet: "Sheet1", Cell: "B4", Formula: "=SUM(B2:B3)"},
+		ExcelAction{Type: "set_formula", Sheet: "Sheet1", Cell: "C4", Formula: "B4*2"},
+	)
+
+	records, _, _, err := readRange(f, ExcelAction{Sheet: "Sheet1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"_row":4,"Item":"Total","Price":6.5,"C":13}`; !strings.Contains(records, want) {
+		t.Errorf("readRange() = %s, want the record %s", records, want)
+	}
+
+	tx := txn.New()
+	if err := exportCSV(f, ExcelAction{Sheet: "Sheet1", File: "out.csv"}, tx); err != nil {
+		t.Fatal(err)
+	}
+	data, err := tx.ReadFile("out.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Total,6.5,13\n"; !strings.HasSuffix(string(data), want) {
+		t.Errorf("exported %q, want it to end with %q", data, want)
+	}
+
+	// The formulas themselves are kept
+	if formula, _ := f.GetCellFormula("Sheet1", "C4"); formula != "B4*2" {
+		t.Errorf("formula of C4 = %q, want B4*2", formula)
+	}
+}
+
+func TestFormattingActions(t *testing.T) {
+	f := workbook(t,
+		ExcelAction{Type: "set_cell", Sheet: "Sheet1", Cell: "A1", Value: "Title"},
+		ExcelAction{Type: "add_row", Sheet: "Sheet1", Row: []string{"0.25", "1234.5"}},
+		ExcelAction{Type: "set_style", Sheet: "Sheet1", Range: "A1:B1", Style: &ExcelStyle{Bold: true, FillColor: "#FFEE00"}},
+		ExcelAction{Type: "set_style", Sheet: "Sheet1", Range: "A1", Style: &ExcelStyle{Italic: true, Align: "center"}},
+		ExcelAction{Type: "set_number_format", Sheet: "Sheet1", Range: "A2", Format: "percent"},
+		ExcelAction{Type: "set_number_format", Sheet: "Sheet1", Range: "B2", Format: "#,##0.0"},
+		ExcelAction{Type: "set_col_width", Sheet: "Sheet1", Columns: "B:C", Width: 30},
+		ExcelAction{Type: "freeze_panes", Sheet: "Sheet1", Cell: "A2"},
+		ExcelAction{Type: "merge_cells", Sheet: "Sheet1", Range: "A1:B1"},
+	)
+
+	styleOf := func(cell string) *excelize.Style {
+		id, err := f.GetCellStyle("Sheet1", cell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		style, err := f.GetStyle(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return style
+	}
+	if s := styleOf("A1"); !s.Font.Bold || !s.Font.Italic || s.Alignment.Horizontal != "center" || s.Fill.Color[0] != "FFEE00" {
+		t.Errorf("style of A1 = %+v %+v, want bold, italic, centered and filled, keeping earlier changes", s.Font, s.Alignment)
+	}
+	if s := styleOf("B1"); !s.Font.Bold || s.Font.Italic {
+		t.Errorf("style of B1 = %+v, want bold only", s.Font)
+	}
+
+	if got := cellValue(t, f, "Sheet1", "A2"); got != "25.00%" {
+		t.Errorf("A2 = %q, want 25.00%%", got)
+	}
+	if got := cellValue(t, f, "Sheet1", "B2"); got != "1,234.5" {
+		t.Errorf("B2 = %q, want 1,234.5", got)
+	}
+	if width, _ := f.GetColWidth("Sheet1", "C"); width != 30 {
+		t.Errorf("width of column C = %g, want 30", width)
+	}
+	if panes, _ := f.GetPanes("Sheet1"); !panes.Freeze || panes.YSplit != 1 || panes.XSplit != 0 {
+		t.Errorf("panes = %+v, want the first row frozen", panes)
+	}
+	if merged, _ := f.GetMergeCells("Sheet1"); len(merged) != 1 || merged[0].GetStartAxis() != "A1" || merged[0].GetEndAxis() != "B1" {
+		t.Errorf("merged cells = %v, want A1:B1", merged)
+	}
+}
+
+func TestAddChart(t *testing.T) {
+	data := []ExcelAction{
+		{Type: "create_sheet", Sheet: "Sales"},
+		{Type: "add_row", Sheet: "Sales", Row: []string{"Month", "Revenue", "Costs"}},
+		{Type: "add_row", Sheet: "Sales", Row: []string{"Jan", "10", "7"}},
+		{Type: "add_row", Sheet: "Sales", Row: []string{"Feb", "12", "8"}},
+	}
+
+	tests := []struct {
+		name  string
+		chart ExcelAction
+		want  []string // fragments of the chart's XML
+		avoid []string
+	}{
+		{
+			name: "line chart with titles",
+			chart: ExcelAction{Type: "add_chart", Sheet: "Sales", Range: "A1:C3", Cell: "E2",
+				Chart: &ExcelChart{Type: "line", Title: "Monthly revenue", XAxisTitle: "Month", YAxisTitle: "EUR"}},
+			want: []string{"<lineChart>", "Monthly revenue", "<a:t>EUR</a:t>",
+				"<f>'Sales'!$B$1</f>", "<f>'Sales'!$C$2:$C$3</f>", "<f>'Sales'!$A$2:$A$3</f>", `<legendPos val="b">`},
+		},
+		{
+			name:  "column chart",
+			chart: ExcelAction{Type: "add_chart", Sheet: "Sales", Range: "A1:B3", Cell: "E2", Chart: &ExcelChart{Type: "column"}},
+			want:  []string{`<barDir val="col">`, "<f>'Sales'!$B$2:$B$3</f>"},
+			avoid: []string{"$C$", "<legend>"},
+		},
+		{
+			name:  "bar chart",
+			chart: ExcelAction{Type: "add_chart", Sheet: "Sales", Range: "A1:C3", Cell: "E2", Chart: &ExcelChart{Type: "bar"}},
+			want:  []string{`<barDir val="bar">`},
+		},
+		{
+			name:  "pie chart of the first series",
+			chart: ExcelAction{Type: "add_chart", Sheet: "Sales", Range: "A1:C3", Cell: "E2", Chart: &ExcelChart{Type: "pie"}},
+			want:  []string{"<pieChart>", "$B$2:$B$3", `<showPercent val="1">`},
+			avoid: []string{"$C$"},
+		},
+		{
+			name: "scatter chart of another sheet",
+			chart: ExcelAction{Type: "add_chart", Sheet: "Sheet1", Range: "A1:C3", Cell: "B2",
+				Chart: &ExcelChart{Type: "scatter", DataSheet: "Sales"}},
+			want: []string{"<scatterChart>", "<f>'Sales'!$C$2:$C$3</f>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := workbook(t, append(data, tt.chart)...)
+			content, ok := f.Pkg.Load("xl/charts/chart1.xml")
+			if !ok {
+				t.Fatal("no chart was added")
+			}
+			xml := strings.ReplaceAll(string(content.([]byte)), "&#39;", "'")
+			for _, want := range tt.want {
+				if !strings.Contains(xml, want) {
+					t.Errorf("chart is missing %s:\n%s", want, xml)
+				}
+			}
+			for _, avoid := range tt.avoid {
+				if strings.Contains(xml, avoid) {
+					t.Errorf("chart has %s:\n%s", avoid, xml)
+				}
+			}
+		})
+	}
+
+	f := workbook(t, data...)
+	err := applyExcelAction(f, ExcelAction{Type: "add_chart", Sheet: "Sales", Range: "A1:B3", Cell: "E2",
+		Chart: &ExcelChart{Type: "line", DataSheet: "Missing"}}, txn.New())
+	if err == nil || !strings.Contains(err.Error(), "sheet Missing does not exist") {
+		t.Errorf("add_chart with a missing data sheet error = %v", err)
+	}
+}
+
+func TestChangeLines(t *testing.T) {
+	data := []ExcelAction{
+		{Type: "add_row", Sheet: "Sheet1", Row: []string{"a1", "b1", "c1"}},
+		{Type: "add_row", Sheet: "Sheet1", Row: []string{"a2", "b2", "c2"}},
+		{Type: "add_row", Sheet: "Sheet1", Row: []string{"a3", "b3", "c3"}},
+	}
+
+	tests := []struct {
+		name   string
+		action ExcelAction
+		want   string // rows joined by ; and cells by ,
+	}{
+		{name: "insert one row", action: ExcelAction{Type: "insert_rows", Rows: "2"},
+			want: "a1,b1,c1;;a2,b2,c2;a3,b3,c3"},
+		{name: "insert rows", action: ExcelAction{Type: "insert_rows", Rows: "3:2"},
+			want: "a1,b1,c1;;;a2,b2,c2;a3,b3,c3"},
+		{name: "delete rows", action: ExcelAction{Type: "delete_rows", Rows: "1:2"},
+			want: "a3,b3,c3"},
+		{name: "delete rows past the data", action: ExcelAction{Type: "delete_rows", Rows: "3:9"},
+			want: "a1,b1,c1;a2,b2,c2"},
+		{name: "insert columns", action: ExcelAction{Type: "insert_cols", Columns: "b:c"},
+			want: "a1,,,b1,c1;a2,,,b2,c2;a3,,,b3,c3"},
+		{name: "delete columns", action: ExcelAction{Type: "delete_cols", Columns: "C:A"},
+			want: ""},
+		{name: "delete a column", action: ExcelAction{Type: "delete_cols", Columns: "B"},
+			want: "a1,c1;a2,c2;a3,c3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := tt.action
+			a.Sheet = "Sheet1"
+			f := workbook(t, append(data, a)...)
+			rows, err := f.GetRows("Sheet1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, row := range rows {
+				got = append(got, strings.Join(row, ","))
+			}
+			if strings.Join(got, ";") != tt.want {
+				t.Errorf("rows = %s, want %s", strings.Join(got, ";"), tt.want)
+			}
+		})
+	}
+
+	f := workbook(t)
+	err := applyExcelAction(f, ExcelAction{Type: "delete_rows", Sheet: "Missing", Rows: "1"}, txn.New())
+	if err == nil || !strings.Contains(err.Error(), "sheet Missing does not exist") {
+		t.Errorf("delete_rows on a missing sheet error = %v", err)
+	}
+}
+
+func TestSheetActions(t *testing.T) {
+	tests := []struct {
+		name   string
+		action ExcelAction
+		sheets string // the sheets afterwards
+		err    string
+	}{
+		{name: "rename", action: ExcelAction{Type: "rename_sheet", Sheet: "Data", NewName: "Totals"}, sheets: "Sheet1,Totals"},
+		{name: "change case", action: ExcelAction{Type: "rename_sheet", Sheet: "Data", NewName: "DATA"}, sheets: "Sheet1,DATA"},
+		{name: "rename onto another sheet", action: ExcelAction{Type: "rename_sheet", Sheet: "Data", NewName: "sheet1"}, err: "already exists"},
+		{name: "rename a missing sheet", action: ExcelAction{Type: "rename_sheet", Sheet: "Missing", NewName: "x"}, err: "does not exist"},
+		{name: "delete", action: ExcelAction{Type: "delete_sheet", Sheet: "Data"}, sheets: "Sheet1"},
+		{name: "delete a missing sheet", action: ExcelAction{Type: "delete_sheet", Sheet: "Missing"}, err: "does not exist"},
+		{name: "create an existing sheet", action: ExcelAction{Type: "create_sheet", Sheet: "Data"}, sheets: "Sheet1,Data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := workbook(t, ExcelAction{Type: "create_sheet", Sheet: "Data"})
+			err := applyExcelAction(f, tt.action, txn.New())
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("%s error = %v, want one containing %q", tt.action.Type, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(f.GetSheetList(), ","); got != tt.sheets {
+				t.Errorf("sheets = %s, want %s", got, tt.sheets)
+			}
+		})
+	}
+
+	f := workbook(t)
+	err := applyExcelAction(f, ExcelAction{Type: "delete_sheet", Sheet: "Sheet1"}, txn.New())
+	if err == nil || !strings.Contains(err.Error(), "at least one sheet") {
+		t.Errorf("deleting the last sheet error = %v", err)
+	}
+}
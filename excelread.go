@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	// defaultReadRows is how many records read_range returns without a limit
+	defaultReadRows = 100
+	// maxReadRows caps the limit of read_range
+	maxReadRows = 1000
+)
+
+// jsonNumber matches cell values that can be sent as JSON numbers as they
+// are. Values with leading zeros, such as ZIP codes, stay strings.
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// numericText matches numbers kept as text, such as 01234
+var numericText = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// sheetRecord is one row of a range with its row number
+type sheetRecord struct {
+	row   int
+	cells []string
+}
+
+// readRange reads the records of a sheet range, or of the whole sheet when
+// no range is given, and formats them as JSON objects keyed by the header
+// row, or by column letter when there is none. It also returns how many
+// records were read of how many in the range. Rows are streamed, so only the
+// records returned are kept in memory.
+func readRange(f *excelize.File, a ExcelAction) (string, int, int, error) {
+	col1, row1, col2, row2 := 1, 1, 0, 0 // 0 means unbounded
+	if a.Range != "" {
+		var err error
+		if col1, row1, col2, row2, err = parseRange(a.Range); err != nil {
+			return "", 0, 0, err
+		}
+	}
+	limit := a.Limit
+	if limit <= 0 {
+		limit = defaultReadRows
+	}
+
+	rows, err := f.Rows(a.Sheet)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("error reading sheet %s: %v", a.Sheet, err)
+	}
+	defer rows.Close()
+
+	var (
+		header    []string
+		headerRow int
+		decided   bool // whether the first row has been checked for a header
+		records   []sheetRecord
+		total     int
+	)
+	for n := 1; rows.Next(); n++ {
+		if n < row1 {
+			continue
+		}
+		if row2 > 0 && n > row2 {
+			break
+		}
+		cells, err := rows.Columns()
+		if err != nil {
+			return "", 0, 0, fmt.Errorf("error reading row %d of sheet %s: %v", n, a.Sheet, err)
+		}
+		cells = clipColumns(cells, col1, col2)
+		calcFormulas(f, a.Sheet, n, col1, cells)
+		if isEmptyRow(cells) {
+			continue
+		}
+
+		if !decided {
+			decided = true
+			if a.Header != nil && *a.Header || a.Header == nil && looksLikeHeader(cells) {
+				header, headerRow = headerNames(cells, col1), n
+				continue
+			}
+		}
+
+		total++
+		if total > a.Offset && len(records) < limit {
+			records = append(records, sheetRecord{row: n, cells: cells})
+		}
+	}
+	if err := rows.Error(); err != nil {
+		return "", 0, 0, fmt.Errorf("error reading sheet %s: %v", a.Sheet, err)
+	}
+
+	var b strings.Builder
+	where := "all rows"
+	if a.Range != "" {
+		where = "range " + strings.ToUpper(a.Range)
+	}
+	fmt.Fprintf(&b, "Sheet '%s', %s.\n", a.Sheet, where)
+	if headerRow > 0 {
+		names, _ := json.Marshal(header)
+		fmt.Fprintf(&b, "Header in row %d: %s\n", headerRow, names)
+	} else {
+		b.WriteString("No header row; records are keyed by column letter.\n")
+	}
+	if len(records) == 0 {
+		fmt.Fprintf(&b, "No records after offset %d (%d in total).\n", a.Offset, total)
+		return b.String(), 0, total, nil
+	}
+
+	fmt.Fprintf(&b, "Records %d-%d of %d (_row is the sheet row):\n", a.Offset+1, a.Offset+len(records), total)
+	for _, r := range records {
+		b.WriteString(formatRecord(r, header, col1))
+		b.WriteString("\n")
+	}
+	if rest := total - a.Offset - len(records); rest > 0 {
+		fmt.Fprintf(&b, "%d more records; read again with offset %d.\n", rest, a.Offset+len(records))
+	}
+	return b.String(), len(records), total, nil
+}
+
+// clipColumns returns the cells of columns col1 to col2, or to the end of
+// the row when col2 is 0
+func clipColumns(cells []string, col1, col2 int) []string {
+	if col1 > len(cells) {
+		return nil
+	}
+	if col2 > 0 && col2 < len(cells) {
+		cells = cells[:col2]
+	}
+	return cells[col1-1:]
+}
+
+// calcFormulas fills in the formula cells of a row that have no cached
+// value, as is the case for formulas written by set_formula until Excel
+// recalculates the workbook. cells are row n of a sheet from column col1.
+// Formulas excelize cannot calculate stay empty.
+func calcFormulas(f *excelize.File, sheet string, n, col1 int, cells []string) {
+	for i, c := range cells {
+		if c != "" {
+			continue
+		}
+		name, _ := excelize.CoordinatesToCellName(col1+i, n)
+		if formula, err := f.GetCellFormula(sheet, name); err != nil || formula == "" {
+			continue
+		}
+		if value, err := f.CalcCellValue(sheet, name); err == nil {
+			cells[i] = value
+		}
+	}
+}
+
+func isEmptyRow(cells []string) bool {
+	for _, c := range cells {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// looksLikeHeader reports whether the first row of a range is a header:
+// every cell holds distinct text that is not a number or boolean
+func looksLikeHeader(cells []string) bool {
+	seen := make(map[string]bool)
+	for _, c := range cells {
+		c = strings.TrimSpace(c)
+		if c == "" || seen[c] || jsonNumber.MatchString(c) || numericText.MatchString(c) ||
+			strings.EqualFold(c, "true") || strings.EqualFold(c, "false") {
+			return false
+		}
+		seen[c] = true
+	}
+	return true
+}
+
+// headerNames turns a header row into record keys. Empty cells are named by
+// their column letter and repeated names get a suffix.
+func headerNames(cells []string, col1 int) []string {
+	names := make([]string, len(cells))
+	seen := make(map[string]int)
+	for i, c := range cells {
+		name := strings.TrimSpace(c)
+		if name == "" {
+			name, _ = excelize.ColumnNumberToName(col1 + i)
+		}
+		seen[name]++
+		if seen[name] > 1 {
+			name = fmt.Sprintf("%s_%d", name, seen[name])
+		}
+		names[i] = name
+	}
+	return names
+}
+
+// formatRecord writes a row as a JSON object with the keys in column order
+func formatRecord(r sheetRecord, header []string, col1 int) string {
+	width := len(r.cells)
+	if header != nil {
+		width = max(len(header), width)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `{"_row":%d`, r.row)
+	for i := 0; i < width; i++ {
+		var key string
+		if i < len(header) {
+			key = header[i]
+		} else {
+			key, _ = excelize.ColumnNumberToName(col1 + i)
+		}
+		value := ""
+		if i < len(r.cells) {
+			value = r.cells[i]
+		}
+		// Empty cells outside the header are left out rather than keyed
+		if i >= len(header) && value == "" {
+			continue
+		}
+		k, _ := json.Marshal(key)
+		fmt.Fprintf(&b, ",%s:%s", k, cellJSON(value))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// cellJSON encodes a formatted cell value, keeping numbers and booleans typed
+func cellJSON(value string) string {
+	switch {
+	case jsonNumber.MatchString(value):
+		return value
+	case value == "TRUE":
+		return "true"
+	case value == "FALSE":
+		return "false"
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadRange(t *testing.T) {
+	f := workbook(t,
+		ExcelAction{Type: "add_row", Sheet: "Sheet1", Row: []string{"Name", "Zip", "Active", "Score"}},
+		ExcelAction{Type: "add_row", Sheet: "Sheet1", Row: []string{"ann", "1", "true", "1.5"}},
+		ExcelAction{Type: "add_row", Sheet: "Sheet1", Row: []string{"bob", "98765", "false", "2"}},
+		ExcelAction{Type: "add_row", Sheet: "Sheet1", Row: []string{"cy", "", "", "3", "extra"}},
+		ExcelAction{Type: "set_cell", Sheet: "Sheet1", Cell: "A6", Value: "dee"},
+		// Text with a leading zero, unlike the numbers add_row stores
+		ExcelAction{Type: "set_cell", Sheet: "Sheet1", Cell: "B2", Value: "01234"},
+		ExcelAction{Type: "create_sheet", Sheet: "Numbers"},
+		ExcelAction{Type: "add_row", Sheet: "Numbers", Row: []string{"1", "2"}},
+		ExcelAction{Type: "add_row", Sheet: "Numbers", Row: []string{"3", "4"}},
+	)
+	yes, no := true, false
+
+	tests := []struct {
+		name   string
+		action ExcelAction
+		want   []string // lines of the result, in order
+		read   int
+		total  int
+	}{
+		{
+			name:   "whole sheet with a header",
+			action: ExcelAction{Sheet: "Sheet1"},
+			want: []string{
+				"Sheet 'Sheet1', all rows.",
+				`Header in row 1: ["Name","Zip","Active","Score"]`,
+				"Records 1-4 of 4 (_row is the sheet row):",
+				`{"_row":2,"Name":"ann","Zip":"01234","Active":true,"Score":1.5}`,
+				`{"_row":3,"Name":"bob","Zip":98765,"Active":false,"Score":2}`,
+				`{"_row":4,"Name":"cy","Zip":"","Active":"","Score":3,"E":"extra"}`,
+				`{"_row":6,"Name":"dee","Zip":"","Active":"","Score":""}`,
+			},
+			read: 4, total: 4,
+		},
+		{
+			name:   "limit and offset",
+			action: ExcelAction{Sheet: "Sheet1", Limit: 2, Offset: 1},
+			want: []string{
+				"Records 2-3 of 4 (_row is the sheet row):",
+				`{"_row":3,`,
+				`{"_row":4,`,
+				"1 more records; read again with offset 3.",
+			},
+			read: 2, total: 4,
+		},
+		{
+			name:   "offset past the end",
+			action: ExcelAction{Sheet: "Sheet1", Offset: 10},
+			want:   []string{"No records after offset 10 (4 in total)."},
+			total:  4,
+		},
+		{
+			name:   "range below the header",
+			action: ExcelAction{Sheet: "Sheet1", Range: "b2:c3"},
+			want: []string{
+				"Sheet 'Sheet1', range B2:C3.",
+				"No header row; records are keyed by column letter.",
+				`{"_row":2,"B":"01234","C":true}`,
+				`{"_row":3,"B":98765,"C":false}`,
+			},
+			read: 2, total: 2,
+		},
+		{
+			name:   "header forced off",
+			action: ExcelAction{Sheet: "Sheet1", Range: "A1:A2", Header: &no},
+			want:   []string{`{"_row":1,"A":"Name"}`, `{"_row":2,"A":"ann"}`},
+			read:   2, total: 2,
+		},
+		{
+			name:   "numbers are not a header",
+			action: ExcelAction{Sheet: "Numbers"},
+			want:   []string{"No header row", `{"_row":1,"A":1,"B":2}`, `{"_row":2,"A":3,"B":4}`},
+			read:   2, total: 2,
+		},
+		{
+			name:   "header forced on",
+			action: ExcelAction{Sheet: "Numbers", Header: &yes},
+			want:   []string{`Header in row 1: ["1","2"]`, `{"_row":2,"1":3,"2":4}`},
+			read:   1, total: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, read, total, err := readRange(f, tt.action)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rest := got
+			for _, want := range tt.want {
+				i := strings.Index(rest, want)
+				if i < 0 {
+					t.Fatalf("readRange() is missing %s after the earlier lines:\n%s", want, got)
+				}
+				rest = rest[i+len(want):]
+			}
+			if read != tt.read || total != tt.total {
+				t.Errorf("readRange() read %d of %d records, want %d of %d", read, total, tt.read, tt.total)
+			}
+		})
+	}
+
+	if _, _, _, err := readRange(f, ExcelAction{Sheet: "Missing"}); err == nil {
+		t.Error("readRange() of a missing sheet succeeded")
+	}
+}
+
+func TestHeaderNames(t *testing.T) {
+	got := headerNames([]string{"Name", "", " Name ", "Name"}, 2)
+	want := []string{"Name", "C", "Name_2", "Name_3"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("headerNames() = %q, want %q", got, want)
+	}
+}
+
+func TestLooksLikeHeader(t *testing.T) {
+	tests := []struct {
+		cells []string
+		want  bool
+	}{
+		{[]string{"Name", "Zip code", "Active"}, true},
+		{[]string{"Name", "2024"}, false},
+		{[]string{"Name", "01234"}, false},
+		{[]string{"Name", "-1.5e3"}, false},
+		{[]string{"Name", "TRUE"}, false},
+		{[]string{"Name", "Name"}, false},
+		{[]string{"Name", " "}, false},
+		{[]string{"Q1 2024", "v1.2"}, true},
+	}
+	for _, tt := range tests {
+		if got := looksLikeHeader(tt.cells); got != tt.want {
+			t.Errorf("looksLikeHeader(%q) = %v, want %v", tt.cells, got, tt.want)
+		}
+	}
+}
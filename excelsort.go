@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// SortKey is one column sort_range orders rows by
+type SortKey struct {
+	Column     string `json:"column"`
+	Descending bool   `json:"descending,omitempty"`
+}
+
+// sheetCell is what sorting keeps of a cell to write it back elsewhere
+type sheetCell struct {
+	value string // the raw value, e.g. a date's serial number
+	kind  excelize.CellType
+	style int
+}
+
+// sortRange orders the rows of a.Range by a.SortKeys, keeping each cell's
+// value type and style. A header row, given or detected as in read_range,
+// stays in place. Ranges with formulas are refused, since moving a formula
+// to another row would leave its references pointing at the old rows.
+func sortRange(f *excelize.File, a ExcelAction) error {
+	col1, row1, col2, row2, err := parseRange(a.Range)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]sheetCell, 0, row2-row1+1)
+	for row := row1; row <= row2; row++ {
+		cells := make([]sheetCell, 0, col2-col1+1)
+		for col := col1; col <= col2; col++ {
+			name, _ := excelize.CoordinatesToCellName(col, row)
+			if formula, err := f.GetCellFormula(a.Sheet, name); err != nil {
+				return err
+			} else if formula != "" {
+				return fmt.Errorf("cell %s has a formula; sorting would break its references, so sort a range "+
+					"without formulas or rewrite them with set_formula afterwards", name)
+			}
+			value, err := f.GetCellValue(a.Sheet, name, excelize.Options{RawCellValue: true})
+			if err != nil {
+				return err
+			}
+			kind, err := f.GetCellType(a.Sheet, name)
+			if err != nil {
+				return err
+			}
+			style, err := f.GetCellStyle(a.Sheet, name)
+			if err != nil {
+				return err
+			}
+			cells = append(cells, sheetCell{value: value, kind: kind, style: style})
+		}
+		rows = append(rows, cells)
+	}
+
+	// Keep the header in place
+	first := row1
+	if len(rows) > 1 && (a.Header != nil && *a.Header || a.Header == nil && looksLikeHeader(cellValues(rows[0]))) {
+		rows, first = rows[1:], row1+1
+	}
+
+	keys := make([]int, len(a.SortKeys))
+	for i, key := range a.SortKeys {
+		n, err := excelize.ColumnNameToNumber(key.Column)
+		if err != nil {
+			return err
+		}
+		keys[i] = n - col1
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k, key := range a.SortKeys {
+			c := compareCells(rows[i][keys[k]].value, rows[j][keys[k]].value, key.Descending)
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	for i, cells := range rows {
+		for j, cell := range cells {
+			name, _ := excelize.CoordinatesToCellName(col1+j, first+i)
+			if err := writeCell(f, a.Sheet, name, cell); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func cellValues(cells []sheetCell) []string {
+	values := make([]string, len(cells))
+	for i, c := range cells {
+		values[i] = c.value
+	}
+	return values
+}
+
+// compareCells orders numbers before text and text case-insensitively.
+// Empty cells come last in either direction, as in Excel.
+func compareCells(a, b string, descending bool) int {
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	var c int
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	switch {
+	case errA == nil && errB == nil:
+		switch {
+		case x < y:
+			c = -1
+		case x > y:
+			c = 1
+		}
+	case errA == nil:
+		c = -1
+	case errB == nil:
+		c = 1
+	default:
+		c = strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	}
+	if descending {
+		return -c
+	}
+	return c
+}
+
+// writeCell stores a cell read by sortRange, keeping numbers, booleans and
+// dates typed
+func writeCell(f *excelize.File, sheet, name string, cell sheetCell) error {
+	var err error
+	switch {
+	case cell.value == "":
+		err = f.SetCellValue(sheet, name, nil)
+	case cell.kind == excelize.CellTypeBool:
+		err = f.SetCellBool(sheet, name, cell.value == "1" || strings.EqualFold(cell.value, "true"))
+	case cell.kind == excelize.CellTypeNumber || cell.kind == excelize.CellTypeUnset || cell.kind == excelize.CellTypeDate:
+		if n, parseErr := strconv.ParseFloat(cell.value, 64); parseErr == nil {
+			err = f.SetCellFloat(sheet, name, n, -1, 64)
+		} else {
+			err = f.SetCellStr(sheet, name, cell.value)
+		}
+	default:
+		err = f.SetCellStr(sheet, name, cell.value)
+	}
+	if err != nil {
+		return err
+	}
+	return f.SetCellStyle(sheet, name, name, cell.style)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"caia-ai-cli/pkg/txn"
+)
+
+func TestSortRange(t *testing.T) {
+	f := workbook(t,
+		ExcelAction{Type: "add_row", Sheet: "Sheet1", Row: []string{"Team", "Points", "Done"}},
+		ExcelAction{Type: "add_row", Sheet: "Sheet1", Row: []string{"b", "10", "true"}},
+		ExcelAction{Type: "add_row", Sheet: "Sheet1", Row: []string{"A", "7", "false"}},
+		ExcelAction{Type: "add_row", Sheet: "Sheet1", Row: []string{"c", "10", "false"}},
+		ExcelAction{Type: "add_row", Sheet: "Sheet1", Row: []string{"", "n/a", "true"}},
+		ExcelAction{Type: "add_row", Sheet: "Sheet1", Row: []string{"a", "", "true"}},
+		ExcelAction{Type: "set_number_format", Sheet: "Sheet1", Range: "B3", Format: "decimal"},
+		ExcelAction{Type: "sort_range", Sheet: "Sheet1", Range: "A1:C6", SortKeys: []SortKey{
+			{Column: "B", Descending: true},
+			{Column: "A"},
+		}},
+	)
+
+	rows, err := f.GetRows("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"Team", "Points", "Done"},
+		{"", "n/a", "TRUE"}, // text comes before numbers when descending, as in Excel
+		{"b", "10", "TRUE"},
+		{"c", "10", "FALSE"},
+		{"A", "7.00", "FALSE"},
+		{"a", "", "TRUE"},
+	}
+	for i := range want {
+		if i >= len(rows) || strings.Join(rows[i], "|") != strings.Join(want[i], "|") {
+			t.Fatalf("sorted rows = %q, want %q", rows, want)
+		}
+	}
+
+	// Values keep their types, and styles move with them
+	for cell, kind := range map[string]excelize.CellType{
+		"B3": excelize.CellTypeUnset, // numbers have no type attribute
+		"B2": excelize.CellTypeSharedString,
+		"C3": excelize.CellTypeBool,
+	} {
+		if got, _ := f.GetCellType("Sheet1", cell); got != kind {
+			t.Errorf("type of %s = %v, want %v", cell, got, kind)
+		}
+	}
+	if value, _ := f.GetCellValue("Sheet1", "B4", excelize.Options{RawCellValue: true}); value != "10" {
+		t.Errorf("raw value of B4 = %q, want the number 10", value)
+	}
+}
+
+func TestSortRangeHeader(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name   string
+		header *bool
+		first  string
+		want   string // column A after sorting
+	}{
+		{name: "detected header", first: "Name", want: "Name|a|b|c"},
+		{name: "booleans are sorted", first: "TRUE", want: "a|b|c|TRUE"},
+		{name: "header given", header: &yes, first: "9", want: "9|a|b|c"},
+		{name: "no header", header: &no, first: "Name", want: "a|b|c|Name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := workbook(t,
+				ExcelAction{Type: "set_cell", Sheet: "Sheet1", Cell: "A1", Value: tt.first},
+				ExcelAction{Type: "set_cell", Sheet: "Sheet1", Cell: "A2", Value: "c"},
+				ExcelAction{Type: "set_cell", Sheet: "Sheet1", Cell: "A3", Value: "a"},
+				ExcelAction{Type: "set_cell", Sheet: "Sheet1", Cell: "A4", Value: "b"},
+				ExcelAction{Type: "sort_range", Sheet: "Sheet1", Range: "A1:A4", Header: tt.header, SortKeys: []SortKey{{Column: "A"}}},
+			)
+			cols, err := f.GetCols("Sheet1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(cols[0], "|"); got != tt.want {
+				t.Errorf("column A = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortRangeRefusesFormulas(t *testing.T) {
+	f := workbook(t,
+		ExcelAction{Type: "add_row", Sheet: "Sheet1", Row: []string{"2"}},
+		ExcelAction{Type: "set_formula", Sheet: "Sheet1", Cell: "A2", Formula: "=A1*2"},
+	)
+	err := applyExcelAction(f, ExcelAction{Type: "sort_range", Sheet: "Sheet1", Range: "A1:A2",
+		SortKeys: []SortKey{{Column: "A"}}}, txn.New())
+	if err == nil || !strings.Contains(err.Error(), "cell A2 has a formula") {
+		t.Errorf("sort_range over a formula error = %v", err)
+	}
+
+	err = applyExcelAction(f, ExcelAction{Type: "sort_range", Sheet: "Missing", Range: "A1:A2",
+		SortKeys: []SortKey{{Column: "A"}}}, txn.New())
+	if err == nil || !strings.Contains(err.Error(), "sheet Missing does not exist") {
+		t.Errorf("sort_range on a missing sheet error = %v", err)
+	}
+}
+
+func TestCompareCells(t *testing.T) {
+	tests := []struct {
+		a, b       string
+		descending bool
+		want       int
+	}{
+		{"2", "10", false, -1},
+		{"2", "10", true, 1},
+		{"10", "apple", false, -1},
+		{"apple", "10", true, -1},
+		{"Apple", "apple", false, 0},
+		{"apple", "Banana", false, -1},
+		{"", "apple", false, 1},
+		{"", "apple", true, 1},
+		{"", "", false, 0},
+	}
+	for _, tt := range tests {
+		if got := compareCells(tt.a, tt.b, tt.descending); got != tt.want {
+			t.Errorf("compareCells(%q, %q, %v) = %d, want %d", tt.a, tt.b, tt.descending, got, tt.want)
+		}
+	}
+}
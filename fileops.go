@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"caia-ai-cli/pkg/txn"
+)
+
+// countEntries returns the number of files and directories below dir
+func countEntries(dir string) int {
+	count := 0
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && path != dir {
+			count++
+		}
+		return nil
+	})
+	return count
+}
+
+// deletePrompt builds the confirmation prompt for a delete action
+func deletePrompt(action Action) string {
+	info, err := os.Stat(action.Filename)
+	if err != nil {
+		return fmt.Sprintf("\nDo you want to delete '%s'? (y/n): ", action.Filename)
+	}
+	if info.IsDir() {
+		return fmt.Sprintf("\nDo you want to delete directory '%s' and its %d entries? (y/n): ",
+			action.Filename, countEntries(action.Filename))
+	}
+	return fmt.Sprintf("\nDo you want to delete file '%s' (%d bytes)? (y/n): ", action.Filename, info.Size())
+}
+
+// movePrompt builds the confirmation prompt for a move or rename action whose
+// destination has been resolved with moveTarget
+func movePrompt(action Action) string {
+	kind := "file"
+	if info, err := os.Stat(action.Filename); err == nil && info.IsDir() {
+		kind = "directory"
+	}
+	return fmt.Sprintf("\nDo you want to move %s '%s' to '%s'? (y/n): ",
+		kind, action.Filename, action.Destination)
+}
+
+// moveTarget resolves the final path of a move. Moving into an existing
+// directory keeps the original name.
+func moveTarget(source, destination string) string {
+	if info, err := os.Stat(destination); err == nil && info.IsDir() {
+		return filepath.Join(destination, filepath.Base(source))
+	}
+	return destination
+}
+
+// deletePath stages removal of a file, or of a directory when it is empty or
+// recursive is set
+func deletePath(action Action, tx *txn.Tx) (string, error) {
+	info, err := os.Stat(action.Filename)
+	if err != nil {
+		return "", fmt.Errorf("error deleting %s: %v", action.Filename, err)
+	}
+
+	if !info.IsDir() {
+		tx.Remove(action.Filename)
+		return fmt.Sprintf("Deleted file %s", action.Filename), nil
+	}
+
+	entries := countEntries(action.Filename)
+	if entries > 0 && !action.Recursive {
+		return "", fmt.Errorf("directory %s is not empty (%d entries); set recursive to delete it",
+			action.Filename, entries)
+	}
+	tx.Remove(action.Filename)
+	return fmt.Sprintf("Deleted directory %s and %d entries", action.Filename, entries), nil
+}
+
+// movePath stages a move or rename of a file or directory without
+// overwriting anything. action.Destination is the final path, as resolved by
+// moveTarget.
+func movePath(action Action, tx *txn.Tx) (string, error) {
+	if _, err := os.Stat(action.Filename); err != nil {
+		return "", fmt.Errorf("error moving %s: %v", action.Filename, err)
+	}
+
+	target := action.Destination
+	if _, err := os.Stat(target); err == nil {
+		return "", fmt.Errorf("cannot move %s: %s already exists", action.Filename, target)
+	}
+
+	tx.Rename(action.Filename, target)
+	return fmt.Sprintf("Moved %s to %s", action.Filename, target), nil
+}
+
+// makeDir stages creation of a directory and any missing parents
+func makeDir(action Action, tx *txn.Tx) (string, error) {
+	if info, err := os.Stat(action.Filename); err == nil {
+		if info.IsDir() {
+			return fmt.Sprintf("Directory %s already exists", action.Filename), nil
+		}
+		return "", fmt.Errorf("cannot create directory %s: a file with that name exists", action.Filename)
+	}
+	tx.MkdirAll(action.Filename, 0755)
+	return fmt.Sprintf("Created directory %s", action.Filename), nil
+}
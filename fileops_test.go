@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"caia-ai-cli/pkg/txn"
+)
+
+// inTempWorkspace runs the test in an empty directory holding files. Names
+// ending in a slash are created as directories.
+func inTempWorkspace(t *testing.T, files map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	for name, content := range files {
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(name, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// answer feeds input to the next confirmation prompt
+func answer(t *testing.T, input string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString(input)
+	w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		r.Close()
+	})
+}
+
+func TestMove(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       map[string]string
+		source      string
+		destination string
+		want        string // path the source ends up at
+		err         string // substring of the error, if one is expected
+	}{
+		{
+			name:        "rename",
+			files:       map[string]string{"a.go": "a"},
+			source:      "a.go",
+			destination: "b.go",
+			want:        "b.go",
+		},
+		{
+			name:        "file into an existing directory",
+			files:       map[string]string{"a.go": "a", "lib/": ""},
+			source:      "a.go",
+			destination: "lib",
+			want:        filepath.Join("lib", "a.go"),
+		},
+		{
+			name:        "directory into an existing directory",
+			files:       map[string]string{"src/a.go": "a", "lib/": ""},
+			source:      "src",
+			destination: "lib",
+			want:        filepath.Join("lib", "src"),
+		},
+		{
+			name:        "directory onto an existing entry of the same name",
+			files:       map[string]string{"src/a.go": "a", "lib/src/b.go": "b"},
+			source:      "src",
+			destination: "lib",
+			err:         filepath.Join("lib", "src") + " already exists",
+		},
+		{
+			name:        "onto an existing file",
+			files:       map[string]string{"a.go": "a", "b.go": "b"},
+			source:      "a.go",
+			destination: "b.go",
+			err:         "b.go already exists",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempWorkspace(t, tt.files)
+			t.Cleanup(forgetVersions)
+			seen := filepath.Join(tt.source, "seen.go")
+			if _, ok := tt.files[tt.source]; ok {
+				seen = tt.source
+			}
+			rememberVersion(seen, []byte("seen"))
+
+			answer(t, "y\n")
+			tx := txn.New()
+			action := Action{Operation: "move", Filename: tt.source, Destination: tt.destination}
+			output, err := handleOperation(&action, tx)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("handleOperation() = %q, %v, want an error containing %q", output, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handleOperation() error = %v", err)
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("Commit() error = %v", err)
+			}
+			rememberWritten(action)
+
+			if want := "Moved " + tt.source + " to " + tt.want; output != want {
+				t.Errorf("output = %q, want %q", output, want)
+			}
+			if _, err := os.Stat(tt.want); err != nil {
+				t.Errorf("%s was not moved to %s: %v", tt.source, tt.want, err)
+			}
+			moved := filepath.Join(tt.want, strings.TrimPrefix(seen, tt.source))
+			if err := checkVersion(moved, []byte("other")); err == nil {
+				t.Errorf("the version seen of %s was not moved to %s", seen, moved)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"caia-ai-cli/pkg/journal"
+)
+
+// changeJournal records every applied changeset for /undo and /redo. It is
+// nil when the journal could not be opened.
+var changeJournal *journal.Journal
+
+// undoChange handles /undo (redo false) and /redo (redo true). It returns a
+// note telling Claude what was reverted or reapplied, or "" if nothing changed.
+func undoChange(redo bool) string {
+	if changeJournal == nil {
+		fmt.Println("The undo journal is not available.")
+		return ""
+	}
+
+	verb := "undo"
+	if redo {
+		verb = "redo"
+	}
+
+	entry, err := changeJournal.Next(redo)
+	if errors.Is(err, journal.ErrNothingToUndo) || errors.Is(err, journal.ErrNothingToRedo) {
+		fmt.Printf("Nothing to %s.\n", verb)
+		return ""
+	}
+
+	modified, err := changeJournal.Modified(redo)
+	if err != nil {
+		fmt.Printf("Error checking files: %v\n", err)
+		return ""
+	}
+
+	fmt.Printf("\nAbout to %s #%d: %s\n", verb, entry.ID, entry.Description)
+	if len(modified) > 0 {
+		fmt.Printf("Warning: these paths changed since and will be overwritten: %s\n",
+			strings.Join(modified, ", "))
+	}
+	if !confirm(fmt.Sprintf("Do you want to %s these changes? (y/n): ", verb)) {
+		fmt.Println("Cancelled.")
+		return ""
+	}
+
+	if redo {
+		_, err = changeJournal.Redo()
+	} else {
+		_, err = changeJournal.Undo()
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return ""
+	}
+
+	if err := indexWorkspace(context.Background(), false); err != nil {
+		fmt.Printf("Warning: Error reindexing workspace files: %v\n", err)
+	}
+
+	if redo {
+		fmt.Printf("Redid #%d.\n", entry.ID)
+		return fmt.Sprintf("[The user reapplied an earlier change: %s]", entry.Description)
+	}
+	fmt.Printf("Undid #%d.\n", entry.ID)
+	return fmt.Sprintf("[The user undid an earlier change, these files are back to their previous state: %s]",
+		entry.Description)
+}
+
+// printHistory lists the journal entries, marking those that were undone
+func printHistory() {
+	if changeJournal == nil {
+		fmt.Println("The undo journal is not available.")
+		return
+	}
+
+	entries, position := changeJournal.History()
+	if len(entries) == 0 {
+		fmt.Println("No changes recorded yet.")
+		return
+	}
+
+	fmt.Println("\nChange history (most recent last):")
+	for i, entry := range entries {
+		status := ""
+		if i >= position {
+			status = " (undone)"
+		}
+		fmt.Printf("  #%d  %s  %s%s\n", entry.ID, entry.Time.Format("2006-01-02 15:04:05"),
+			entry.Description, status)
+	}
+}
@@ -0,0 +1,532 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"caia-ai-cli/pkg/ignore"
+	"caia-ai-cli/pkg/language"
+	"caia-ai-cli/pkg/symbols"
+	"caia-ai-cli/pkg/txn"
+)
+
+// indexCachePath is where the index is persisted between runs
+const indexCachePath = ".caia/index.json"
+
+// indexCacheVersion changes whenever the cached FileInfo fields or the way
+// they are computed change, so stale caches are rebuilt
+const indexCacheVersion = 10
+
+// cacheEntry is the cached index entry for one file. Size and ModTime are
+// checked first; Hash decides whether a file whose metadata changed needs to
+// be read again.
+type cacheEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Hash    string    `json:"hash"`
+	Info    FileInfo  `json:"info"`
+	// Chunks are the retrieval chunks of this version of the file
+	Chunks []chunkSpan `json:"chunks,omitempty"`
+}
+
+type indexCache struct {
+	Version int `json:"version"`
+	// Languages is the fingerprint of the language rules the entries were
+	// detected with
+	Languages string                `json:"languages,omitempty"`
+	Entries   map[string]cacheEntry `json:"entries"`
+}
+
+// workspaceCache holds the entries of the last index, loaded from
+// indexCachePath on the first call to indexWorkspace
+var workspaceCache *indexCache
+
+var (
+	// indexMu serializes indexing between the chat loop and the watcher
+	indexMu sync.Mutex
+	// workspaceMu guards workspaceFiles, which is replaced, never modified
+	workspaceMu sync.RWMutex
+)
+
+// indexedFiles returns the current index. The slice must not be modified.
+func indexedFiles() []FileInfo {
+	workspaceMu.RLock()
+	defer workspaceMu.RUnlock()
+	return workspaceFiles
+}
+
+// indexedDirs returns the indexed directories, including the workspace root
+func indexedDirs() []string {
+	var dirs []string
+	for _, file := range indexedFiles() {
+		if file.IsDir {
+			dirs = append(dirs, file.Path)
+		}
+	}
+	return dirs
+}
+
+// indexTask is a file found by the walk whose entry is computed by a worker
+type indexTask struct {
+	slot int // position in the file list
+	path string
+	info os.FileInfo
+}
+
+// indexWorkspace rebuilds workspaceFiles. Files whose size and modification
+// time match the cache are not read again; the others are read by a bounded
+// pool of workers. When ctx is cancelled the previous index is kept. With
+// showProgress set, a progress line is printed for slow runs.
+func indexWorkspace(ctx context.Context, showProgress bool) error {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+
+	if workspaceCache == nil {
+		workspaceCache = loadIndexCache()
+	}
+
+	var progress *indexProgress
+	if showProgress {
+		progress = startProgress()
+		defer progress.stop()
+	}
+
+	files := []FileInfo{}
+	var tasks []indexTask
+
+	// Honor .gitignore, .caiaignore and git's global excludes
+	ignored := ignore.New(".")
+
+	err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Skip .git and the CLI's own .caia directory
+		if info.IsDir() && (info.Name() == ".git" || info.Name() == ".caia") {
+			return filepath.SkipDir
+		}
+
+		// Leave protected and ignored paths out of the index
+		if path != "." && ((workspaceSandbox != nil && !workspaceSandbox.Allowed(path)) ||
+			ignored.Match(path, info.IsDir())) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Nested ignore files apply to everything below their directory
+		if info.IsDir() && path != "." {
+			ignored.LoadDir(path, path)
+		}
+
+		// Symlinks, devices and pipes are left out; a symlink could point
+		// outside the workspace, and its target is indexed on its own
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		if info.IsDir() {
+			files = append(files, FileInfo{
+				Path:    path,
+				Name:    info.Name(),
+				Size:    info.Size(),
+				ModTime: info.ModTime(),
+				IsDir:   true,
+			})
+			return nil
+		}
+
+		tasks = append(tasks, indexTask{slot: len(files), path: path, info: info})
+		files = append(files, FileInfo{})
+		progress.found()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	entries, changed, err := runIndexTasks(ctx, tasks, progress)
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		files[task.slot] = entries[task.path].Info
+	}
+
+	if len(entries) != len(workspaceCache.Entries) {
+		changed = true
+	}
+	workspaceMu.Lock()
+	workspaceFiles = files
+	workspaceMu.Unlock()
+	workspaceCache.Entries = entries
+	updateRetrieval(entries)
+	if changed {
+		return saveIndexCache(workspaceCache)
+	}
+	return nil
+}
+
+// indexInteractively indexes the workspace with a progress line. Ctrl+C
+// cancels indexing and keeps the previous index.
+func indexInteractively() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := indexWorkspace(ctx, true)
+	if errors.Is(err, context.Canceled) {
+		return errors.New("indexing cancelled, keeping the previous index")
+	}
+	return err
+}
+
+// runIndexTasks computes the entries for tasks on up to indexWorkers
+// goroutines. changed reports whether any entry differs from the cache.
+func runIndexTasks(ctx context.Context, tasks []indexTask, progress *indexProgress) (map[string]cacheEntry, bool, error) {
+	results := make([]cacheEntry, len(tasks))
+	fresh := make([]bool, len(tasks))
+
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < indexWorkers(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				task := tasks[i]
+				results[i], fresh[i] = indexFile(ctx, task.path, task.info, workspaceCache.Entries[task.path])
+				progress.indexed()
+			}
+		}()
+	}
+
+feed:
+	for i := range tasks {
+		select {
+		case queue <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	entries := make(map[string]cacheEntry, len(tasks))
+	changed := false
+	for i, task := range tasks {
+		entries[task.path] = results[i]
+		if fresh[i] {
+			changed = true
+		}
+	}
+	return entries, changed, nil
+}
+
+// indexWorkers is the size of the indexing worker pool
+func indexWorkers() int {
+	n := runtime.NumCPU()
+	if n > 8 {
+		// Indexing is mostly I/O bound; more workers only add contention
+		n = 8
+	}
+	return n
+}
+
+// indexFile returns the index entry for a file, reusing cached when the file
+// is unchanged. fresh reports whether the entry differs from cached.
+func indexFile(ctx context.Context, path string, info os.FileInfo, cached cacheEntry) (cacheEntry, bool) {
+	if cached.Hash != "" && cached.Size == info.Size() && cached.ModTime.Equal(info.ModTime()) {
+		return cached, false
+	}
+
+	entry := cacheEntry{Size: info.Size(), ModTime: info.ModTime()}
+	hash, stats, err := scanFile(path)
+	if err == nil {
+		entry.Hash = hash
+	}
+
+	// Only the metadata changed, e.g. after a touch or checkout
+	if hash != "" && hash == cached.Hash {
+		entry.Info = cached.Info
+		entry.Info.Size = info.Size()
+		entry.Info.ModTime = info.ModTime()
+		entry.Chunks = cached.Chunks
+		return entry, true
+	}
+
+	lang, binary, _ := languages.DetectFile(path)
+	entry.Info = FileInfo{
+		Path:     path,
+		Name:     info.Name(),
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Language: lang,
+		Binary:   binary,
+		SHA256:   hash,
+	}
+	if stats != nil {
+		switch encoding := stats.Encoding(); {
+		case !binary:
+			entry.Info.Lines = stats.Lines()
+			entry.Info.Encoding = encoding
+		case encoding == language.UTF16LE || encoding == language.UTF16BE:
+			// Text, but not one the model is sent
+			entry.Info.Encoding = encoding
+		}
+	}
+	if entry.Info.Language == "Excel" {
+		workbookCtx, cancel := context.WithTimeout(ctx, workbookIndexTimeout)
+		readWorkbookInfo(workbookCtx, path, &entry.Info)
+		cancel()
+	}
+	if isCSVFile(path) && !binary {
+		tableCtx, cancel := context.WithTimeout(ctx, workbookIndexTimeout)
+		readTableInfo(tableCtx, path, &entry.Info)
+		cancel()
+	}
+	if extractor, ok := symbols.For(entry.Info.Language); ok {
+		readOutline(extractor, path, &entry.Info)
+	}
+	entry.Chunks = chunksFor(path, entry)
+	return entry, true
+}
+
+const (
+	// workbookIndexTimeout bounds the time spent opening and counting the
+	// rows of one workbook or CSV file; sheets not counted in time are listed
+	// without a row count and CSV files without their columns
+	workbookIndexTimeout = 10 * time.Second
+	// maxIndexedWorkbookSize is the largest workbook whose sheets are listed
+	maxIndexedWorkbookSize = 64 << 20
+	// workbookUnzipLimit caps the unpacked size of a workbook, so a zip bomb
+	// fails to open instead of filling memory
+	workbookUnzipLimit = 512 << 20
+)
+
+// openedWorkbook is the result of opening a workbook in the background
+type openedWorkbook struct {
+	f      *excelize.File
+	sheets []string
+}
+
+// readWorkbookInfo fills in the sheet names and row counts of an Excel file.
+// Opening the workbook does not take ctx, so it runs in the background and is
+// abandoned when ctx is done first. Rows are streamed rather than loaded, and
+// counting stops when ctx is done.
+func readWorkbookInfo(ctx context.Context, path string, fileInfo *FileInfo) {
+	if fileInfo.Size > maxIndexedWorkbookSize {
+		return
+	}
+
+	opened := make(chan openedWorkbook, 1)
+	go func() {
+		f, err := excelize.OpenFile(path, excelize.Options{UnzipSizeLimit: workbookUnzipLimit})
+		if err != nil {
+			opened <- openedWorkbook{}
+			return
+		}
+		opened <- openedWorkbook{f: f, sheets: f.GetSheetList()}
+	}()
+
+	var wb openedWorkbook
+	select {
+	case wb = <-opened:
+	case <-ctx.Done():
+		// Close the workbook once it has finished opening
+		go func() {
+			if wb := <-opened; wb.f != nil {
+				wb.f.Close()
+			}
+		}()
+		return
+	}
+	if wb.f == nil {
+		return
+	}
+	f := wb.f
+	defer f.Close()
+
+	fileInfo.SheetNames = wb.sheets
+	fileInfo.RowCount = make(map[string]int)
+	for _, sheet := range fileInfo.SheetNames {
+		if ctx.Err() != nil {
+			return
+		}
+		if count, ok := countRows(ctx, f, sheet); ok {
+			fileInfo.RowCount[sheet] = count
+		}
+	}
+}
+
+// countRows counts the rows of a sheet up to the last non-empty one, like
+// len(GetRows) but without keeping the rows in memory
+func countRows(ctx context.Context, f *excelize.File, sheet string) (int, bool) {
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		return 0, false
+	}
+	defer rows.Close()
+
+	n, last := 0, 0
+	for rows.Next() {
+		if n%1000 == 0 && ctx.Err() != nil {
+			return 0, false
+		}
+		n++
+		if cols, err := rows.Columns(); err == nil && len(cols) > 0 {
+			last = n
+		}
+	}
+	return last, rows.Error() == nil
+}
+
+// indexProgress prints how far indexing got while it takes noticeably long
+type indexProgress struct {
+	files   atomic.Int64
+	done    atomic.Int64
+	quit    chan struct{}
+	stopped chan struct{}
+}
+
+// progressDelay is how long indexing runs before progress is shown
+const progressDelay = 500 * time.Millisecond
+
+func startProgress() *indexProgress {
+	p := &indexProgress{quit: make(chan struct{}), stopped: make(chan struct{})}
+	go func() {
+		defer close(p.stopped)
+
+		start := time.Now()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+
+		shown := false
+		for {
+			select {
+			case <-p.quit:
+				if shown {
+					fmt.Print("\r\033[K")
+				}
+				return
+			case <-ticker.C:
+				if time.Since(start) < progressDelay {
+					continue
+				}
+				shown = true
+				fmt.Printf("\r\033[KIndexing workspace: %d/%d files", p.done.Load(), p.files.Load())
+			}
+		}
+	}()
+	return p
+}
+
+// found counts a file discovered by the walk. A nil progress does nothing.
+func (p *indexProgress) found() {
+	if p != nil {
+		p.files.Add(1)
+	}
+}
+
+// indexed counts a file whose entry is ready
+func (p *indexProgress) indexed() {
+	if p != nil {
+		p.done.Add(1)
+	}
+}
+
+// stop clears the progress line
+func (p *indexProgress) stop() {
+	close(p.quit)
+	<-p.stopped
+}
+
+// readOutline fills in the package name and declarations of a source file
+// using the extractor for its language
+func readOutline(extractor symbols.Extractor, path string, fileInfo *FileInfo) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	outline, _ := extractor.Extract(path, src)
+	fileInfo.Package, fileInfo.Symbols = outline.Package, outline.Symbols
+}
+
+// scanFile returns the hex SHA-256 of a file's contents along with its line
+// count and encoding, reading the file once
+func scanFile(path string) (string, *language.Stats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	stats := language.NewStats()
+	if _, err := io.Copy(io.MultiWriter(h, stats), f); err != nil {
+		return "", nil, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), stats, nil
+}
+
+// loadIndexCache reads the persisted index. A missing, unreadable or
+// outdated cache yields an empty one, so everything is indexed again.
+func loadIndexCache() *indexCache {
+	empty := &indexCache{
+		Version:   indexCacheVersion,
+		Languages: languages.Fingerprint(),
+		Entries:   make(map[string]cacheEntry),
+	}
+
+	data, err := os.ReadFile(indexCachePath)
+	if err != nil {
+		return empty
+	}
+	var cache indexCache
+	if err := json.Unmarshal(data, &cache); err != nil || cache.Version != indexCacheVersion ||
+		cache.Languages != languages.Fingerprint() || cache.Entries == nil {
+		return empty
+	}
+	return &cache
+}
+
+// saveIndexCache writes the index atomically so an interrupted run never
+// leaves a truncated cache behind
+func saveIndexCache(cache *indexCache) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(indexCachePath), 0755); err != nil {
+		return err
+	}
+
+	tx := txn.New()
+	tx.WriteFile(indexCachePath, data, 0644)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error saving index cache: %v", err)
+	}
+	return nil
+}
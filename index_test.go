@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestIndexFile(t *testing.T) {
+	const content = "package a\n\nfunc A() {}\n"
+	inTempWorkspace(t, map[string]string{"a.go": content})
+	info, err := os.Stat("a.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := contentHash([]byte(content))
+	marker := FileInfo{Path: "a.go", Language: "marker"}
+
+	tests := []struct {
+		name         string
+		cached       cacheEntry
+		wantFresh    bool
+		wantLanguage string // "marker" when the cached info was reused
+	}{
+		{
+			name:         "same size and modification time",
+			cached:       cacheEntry{Size: info.Size(), ModTime: info.ModTime(), Hash: "not read", Info: marker},
+			wantFresh:    false,
+			wantLanguage: "marker",
+		},
+		{
+			name:         "new modification time, same content",
+			cached:       cacheEntry{Size: info.Size(), ModTime: info.ModTime().Add(-time.Hour), Hash: hash, Info: marker},
+			wantFresh:    true,
+			wantLanguage: "marker",
+		},
+		{
+			name:         "new content",
+			cached:       cacheEntry{Size: 3, ModTime: info.ModTime().Add(-time.Hour), Hash: contentHash([]byte("old")), Info: marker},
+			wantFresh:    true,
+			wantLanguage: "Go",
+		},
+		{
+			name:         "not cached",
+			wantFresh:    true,
+			wantLanguage: "Go",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, fresh := indexFile(context.Background(), "a.go", info, tt.cached)
+			if fresh != tt.wantFresh {
+				t.Errorf("fresh = %v, want %v", fresh, tt.wantFresh)
+			}
+			if entry.Info.Language != tt.wantLanguage {
+				t.Errorf("Language = %q, want %q", entry.Info.Language, tt.wantLanguage)
+			}
+			if !tt.wantFresh {
+				return
+			}
+			if entry.Hash != hash || !entry.ModTime.Equal(info.ModTime()) || !entry.Info.ModTime.Equal(info.ModTime()) {
+				t.Errorf("entry = %+v, want the hash and modification time of the file", entry)
+			}
+			if tt.wantLanguage == "Go" && (entry.Info.Lines != 3 || len(entry.Info.Symbols) != 1) {
+				t.Errorf("Info = %+v, want 3 lines and one symbol", entry.Info)
+			}
+		})
+	}
+}
+
+func TestIndexWorkspaceReusesTheCache(t *testing.T) {
+	inTempWorkspace(t, map[string]string{"a.go": "package a\n", "b.go": "package b\n", "c.go": "package c\n"})
+	cache, files := workspaceCache, workspaceFiles
+	workspaceCache = nil
+	t.Cleanup(func() { workspaceCache, workspaceFiles = cache, files })
+
+	if err := indexWorkspace(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(workspaceCache.Entries); got != 3 {
+		t.Fatalf("cached entries = %d, want 3", got)
+	}
+
+	// Mark the cached entries so a reused entry can be told from a rebuilt one
+	for path, entry := range workspaceCache.Entries {
+		entry.Info.Package = "cached"
+		workspaceCache.Entries[path] = entry
+	}
+	if err := os.WriteFile("b.go", []byte("package bb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove("c.go"); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexWorkspace(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+
+	packages := make(map[string]string)
+	for _, file := range indexedFiles() {
+		if !file.IsDir {
+			packages[file.Path] = file.Package
+		}
+	}
+	if len(packages) != 2 || packages["a.go"] != "cached" || packages["b.go"] != "bb" {
+		t.Errorf("packages = %v, want a.go reused from the cache and b.go read again", packages)
+	}
+
+	// The cache on disk matches the new index
+	data, err := os.ReadFile(indexCachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved indexCache
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := saved.Entries["c.go"]; ok || len(saved.Entries) != 2 || saved.Version != indexCacheVersion {
+		t.Errorf("saved cache has version %d and entries %v, want a.go and b.go", saved.Version, saved.Entries)
+	}
+}
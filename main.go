@@ -3,124 +3,53 @@ package main
 import (
 	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
-	"github.com/xuri/excelize/v2"
 
 	"caia-ai-cli/pkg/config"
+	"caia-ai-cli/pkg/journal"
+	"caia-ai-cli/pkg/language"
+	"caia-ai-cli/pkg/lineedit"
+	"caia-ai-cli/pkg/patch"
+	"caia-ai-cli/pkg/sandbox"
+	"caia-ai-cli/pkg/search"
+	"caia-ai-cli/pkg/symbols"
+	"caia-ai-cli/pkg/txn"
 )
 
 type FileInfo struct {
-	Path       string         `json:"path"`
-	Name       string         `json:"name"`
-	Size       int64          `json:"size"`
-	ModTime    time.Time      `json:"mod_time"`
-	IsDir      bool           `json:"is_dir"`
-	Language   string         `json:"language,omitempty"`
-	SheetNames []string       `json:"sheet_names,omitempty"`
-	RowCount   map[string]int `json:"row_count,omitempty"`
+	Path       string           `json:"path"`
+	Name       string           `json:"name"`
+	Size       int64            `json:"size"`
+	ModTime    time.Time        `json:"mod_time"`
+	IsDir      bool             `json:"is_dir"`
+	Language   string           `json:"language,omitempty"`
+	SheetNames []string         `json:"sheet_names,omitempty"`
+	RowCount   map[string]int   `json:"row_count,omitempty"`
+	Package    string           `json:"package,omitempty"`
+	Symbols    []symbols.Symbol `json:"symbols,omitempty"`
+	Binary     bool             `json:"binary,omitempty"`
+	Lines      int              `json:"lines,omitempty"`
+	Encoding   string           `json:"encoding,omitempty"`
+	SHA256     string           `json:"sha256,omitempty"`
+	Table      *TableInfo       `json:"table,omitempty"`
 }
 
 var workspaceFiles []FileInfo
 
-func getFileLanguage(filename string) string {
-	ext := strings.ToLower(filepath.Ext(filename))
-	switch ext {
-	case ".go":
-		return "Go"
-	case ".js", ".jsx":
-		return "JavaScript"
-	case ".ts", ".tsx":
-		return "TypeScript"
-	case ".py":
-		return "Python"
-	case ".java":
-		return "Java"
-	case ".cpp", ".cc", ".cxx":
-		return "C++"
-	case ".c":
-		return "C"
-	case ".rs":
-		return "Rust"
-	case ".rb":
-		return "Ruby"
-	case ".php":
-		return "PHP"
-	case ".swift":
-		return "Swift"
-	case ".kt":
-		return "Kotlin"
-	case ".cs":
-		return "C#"
-	case ".html":
-		return "HTML"
-	case ".css":
-		return "CSS"
-	case ".md":
-		return "Markdown"
-	case ".json":
-		return "JSON"
-	case ".yaml", ".yml":
-		return "YAML"
-	case ".xlsx", ".xls":
-		return "Excel"
-	default:
-		return ""
-	}
-}
-
-func indexWorkspace() error {
-	workspaceFiles = []FileInfo{} // Reset the index
-	err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Skip .git directory
-		if info.IsDir() && info.Name() == ".git" {
-			return filepath.SkipDir
-		}
-
-		fileInfo := FileInfo{
-			Path:    path,
-			Name:    info.Name(),
-			Size:    info.Size(),
-			ModTime: info.ModTime(),
-			IsDir:   info.IsDir(),
-		}
+// workspaceSandbox confines every file operation to the workspace root
+var workspaceSandbox *sandbox.Sandbox
 
-		if !info.IsDir() {
-			fileInfo.Language = getFileLanguage(info.Name())
-
-			// Handle Excel files
-			if fileInfo.Language == "Excel" {
-				if f, err := excelize.OpenFile(path); err == nil {
-					defer f.Close()
-					fileInfo.SheetNames = f.GetSheetList()
-					fileInfo.RowCount = make(map[string]int)
-
-					for _, sheet := range fileInfo.SheetNames {
-						if rows, err := f.GetRows(sheet); err == nil {
-							fileInfo.RowCount[sheet] = len(rows)
-						}
-					}
-				}
-			}
-		}
-
-		workspaceFiles = append(workspaceFiles, fileInfo)
-		return nil
-	})
-	return err
-}
+// languages detects the language of workspace files. Rules from
+// config.GetLanguageFile are added at startup.
+var languages = language.New(language.Defaults)
 
 const (
 	welcomeMessage = `
@@ -131,6 +60,14 @@ Commands:
   /clear  - Clear conversation history
   /help   - Show this help message
   /index  - Reindex workspace files
+  /undo   - Revert the last applied changeset
+  /redo   - Reapply the last undone changeset
+  /history - List applied changesets
+  /symbols [filter] - List declarations, optionally filtered by name or path
+  /grep [-i] [-F] pattern [glob...] - Search file contents
+
+Mention @path or @path:10-80 in a message to attach a file or a range of its
+lines. Tab completes commands and paths.
 
 You can ask Claude to help you with:
 
@@ -154,7 +91,8 @@ Examples:
 - "Add error handling to main.go"
 - "Show me what's in the budget spreadsheet"
 
-Each operation will ask for your confirmation before making any changes.
+Each operation will ask for your confirmation before making any changes, and every
+applied change can be reverted with /undo, even in a later session.
 Start typing to chat with Claude!
 `
 	systemPrompt = `You are an AI assistant that helps users work with their codebase and Excel files. You have access to information about all files in the current workspace.
@@ -164,69 +102,32 @@ Current workspace files:
 
 IMPORTANT RULES FOR ALL RESPONSES:
 1. Keep responses focused and well-structured
-2. Support multiple operations when requested
-3. Never use triple quotes or special characters in JSON
-4. Always use proper JSON escaping with single backslash (\\n for newlines)
-5. Each operation must be a complete, valid JSON object
-6. DO NOT create bug fixes or improvements to the codebase unless explicitly asked
-7. DO NOT remove any existing code, features or files unless explicitly asked
-8. Carefully review the codebase before making any changes
-9. Try to adhere to the existing code style and structure
-10. Ensure all code is properly formatted and indented, and use proper file extensions
-11. Do not cause any harm to the codebase or the system
-12. Do not create new bugs or issues
-13. If you are unsure about the changes, ask the user for clarification
-14. If you are unsure about the codebase, ask the user for clarification
-15. If you are unsure about the user's request, ask the user for clarification
-
-
-
-For code files (non-Excel):
-{
-    "operation": "create",
-    "filename": "example.py",
-    "content": "def hello():\\n    print('Hello')\\n"
-}
-
-For Excel files:
-{
-    "operation": "create",
-    "filename": "data.xlsx",
-    "actions": [
-        {
-            "type": "create_sheet",
-            "sheet": "Sheet1"
-        },
-        {
-            "type": "add_row",
-            "sheet": "Sheet1",
-            "row": ["Header1", "Header2"]
-        }
-    ]
-}
+2. Use the provided tools (create, edit, patch, read, list, search, delete, move, mkdir) for every file operation; never paste file operations as JSON in your reply
+3. Call several tools in one response when multiple files need to change
+4. DO NOT create bug fixes or improvements to the codebase unless explicitly asked
+5. DO NOT remove any existing code, features or files unless explicitly asked
+6. Carefully review the codebase before making any changes
+7. Try to adhere to the existing code style and structure
+8. Ensure all code is properly formatted and indented, and use proper file extensions
+9. Do not cause any harm to the codebase or the system
+10. Do not create new bugs or issues
+11. If you are unsure about the changes, ask the user for clarification
+12. If you are unsure about the codebase, ask the user for clarification
+13. If you are unsure about the user's request, ask the user for clarification
 
 Guidelines:
-- Each operation must be a separate, complete JSON object
-- Use proper file extensions
+- For code files pass the complete file content to create
+- To change an existing code file prefer patch with small search/replace blocks; use edit only to rewrite a whole file
+- An edit is refused if the file changed after you last read it; read it again and redo the edit
+- For Excel files (.xlsx, .xls) pass a list of actions instead of content
+- For CSV and TSV files use actions to read pages of records or change rows, columns and cells; import_csv and export_csv convert between CSV files and sheets
 - Include necessary imports
 - Add basic comments
 - Keep all content concise
+- The workspace listing may be shortened to fit the context; use the list tool to see the contents of a directory
+- Use the search tool to find where something is defined or used before reading whole files
 
-Example response for multiple files:
-"I'll create two simple files.
-
-{
-    "operation": "create",
-    "filename": "hello.py",
-    "content": "def hello():\\n    print('Hello Python!')\\n"
-}
-{
-    "operation": "create",
-    "filename": "greet.js",
-    "content": "function greet() {\\n    console.log('Hello JavaScript!');\\n}\\n"
-}"
-
-Remember: Each operation must be a complete, valid JSON object with proper escaping.`
+Every operation asks the user for confirmation. The result of each tool call tells you whether it succeeded, failed or was declined.`
 )
 
 type Action struct {
@@ -234,29 +135,54 @@ type Action struct {
 	Filename  string        `json:"filename"`
 	Content   string        `json:"content,omitempty"`
 	Actions   []ExcelAction `json:"actions,omitempty"`
+	Patches   []patch.Block `json:"patches,omitempty"`
+
+	// Destination is the target path for move and rename
+	Destination string `json:"destination,omitempty"`
+	// Recursive allows delete to remove a non-empty directory
+	Recursive bool `json:"recursive,omitempty"`
+
+	// Pattern, Literal, IgnoreCase, Paths and Context describe a search
+	Pattern    string   `json:"pattern,omitempty"`
+	Literal    bool     `json:"literal,omitempty"`
+	IgnoreCase bool     `json:"ignore_case,omitempty"`
+	Paths      []string `json:"paths,omitempty"`
+	Context    *int     `json:"context,omitempty"`
+
+	// partial is set when the user approved only some of the proposed
+	// hunks, so the written content is not what Claude sent
+	partial bool
+	// seen is the hash of the content a read sent to Claude, which may
+	// include changes staged earlier in the changeset
+	seen string
 }
 
-type ExcelAction struct {
-	Type  string   `json:"type"`
-	Sheet string   `json:"sheet"`
-	Cell  string   `json:"cell,omitempty"`
-	Value string   `json:"value,omitempty"`
-	Row   []string `json:"row,omitempty"`
+// isReadOnly reports whether an operation only inspects the workspace
+func isReadOnly(operation string) bool {
+	return operation == "read" || operation == "list" || operation == "search"
 }
 
-func promptForConfirmation(action Action) bool {
-	// Skip confirmation for read operations
-	if action.Operation == "read" {
+// isExcelFile reports whether filename refers to an Excel workbook
+func isExcelFile(filename string) bool {
+	lower := strings.ToLower(filename)
+	return strings.HasSuffix(lower, ".xlsx") || strings.HasSuffix(lower, ".xls")
+}
+
+// promptForConfirmation asks the user to approve the action. For edits of code
+// files the user reviews a diff and action.Content is updated to the approved
+// result.
+func promptForConfirmation(action *Action, tx *txn.Tx) bool {
+	// Skip confirmation for operations that do not change anything
+	if isReadOnly(action.Operation) {
 		return true
 	}
 
 	var prompt string
 	switch action.Operation {
 	case "create":
-		if strings.HasSuffix(strings.ToLower(action.Filename), ".xlsx") ||
-			strings.HasSuffix(strings.ToLower(action.Filename), ".xls") {
-			prompt = fmt.Sprintf("\nDo you want to create Excel file '%s' with %d sheet operations? (y/n): ",
-				action.Filename, len(action.Actions))
+		if isExcelFile(action.Filename) {
+			prompt = fmt.Sprintf("\nDo you want to create Excel file '%s' with %d sheet operations%s? (y/n): ",
+				action.Filename, len(action.Actions), exportTargets(action.Actions))
 		} else {
 			// For code files, show a preview
 			contentPreview := action.Content
@@ -267,227 +193,229 @@ func promptForConfirmation(action Action) bool {
 				action.Filename, contentPreview)
 		}
 	case "edit":
-		if strings.HasSuffix(strings.ToLower(action.Filename), ".xlsx") ||
-			strings.HasSuffix(strings.ToLower(action.Filename), ".xls") {
-			prompt = fmt.Sprintf("\nDo you want to edit Excel file '%s' with %d operations? (y/n): ",
-				action.Filename, len(action.Actions))
+		if isExcelFile(action.Filename) {
+			prompt = fmt.Sprintf("\nDo you want to edit Excel file '%s' with %d operations%s? (y/n): ",
+				action.Filename, len(action.Actions), exportTargets(action.Actions))
 		} else {
-			contentPreview := action.Content
-			if len(contentPreview) > 200 {
-				contentPreview = contentPreview[:200] + "..."
-			}
-			prompt = fmt.Sprintf("\nDo you want to edit '%s' with the following content?\n\nPreview:\n%s\n\n(y/n): ",
-				action.Filename, contentPreview)
+			// Review the edit as a diff; the approved hunks replace the content
+			content, ok := reviewEdit(*action, tx)
+			action.Content = content
+			return ok
 		}
+	case "patch":
+		// Patches are resolved to full content beforehand and reviewed as a diff
+		content, ok := reviewEdit(*action, tx)
+		action.Content = content
+		return ok
+	case "delete":
+		prompt = deletePrompt(*action)
+	case "move", "rename":
+		prompt = movePrompt(*action)
+	case "mkdir":
+		prompt = fmt.Sprintf("\nDo you want to create directory '%s'? (y/n): ", action.Filename)
 	default:
 		prompt = fmt.Sprintf("\nDo you want to perform '%s' operation on '%s'? (y/n): ",
 			action.Operation, action.Filename)
 	}
 
+	return confirm(prompt)
+}
+
+// readResponse prints the prompt and returns the user's trimmed, lowercased answer
+func readResponse(prompt string) (string, error) {
 	fmt.Print(prompt)
 	reader := bufio.NewReader(os.Stdin)
 	response, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(strings.TrimSpace(response)), nil
+}
+
+// confirm asks a yes/no question and reports whether the user answered yes
+func confirm(prompt string) bool {
+	response, err := readResponse(prompt)
 	if err != nil {
 		fmt.Printf("Error reading response: %v\n", err)
 		return false
 	}
-
-	response = strings.ToLower(strings.TrimSpace(response))
 	return response == "y" || response == "yes"
 }
 
-func handleOperation(action Action) error {
+// errOperationCancelled is returned by handleOperation when the user declines an action
+var errOperationCancelled = errors.New("operation cancelled by user")
+
+// handleOperation asks for confirmation and performs the action. Reads run
+// immediately; changes are staged in tx and only reach the workspace when the
+// changeset commits. The returned string describes the result and is sent
+// back to Claude. action is updated with what was staged: the reviewed
+// content and the final path of a move.
+func handleOperation(action *Action, tx *txn.Tx) (string, error) {
+	// Resolve patches against the current file so they can be reviewed as a diff
+	if action.Operation == "patch" {
+		if isExcelFile(action.Filename) {
+			return "", fmt.Errorf("patch is not supported for Excel files; use edit with actions")
+		}
+		current, err := tx.ReadFile(action.Filename)
+		if err != nil {
+			return "", fmt.Errorf("error reading file: %v", err)
+		}
+		if language.IsBinary(current) {
+			return "", fmt.Errorf("%s is a binary file and cannot be patched", action.Filename)
+		}
+		patched, err := patch.Apply(string(current), action.Patches)
+		if err != nil {
+			return "", err
+		}
+		action.Content = patched
+	}
+	// CSV files changed with actions are resolved to their new text, so they
+	// are reviewed and written like any other file
+	if isCSVFile(action.Filename) && len(action.Actions) > 0 &&
+		(action.Operation == "create" || action.Operation == "edit") {
+		content, err := resolveTableActions(*action, tx)
+		if err != nil {
+			return "", err
+		}
+		action.Content = content
+	}
+	proposed := action.Content
+
+	// Record where a move ends up, since a directory destination cannot be
+	// told apart once the move is done
+	if action.Operation == "move" || action.Operation == "rename" {
+		action.Destination = moveTarget(action.Filename, action.Destination)
+	}
+
+	// Binary files are never rewritten as text, and edits must be based on
+	// the content Claude last saw. Actions do not depend on a previous read.
+	if action.Operation == "edit" && !isExcelFile(action.Filename) && len(action.Actions) == 0 {
+		if current, err := tx.ReadFile(action.Filename); err == nil {
+			if language.IsBinary(current) {
+				return "", fmt.Errorf("%s is a binary file and cannot be edited", action.Filename)
+			}
+			if err := checkVersion(action.Filename, current); err != nil {
+				return "", err
+			}
+		}
+	}
+
 	// For read operations, skip the "Operation cancelled" message
-	if !promptForConfirmation(action) {
-		if action.Operation != "read" {
+	if !promptForConfirmation(action, tx) {
+		if !isReadOnly(action.Operation) {
 			fmt.Println("Operation cancelled by user.")
 		}
-		return nil
+		return "", errOperationCancelled
 	}
 
 	switch action.Operation {
 	case "create":
-		if strings.HasSuffix(strings.ToLower(action.Filename), ".xlsx") ||
-			strings.HasSuffix(strings.ToLower(action.Filename), ".xls") {
-			return handleExcelOperation(action)
+		if isExcelFile(action.Filename) {
+			return handleExcelOperation(*action, tx)
 		}
-		// For non-Excel files, create with content
-		dir := filepath.Dir(action.Filename)
-		if dir != "." {
-			if err := os.MkdirAll(dir, 0755); err != nil {
-				return fmt.Errorf("error creating directory: %v", err)
-			}
+		// For non-Excel files, create with content; missing directories are
+		// created when the changeset commits
+		tx.WriteFile(action.Filename, []byte(action.Content), 0644)
+		return fmt.Sprintf("Created %s", action.Filename), nil
+	case "edit", "patch":
+		if isExcelFile(action.Filename) {
+			return handleExcelOperation(*action, tx)
 		}
-		// Replace escaped newlines with actual newlines
-		content := strings.ReplaceAll(action.Content, "\\n", "\n")
-		return os.WriteFile(action.Filename, []byte(content), 0644)
-	case "edit":
-		if strings.HasSuffix(strings.ToLower(action.Filename), ".xlsx") ||
-			strings.HasSuffix(strings.ToLower(action.Filename), ".xls") {
-			return handleExcelOperation(action)
+		tx.WriteFile(action.Filename, []byte(action.Content), filePerm(action.Filename))
+		if action.Content != proposed {
+			action.partial = true
+			return fmt.Sprintf("Updated %s with only part of the proposed changes; the user rejected or "+
+				"modified some hunks. Read the file to see its current content.", action.Filename), nil
 		}
-		// Replace escaped newlines with actual newlines
-		content := strings.ReplaceAll(action.Content, "\\n", "\n")
-		return os.WriteFile(action.Filename, []byte(content), 0644)
+		return fmt.Sprintf("Updated %s", action.Filename), nil
 	case "read":
-		if strings.HasSuffix(strings.ToLower(action.Filename), ".xlsx") ||
-			strings.HasSuffix(strings.ToLower(action.Filename), ".xls") {
-			return handleExcelOperation(action)
+		if isExcelFile(action.Filename) {
+			return handleExcelOperation(*action, tx)
 		}
-		// Read non-Excel files
-		content, err := os.ReadFile(action.Filename)
+		if isCSVFile(action.Filename) && len(action.Actions) > 0 {
+			return readTable(*action, tx)
+		}
+		// Read non-Excel files, including changes staged earlier in this turn
+		content, err := tx.ReadFile(action.Filename)
 		if err != nil {
-			return fmt.Errorf("error reading file: %v", err)
+			return "", fmt.Errorf("error reading file: %v", err)
+		}
+		// Binary contents are never sent to the model
+		if language.IsBinary(content) {
+			return "", fmt.Errorf("%s is a binary file (%d bytes); its contents cannot be read", action.Filename, len(content))
 		}
+		rememberVersion(action.Filename, content)
+		action.seen = contentHash(content)
 		fmt.Printf("\nContents of %s:\n\n%s\n", action.Filename, string(content))
-		return nil
+		return fmt.Sprintf("Contents of %s:\n\n%s", action.Filename, string(content)), nil
+	case "list":
+		return listDirectory(action.Filename)
+	case "search":
+		opts := search.Options{
+			Pattern:    action.Pattern,
+			Literal:    action.Literal,
+			IgnoreCase: action.IgnoreCase,
+			Context:    defaultSearchContext,
+		}
+		if action.Context != nil {
+			opts.Context = *action.Context
+		}
+		return searchWorkspace(opts, action.Paths)
+	case "delete":
+		return deletePath(*action, tx)
+	case "move", "rename":
+		return movePath(*action, tx)
+	case "mkdir":
+		return makeDir(*action, tx)
 	default:
-		return fmt.Errorf("unknown operation: %s", action.Operation)
+		return "", fmt.Errorf("unknown operation: %s", action.Operation)
 	}
 }
 
-func handleExcelOperation(action Action) error {
-	switch action.Operation {
-	case "read":
-		f, err := excelize.OpenFile(action.Filename)
-		if err != nil {
-			return fmt.Errorf("error opening file: %v", err)
-		}
-		defer f.Close()
-
-		for _, a := range action.Actions {
-			if a.Type != "read_sheet" {
-				continue
-			}
-
-			rows, err := f.GetRows(a.Sheet)
-			if err != nil {
-				return fmt.Errorf("error reading sheet %s: %v", a.Sheet, err)
-			}
-
-			fmt.Printf("\nReading sheet '%s' from %s:\n\n", a.Sheet, action.Filename)
-			for i, row := range rows {
-				fmt.Printf("Row %d: %v\n", i+1, row)
-			}
-		}
-		return nil
+// filePerm returns the permissions of an existing file, or 0644 for new files
+func filePerm(filename string) os.FileMode {
+	if info, err := os.Stat(filename); err == nil {
+		return info.Mode().Perm()
+	}
+	return 0644
+}
 
-	case "create":
-		f := excelize.NewFile()
-		defer f.Close()
-
-		for _, a := range action.Actions {
-			switch a.Type {
-			case "create_sheet":
-				if a.Sheet != "Sheet1" { // Sheet1 exists by default
-					_, err := f.NewSheet(a.Sheet)
-					if err != nil {
-						return fmt.Errorf("error creating sheet %s: %v", a.Sheet, err)
-					}
-				}
-			case "set_cell":
-				err := f.SetCellValue(a.Sheet, a.Cell, a.Value)
-				if err != nil {
-					return fmt.Errorf("error setting cell %s in sheet %s: %v", a.Cell, a.Sheet, err)
-				}
-			case "add_row":
-				if len(a.Row) > 0 {
-					// Convert each value in the row to the appropriate type
-					var rowInterface []interface{}
-					for _, val := range a.Row {
-						// Try to convert string numbers to float64
-						if f, err := strconv.ParseFloat(val, 64); err == nil {
-							rowInterface = append(rowInterface, f)
-							continue
-						}
-						// Try to convert string "true"/"false" to bool
-						if b, err := strconv.ParseBool(val); err == nil {
-							rowInterface = append(rowInterface, b)
-							continue
-						}
-						// Keep as string if no conversion possible
-						rowInterface = append(rowInterface, val)
-					}
-
-					rows, err := f.GetRows(a.Sheet)
-					if err != nil {
-						return fmt.Errorf("error getting rows from sheet %s: %v", a.Sheet, err)
-					}
-					err = f.SetSheetRow(a.Sheet, fmt.Sprintf("A%d", len(rows)+1), &rowInterface)
-					if err != nil {
-						return fmt.Errorf("error adding row to sheet %s: %v", a.Sheet, err)
-					}
-				}
-			}
-		}
+// maxResponseTokens is the output limit of each response. Created and
+// edited files are sent as tool input, so it has to fit whole files.
+const maxResponseTokens = 8192
+
+// streamResponse sends the conversation to Claude, printing text as it
+// arrives, and returns the accumulated message. focus is recent user input
+// used to pick the most relevant files for the workspace summary.
+func streamResponse(client *anthropic.Client, messages []anthropic.MessageParam, focus string) (anthropic.Message, error) {
+	// Create streaming request with dynamic system prompt and file tools
+	stream := client.Messages.NewStreaming(context.Background(), anthropic.MessageNewParams{
+		Model:     anthropic.F(anthropic.ModelClaude3_5SonnetLatest),
+		MaxTokens: anthropic.F(int64(maxResponseTokens)),
+		Messages:  anthropic.F(messages),
+		System: anthropic.F([]anthropic.TextBlockParam{
+			anthropic.NewTextBlock(fmt.Sprintf(systemPrompt, buildWorkspaceInfo(focus))),
+		}),
+		Tools: anthropic.F(toolDefinitions()),
+	})
 
-		if err := f.SaveAs(action.Filename); err != nil {
-			return fmt.Errorf("error saving file: %v", err)
-		}
+	// Print assistant's response and accumulate it
+	fmt.Print("\nClaude: ")
+	message := anthropic.Message{}
 
-		fmt.Printf("\nExcel file created: %s\n", action.Filename)
-		return nil
+	for stream.Next() {
+		event := stream.Current()
+		message.Accumulate(event)
 
-	case "edit":
-		f, err := excelize.OpenFile(action.Filename)
-		if err != nil {
-			return fmt.Errorf("error opening file: %v", err)
-		}
-		defer f.Close()
-
-		for _, a := range action.Actions {
-			switch a.Type {
-			case "create_sheet":
-				_, err := f.NewSheet(a.Sheet)
-				if err != nil {
-					return fmt.Errorf("error creating sheet %s: %v", a.Sheet, err)
-				}
-			case "set_cell":
-				err := f.SetCellValue(a.Sheet, a.Cell, a.Value)
-				if err != nil {
-					return fmt.Errorf("error setting cell %s in sheet %s: %v", a.Cell, a.Sheet, err)
-				}
-			case "add_row":
-				if len(a.Row) > 0 {
-					// Convert each value in the row to the appropriate type
-					var rowInterface []interface{}
-					for _, val := range a.Row {
-						// Try to convert string numbers to float64
-						if f, err := strconv.ParseFloat(val, 64); err == nil {
-							rowInterface = append(rowInterface, f)
-							continue
-						}
-						// Try to convert string "true"/"false" to bool
-						if b, err := strconv.ParseBool(val); err == nil {
-							rowInterface = append(rowInterface, b)
-							continue
-						}
-						// Keep as string if no conversion possible
-						rowInterface = append(rowInterface, val)
-					}
-
-					rows, err := f.GetRows(a.Sheet)
-					if err != nil {
-						return fmt.Errorf("error getting rows from sheet %s: %v", a.Sheet, err)
-					}
-					err = f.SetSheetRow(a.Sheet, fmt.Sprintf("A%d", len(rows)+1), &rowInterface)
-					if err != nil {
-						return fmt.Errorf("error adding row to sheet %s: %v", a.Sheet, err)
-					}
-				}
+		switch delta := event.Delta.(type) {
+		case anthropic.ContentBlockDeltaEventDelta:
+			if delta.Text != "" {
+				fmt.Print(delta.Text)
 			}
 		}
-
-		if err := f.Save(); err != nil {
-			return fmt.Errorf("error saving changes: %v", err)
-		}
-
-		fmt.Printf("\nChanges saved to: %s\n", action.Filename)
-		return nil
-
-	default:
-		return fmt.Errorf("unknown operation: %s", action.Operation)
 	}
+
+	return message, stream.Err()
 }
 
 func main() {
@@ -503,44 +431,102 @@ func main() {
 		option.WithAPIKey(apiKey),
 	)
 
+	// Confine file operations to the current directory
+	sb, err := sandbox.New(".", config.GetDenyPatterns(sandbox.DefaultDeny))
+	if err != nil {
+		fmt.Printf("Error setting up workspace sandbox: %v\n", err)
+		os.Exit(1)
+	}
+	workspaceSandbox = sb
+
+	// Open the undo journal
+	if j, err := journal.Open(journal.DefaultDir); err != nil {
+		fmt.Printf("Warning: Undo journal unavailable: %v\n", err)
+	} else {
+		changeJournal = j
+	}
+
+	// Add the workspace's own language rules
+	if registry, err := language.Load(config.GetLanguageFile()); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	} else {
+		languages = registry
+	}
+
 	// Initial workspace indexing
-	if err := indexWorkspace(); err != nil {
+	if err := indexInteractively(); err != nil {
 		fmt.Printf("Warning: Error indexing workspace files: %v\n", err)
 	}
 
+	// Keep the index up to date with changes made outside the CLI
+	if watcher := watchWorkspace(); watcher != nil {
+		defer watcher.Close()
+	}
+
 	// Print welcome message
-	fmt.Println(welcomeMessage)
+	fmt.Print(welcomeMessage)
 
 	// Initialize conversation history
 	messages := []anthropic.MessageParam{}
 
-	// Create a scanner for user input
-	scanner := bufio.NewScanner(os.Stdin)
+	// Tool results and notes waiting to be sent with the next user message
+	var pendingBlocks []anthropic.ContentBlockParamUnion
+	maxSteps := config.GetMaxAgentSteps()
+
+	// Recent user input, used to find conversation-relevant files
+	var recentInputs []string
+
+	// Read input with history and tab completion of commands and @ mentions
+	editor := lineedit.New(completeInput)
 
 	// Main chat loop
 	for {
 		// Print prompt and get user input
-		fmt.Print("\n> ")
-		if !scanner.Scan() {
+		input, err := editor.ReadLine("\n> ")
+		if errors.Is(err, lineedit.ErrInterrupted) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
 			break
 		}
-		input := scanner.Text()
+		if err != nil {
+			fmt.Printf("Error reading input: %v\n", err)
+			os.Exit(1)
+		}
 
 		// Handle commands
 		if strings.HasPrefix(input, "/") {
-			switch input {
+			command, args, _ := strings.Cut(input, " ")
+			switch command {
 			case "/exit":
 				fmt.Println("Goodbye!")
 				return
 			case "/clear":
 				messages = []anthropic.MessageParam{}
+				pendingBlocks = nil
+				recentInputs = nil
+				forgetVersions()
 				fmt.Println("Conversation history cleared.")
 				continue
 			case "/help":
-				fmt.Println(welcomeMessage)
+				fmt.Print(welcomeMessage)
+				continue
+			case "/undo", "/redo":
+				if note := undoChange(command == "/redo"); note != "" {
+					pendingBlocks = append(pendingBlocks, anthropic.NewTextBlock(note))
+				}
+				continue
+			case "/history":
+				printHistory()
+				continue
+			case "/symbols":
+				printSymbols(args)
+				continue
+			case "/grep":
+				grepCommand(args)
 				continue
 			case "/index":
-				if err := indexWorkspace(); err != nil {
+				if err := indexInteractively(); err != nil {
 					fmt.Printf("Error indexing workspace files: %v\n", err)
 				} else {
 					fmt.Println("Workspace files indexed successfully.")
@@ -552,182 +538,82 @@ func main() {
 			}
 		}
 
-		// Add user message to history
-		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(input)))
-
-		// Create workspace information for system prompt
-		var workspaceInfo strings.Builder
-		for _, file := range workspaceFiles {
-			if file.IsDir {
-				workspaceInfo.WriteString(fmt.Sprintf("\n- Directory: %s\n", file.Path))
-			} else {
-				if file.Language == "Excel" {
-					workspaceInfo.WriteString(fmt.Sprintf("\n- Excel file: %s (Modified: %s)\n",
-						file.Path,
-						file.ModTime.Format("2006-01-02 15:04:05")))
-					if len(file.SheetNames) > 0 {
-						workspaceInfo.WriteString("  Sheets:\n")
-						for _, sheet := range file.SheetNames {
-							rows := file.RowCount[sheet]
-							workspaceInfo.WriteString(fmt.Sprintf("    - %s (%d rows)\n", sheet, rows))
-						}
-					}
-				} else {
-					workspaceInfo.WriteString(fmt.Sprintf("\n- File: %s (Type: %s, Modified: %s)\n",
-						file.Path,
-						file.Language,
-						file.ModTime.Format("2006-01-02 15:04:05")))
-				}
-			}
+		// Attach files mentioned as @path or @path:start-end
+		mentionBlocks, ok := attachMentions(input)
+		if !ok {
+			continue
 		}
 
-		// Create streaming request with dynamic system prompt
-		stream := client.Messages.NewStreaming(context.Background(), anthropic.MessageNewParams{
-			Model:     anthropic.F(anthropic.ModelClaude3_5SonnetLatest),
-			MaxTokens: anthropic.F(int64(1024)),
-			Messages:  anthropic.F(messages),
-			System: anthropic.F([]anthropic.TextBlockParam{
-				anthropic.NewTextBlock(fmt.Sprintf(systemPrompt, workspaceInfo.String())),
-			}),
-		})
-
-		// Print assistant's response and accumulate it
-		fmt.Print("\nClaude: ")
-		var fullResponse strings.Builder
-		message := anthropic.Message{}
-
-		for stream.Next() {
-			event := stream.Current()
-			message.Accumulate(event)
-
-			switch delta := event.Delta.(type) {
-			case anthropic.ContentBlockDeltaEventDelta:
-				if delta.Text != "" {
-					fmt.Print(delta.Text)
-					fullResponse.WriteString(delta.Text)
-				}
-			}
+		// Remember recent input to prioritize relevant files in the summary
+		recentInputs = append(recentInputs, input)
+		if len(recentInputs) > recentInputLimit {
+			recentInputs = recentInputs[len(recentInputs)-recentInputLimit:]
 		}
 
-		if err := stream.Err(); err != nil {
-			fmt.Printf("\nError: %v\n", err)
-			continue
-		}
+		// Add user message to history, together with any tool results left
+		// over from a run that hit the step limit
+		carried := pendingBlocks
+		userBlocks := append(carried, anthropic.NewTextBlock(input))
+		userBlocks = append(userBlocks, mentionBlocks...)
+		pendingBlocks = nil
 
-		// Add assistant's response to conversation history
-		messages = append(messages, message.ToParam())
-
-		// Try to parse response as action
-		response := fullResponse.String()
-		if strings.Contains(response, `"operation"`) {
-			// Find all JSON objects in the response
-			var actions []Action
-			var currentPos int
-			responseLen := len(response)
-
-			for currentPos < responseLen {
-				// Find opening brace of JSON object
-				startPos := strings.Index(response[currentPos:], "{")
-				if startPos == -1 {
-					break
-				}
-				startPos += currentPos
-
-				// Find matching closing brace
-				braceCount := 1
-				inQuote := false
-				inEscape := false
-				endPos := startPos + 1
-
-				for endPos < responseLen && braceCount > 0 {
-					char := response[endPos]
-
-					if inEscape {
-						inEscape = false
-					} else {
-						switch char {
-						case '\\':
-							inEscape = true
-						case '"':
-							inQuote = !inQuote
-						case '{':
-							if !inQuote {
-								braceCount++
-							}
-						case '}':
-							if !inQuote {
-								braceCount--
-							}
-						}
-					}
-					endPos++
-				}
+		// Attach the code that best matches the request
+		if snippets := retrieveSnippets(input, config.GetRetrievalTokenBudget()); snippets != "" {
+			userBlocks = append(userBlocks, anthropic.NewTextBlock(snippets))
+		}
+		messages = append(messages, anthropic.NewUserMessage(userBlocks...))
 
-				if braceCount == 0 {
-					// Extract and parse the JSON object
-					jsonStr := response[startPos:endPos]
-					var action Action
-					if err := json.Unmarshal([]byte(jsonStr), &action); err == nil {
-						// Validate the action
-						if action.Operation != "" && action.Filename != "" {
-							if (action.Operation == "create" || action.Operation == "edit") &&
-								(action.Content != "" || len(action.Actions) > 0) {
-								actions = append(actions, action)
-								fmt.Printf("\nFound valid action for file: %s\n", action.Filename)
-							} else if action.Operation == "read" {
-								actions = append(actions, action)
-								fmt.Printf("\nFound valid read action for file: %s\n", action.Filename)
-							}
-						}
-					} else {
-						fmt.Printf("\nError parsing JSON: %v\n", err)
-					}
-					currentPos = endPos
+		// Agent loop: keep sending tool results back to Claude until it stops
+		// requesting operations or the step limit is reached
+		var results []anthropic.ContentBlockParamUnion
+		for step := 1; ; step++ {
+			message, err := streamResponse(client, messages, strings.Join(recentInputs, "\n"))
+			if err != nil {
+				fmt.Printf("\nError: %v\n", err)
+				// Drop the unanswered user message so the history stays valid,
+				// keeping its tool results for the next attempt
+				messages = messages[:len(messages)-1]
+				if step == 1 {
+					pendingBlocks = carried
 				} else {
-					currentPos = startPos + 1
+					pendingBlocks = results
 				}
+				break
 			}
 
-			// Execute all found actions
-			if len(actions) > 0 {
-				fmt.Printf("\nFound %d file operations to execute.\n", len(actions))
-
-				for _, action := range actions {
-					// Print operation summary
-					switch action.Operation {
-					case "create":
-						if strings.HasSuffix(strings.ToLower(action.Filename), ".xlsx") {
-							fmt.Printf("\nPreparing to create Excel file: %s with %d sheet operations\n",
-								action.Filename, len(action.Actions))
-						} else {
-							fmt.Printf("\nPreparing to create file: %s\n", action.Filename)
-						}
-					case "edit":
-						fmt.Printf("\nPreparing to edit file: %s\n", action.Filename)
-					case "read":
-						fmt.Printf("\nPreparing to read file: %s\n", action.Filename)
-					}
-
-					// Handle the operation with confirmation
-					if err := handleOperation(action); err != nil {
-						fmt.Printf("Error performing operation: %v\n", err)
-					} else {
-						fmt.Printf("Successfully handled operation for %s\n", action.Filename)
-					}
-				}
+			// Tool calls cut off at the output limit are never run or kept
+			truncated := dropTruncatedToolCalls(&message)
 
-				// Reindex after operations
-				if err := indexWorkspace(); err != nil {
-					fmt.Printf("Warning: Error reindexing workspace files: %v\n", err)
-				}
+			// Add assistant's response to conversation history
+			if len(message.Content) > 0 {
+				messages = append(messages, message.ToParam())
 			} else {
-				fmt.Printf("\nNo valid file operations found in the response.\n")
+				messages = append(messages, anthropic.NewAssistantMessage(
+					anthropic.NewTextBlock("(response cut off at the output limit)")))
 			}
-		}
-	}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Printf("Error reading input: %v\n", err)
-		os.Exit(1)
+			results = executeToolCalls(message)
+			if len(truncated) > 0 {
+				results = append(results, anthropic.NewTextBlock(fmt.Sprintf(
+					"Your response reached the limit of %d output tokens and the %s call was cut off, so it "+
+						"was not run. Send large files in smaller pieces, for example with patch.",
+					maxResponseTokens, strings.Join(truncated, ", "))))
+			}
+			if len(results) == 0 {
+				break
+			}
+
+			// Reindex after operations
+			if err := indexWorkspace(context.Background(), false); err != nil {
+				fmt.Printf("Warning: Error reindexing workspace files: %v\n", err)
+			}
+
+			if step >= maxSteps {
+				fmt.Printf("\nReached the limit of %d steps; send a message to let Claude continue.\n", maxSteps)
+				pendingBlocks = results
+				break
+			}
+			messages = append(messages, anthropic.NewUserMessage(results...))
+		}
 	}
 }
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"caia-ai-cli/pkg/config"
+	"caia-ai-cli/pkg/language"
+)
+
+// commands are the chat commands offered by tab completion
+var commands = []string{"/exit", "/clear", "/help", "/index", "/undo", "/redo", "/history", "/symbols", "/grep"}
+
+// mentionPattern finds @path and @path:start-end mentions at the start of
+// the input or after whitespace, so e-mail addresses are left alone
+var mentionPattern = regexp.MustCompile(`(?:^|\s)@(\S+)`)
+
+// mentionRange splits a mention into its path and optional line range
+var mentionRange = regexp.MustCompile(`^(.*?)(?::(\d+)(?:-(\d+))?)?$`)
+
+// mention is a file referenced in the input. Start and End are 0 when the
+// whole file is meant.
+type mention struct {
+	path       string
+	start, end int
+}
+
+// parseMentions returns the @ mentions in input, without trailing
+// punctuation, in order of appearance
+func parseMentions(input string) []mention {
+	var mentions []mention
+	for _, m := range mentionPattern.FindAllStringSubmatch(input, -1) {
+		text := strings.TrimRight(m[1], ".,;!?)'\"")
+		parts := mentionRange.FindStringSubmatch(text)
+		if parts == nil || parts[1] == "" {
+			continue
+		}
+		mn := mention{path: parts[1]}
+		if parts[2] != "" {
+			mn.start, _ = strconv.Atoi(parts[2])
+			mn.end = mn.start
+			if parts[3] != "" {
+				mn.end, _ = strconv.Atoi(parts[3])
+			}
+		}
+		mentions = append(mentions, mn)
+	}
+	return mentions
+}
+
+// attachMentions reads the files mentioned in input into content blocks.
+// When they exceed the mention budget the user is asked whether to send them
+// anyway; ok is false if they decline and the message should not be sent.
+func attachMentions(input string) (blocks []anthropic.ContentBlockParamUnion, ok bool) {
+	budget := config.GetMentionTokenBudget()
+	total := 0
+	seen := make(map[mention]bool)
+
+	for _, mn := range parseMentions(input) {
+		text, err := readMention(&mn)
+		if err != nil {
+			// Only warn about words that look like paths or have a line
+			// range, not @handles
+			if strings.ContainsAny(mn.path, "./") || mn.start > 0 {
+				fmt.Printf("Warning: not attaching @%s: %v\n", mn.path, err)
+			}
+			continue
+		}
+		if seen[mn] {
+			continue
+		}
+		seen[mn] = true
+
+		heading := fmt.Sprintf("Contents of %s:", mn.path)
+		if mn.start > 0 {
+			heading = fmt.Sprintf("Contents of %s, lines %d-%d:", mn.path, mn.start, mn.end)
+		}
+		block := fmt.Sprintf("%s\n```\n%s\n```", heading, text)
+		total += estimateTokens(block)
+		blocks = append(blocks, anthropic.NewTextBlock(block))
+		fmt.Printf("Attached %s (~%d tokens)\n", strings.TrimSuffix(heading[len("Contents of "):], ":"), estimateTokens(block))
+	}
+
+	if total > budget {
+		fmt.Printf("Warning: the attached files take about %d tokens, over the budget of %d.\n", total, budget)
+		if !confirm("Send them anyway? (y/n): ") {
+			fmt.Println("Message not sent; narrow the attachments with @path:start-end.")
+			return nil, false
+		}
+	}
+	return blocks, true
+}
+
+// readMention returns the mentioned text, clamping the end of the line range
+// to the file and storing the clamped range back into mn
+func readMention(mn *mention) (string, error) {
+	if mn.end < mn.start {
+		return "", fmt.Errorf("line range %d-%d ends before it starts", mn.start, mn.end)
+	}
+	path, err := workspaceSandbox.Resolve(mn.path)
+	if err != nil {
+		return "", err
+	}
+	mn.path = path
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("no such file")
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("it is a directory")
+	}
+	if isExcelFile(path) {
+		return "", fmt.Errorf("workbooks cannot be attached; ask Claude to read it instead")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if language.IsBinary(data) {
+		return "", fmt.Errorf("it is a binary file")
+	}
+
+	content := strings.TrimSuffix(string(data), "\n")
+	if mn.start == 0 {
+		rememberVersion(path, data)
+		return content, nil
+	}
+
+	lines := strings.Split(content, "\n")
+	if mn.start > len(lines) {
+		return "", fmt.Errorf("it has only %d lines", len(lines))
+	}
+	if mn.end > len(lines) {
+		mn.end = len(lines)
+	}
+	return strings.Join(lines[mn.start-1:mn.end], "\n"), nil
+}
+
+// completeInput completes chat commands at the start of the line and @
+// mentions of indexed paths, one directory level at a time
+func completeInput(line, word string) []string {
+	if strings.HasPrefix(word, "/") && line == word {
+		var matches []string
+		for _, c := range commands {
+			if strings.HasPrefix(c, word) {
+				matches = append(matches, c)
+			}
+		}
+		return matches
+	}
+
+	if !strings.HasPrefix(word, "@") {
+		return nil
+	}
+	prefix := word[1:]
+
+	unique := make(map[string]bool)
+	for _, file := range indexedFiles() {
+		path := file.Path
+		if file.IsDir {
+			if path == "." {
+				continue
+			}
+			path += string(os.PathSeparator)
+		}
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		// Stop at the next directory below the typed prefix
+		if i := strings.IndexRune(path[len(prefix):], os.PathSeparator); i >= 0 {
+			path = path[:len(prefix)+i+1]
+		}
+		unique["@"+path] = true
+	}
+
+	matches := make([]string, 0, len(unique))
+	for m := range unique {
+		matches = append(matches, m)
+	}
+	sort.Strings(matches)
+	return matches
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"caia-ai-cli/pkg/sandbox"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []mention
+	}{
+		{"look at @main.go", []mention{{path: "main.go"}}},
+		{"@pkg/a.go:12 is wrong", []mention{{path: "pkg/a.go", start: 12, end: 12}}},
+		{"see @a.go:10-20 and @b.go", []mention{{path: "a.go", start: 10, end: 20}, {path: "b.go"}}},
+		{"reversed @a.go:80-10", []mention{{path: "a.go", start: 80, end: 10}}},
+		{"what about @main.go?", []mention{{path: "main.go"}}},
+		{"in @a.go:3-4, and (@b.go).", []mention{{path: "a.go", start: 3, end: 4}}},
+		{"(see @b.go)", []mention{{path: "b.go"}}},
+		{`"@c.go"`, nil},
+		{"closing quote after @c.go'", []mention{{path: "c.go"}}},
+		{"mail me@example.com", nil},
+		{"a lone @ sign", nil},
+		{"@ :10", nil},
+	}
+
+	for _, tt := range tests {
+		if got := parseMentions(tt.input); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseMentions(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestReadMention(t *testing.T) {
+	inTempWorkspace(t, map[string]string{"a.go": "one\ntwo\nthree\n", "dir/": ""})
+	s, err := sandbox.New(".", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := workspaceSandbox
+	workspaceSandbox = s
+	t.Cleanup(func() { workspaceSandbox = previous })
+	t.Cleanup(forgetVersions)
+
+	tests := []struct {
+		name    string
+		mention mention
+		want    string
+		wantEnd int
+		err     string // substring of the error, if one is expected
+	}{
+		{name: "whole file", mention: mention{path: "a.go"}, want: "one\ntwo\nthree"},
+		{name: "one line", mention: mention{path: "a.go", start: 2, end: 2}, want: "two", wantEnd: 2},
+		{name: "range", mention: mention{path: "a.go", start: 1, end: 2}, want: "one\ntwo", wantEnd: 2},
+		{name: "end past the file", mention: mention{path: "a.go", start: 2, end: 80}, want: "two\nthree", wantEnd: 3},
+		{name: "end before start", mention: mention{path: "a.go", start: 3, end: 1}, err: "ends before it starts"},
+		{name: "start past the file", mention: mention{path: "a.go", start: 9, end: 9}, err: "only 3 lines"},
+		{name: "missing file", mention: mention{path: "b.go"}, err: "no such file"},
+		{name: "directory", mention: mention{path: "dir"}, err: "directory"},
+		{name: "outside the workspace", mention: mention{path: "../a.go"}, err: "outside the workspace"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mn := tt.mention
+			got, err := readMention(&mn)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("readMention() = %q, %v, want an error containing %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readMention() error = %v", err)
+			}
+			if got != tt.want || mn.end != tt.wantEnd {
+				t.Errorf("readMention() = %q with end %d, want %q with end %d", got, mn.end, tt.want, tt.wantEnd)
+			}
+		})
+	}
+}
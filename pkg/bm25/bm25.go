@@ -0,0 +1,170 @@
+package bm25
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Okapi BM25 parameters
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// stopWords are too common in prose and code to help ranking
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "can": true, "do": true, "for": true, "from": true,
+	"how": true, "i": true, "in": true, "is": true, "it": true, "me": true,
+	"my": true, "of": true, "on": true, "or": true, "please": true, "so": true,
+	"that": true, "the": true, "this": true, "to": true, "we": true, "what": true,
+	"when": true, "where": true, "which": true, "why": true, "with": true,
+	"you": true,
+}
+
+// Document holds the term frequencies of one piece of text
+type Document struct {
+	Terms  map[string]int `json:"terms"`
+	Length int            `json:"length"`
+}
+
+// NewDocument tokenizes text into a document
+func NewDocument(text string) Document {
+	doc := Document{Terms: make(map[string]int)}
+	for _, term := range Tokenize(text) {
+		doc.Terms[term]++
+		doc.Length++
+	}
+	return doc
+}
+
+// Tokenize splits text into lower-case terms. Identifiers are kept whole and
+// also split at camelCase and snake_case boundaries, so parseConfig matches
+// both parseconfig and config.
+func Tokenize(text string) []string {
+	var terms []string
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	for _, word := range words {
+		parts := splitIdentifier(word)
+		if len(parts) > 1 {
+			terms = appendTerm(terms, strings.ToLower(strings.Trim(word, "_")))
+		}
+		for _, part := range parts {
+			terms = appendTerm(terms, strings.ToLower(part))
+		}
+	}
+	return terms
+}
+
+func appendTerm(terms []string, term string) []string {
+	if len(term) < 2 || stopWords[term] {
+		return terms
+	}
+	return append(terms, term)
+}
+
+// splitIdentifier splits at underscores and lower-to-upper case changes,
+// keeping acronyms together: HTTPServer becomes HTTP and Server
+func splitIdentifier(word string) []string {
+	var parts []string
+	for _, piece := range strings.Split(word, "_") {
+		runes := []rune(piece)
+		start := 0
+		for i := 1; i < len(runes); i++ {
+			lowerToUpper := unicode.IsLower(runes[i-1]) && unicode.IsUpper(runes[i])
+			acronymEnd := i+1 < len(runes) && unicode.IsUpper(runes[i-1]) &&
+				unicode.IsUpper(runes[i]) && unicode.IsLower(runes[i+1])
+			if lowerToUpper || acronymEnd {
+				parts = append(parts, string(runes[start:i]))
+				start = i
+			}
+		}
+		if start < len(runes) {
+			parts = append(parts, string(runes[start:]))
+		}
+	}
+	return parts
+}
+
+// posting is one document containing a term
+type posting struct {
+	doc  int
+	freq int
+}
+
+// Index ranks documents against queries with BM25
+type Index struct {
+	postings map[string][]posting
+	lengths  []int
+	avgLen   float64
+}
+
+// Build indexes docs; results refer to documents by their position
+func Build(docs []Document) *Index {
+	ix := &Index{postings: make(map[string][]posting), lengths: make([]int, len(docs))}
+	total := 0
+	for i, doc := range docs {
+		for term, freq := range doc.Terms {
+			ix.postings[term] = append(ix.postings[term], posting{doc: i, freq: freq})
+		}
+		ix.lengths[i] = doc.Length
+		total += doc.Length
+	}
+	if len(docs) > 0 {
+		ix.avgLen = float64(total) / float64(len(docs))
+	}
+	return ix
+}
+
+// Len returns the number of indexed documents
+func (ix *Index) Len() int {
+	return len(ix.lengths)
+}
+
+// Result is a ranked document
+type Result struct {
+	Doc   int
+	Score float64
+}
+
+// Search returns the documents matching query, best first
+func (ix *Index) Search(query string) []Result {
+	n := float64(len(ix.lengths))
+	scores := make(map[int]float64)
+
+	seen := make(map[string]bool)
+	for _, term := range Tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		postings := ix.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for _, p := range postings {
+			tf := float64(p.freq)
+			norm := 1 - b + b*float64(ix.lengths[p.doc])/ix.avgLen
+			scores[p.doc] += idf * tf * (k1 + 1) / (tf + k1*norm)
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for doc, score := range scores {
+		results = append(results, Result{Doc: doc, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Doc < results[j].Doc
+	})
+	return results
+}
@@ -0,0 +1,77 @@
+package bm25
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"parseConfig", []string{"parseconfig", "parse", "config"}},
+		{"read_file_lines", []string{"read_file_lines", "read", "file", "lines"}},
+		{"HTTPServer", []string{"httpserver", "http", "server"}},
+		{"_private", []string{"private"}},
+		{"how do I open the file?", []string{"open", "file"}},
+		{"x = y + 1", nil},
+		{"größe Größe", []string{"größe", "größe"}},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	docs := []Document{
+		NewDocument("func parseConfig(path string) (Config, error)"),
+		NewDocument("config loaded from environment variables and files"),
+		NewDocument("func writeFile(path string, data []byte) error"),
+		NewDocument("config value"),
+		NewDocument("unrelated text about rendering"),
+	}
+	ix := Build(docs)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []int // documents in rank order
+	}{
+		{name: "no match", query: "database"},
+		{name: "only stop words", query: "what is the"},
+		{name: "rare term ranks its document first", query: "parse config", want: []int{0, 3, 1}},
+		{name: "shorter document wins at equal frequency", query: "config value environment", want: []int{3, 1, 0}},
+		{name: "frequency and length both count", query: "config", want: []int{3, 0, 1}},
+		{name: "identifier parts match", query: "write file", want: []int{2}},
+		{name: "repeated query terms count once", query: "rendering rendering", want: []int{4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, r := range ix.Search(tt.query) {
+				if r.Score <= 0 {
+					t.Errorf("result %d has score %g", r.Doc, r.Score)
+				}
+				got = append(got, r.Doc)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search(%q) ranked %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchTiesKeepDocumentOrder(t *testing.T) {
+	ix := Build([]Document{NewDocument("other"), NewDocument("cache"), NewDocument("cache")})
+	results := ix.Search("cache")
+	if len(results) != 2 || results[0].Doc != 1 || results[1].Doc != 2 || results[0].Score != results[1].Score {
+		t.Errorf("Search() = %+v, want documents 1 and 2 with equal scores", results)
+	}
+	if empty := Build(nil); empty.Len() != 0 || len(empty.Search("cache")) != 0 {
+		t.Error("an empty index returned results")
+	}
+}
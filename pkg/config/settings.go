@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultMaxAgentSteps is the number of model turns allowed per user message
+	DefaultMaxAgentSteps = 10
+	// DefaultWorkspaceTokens is the token budget for the workspace summary
+	DefaultWorkspaceTokens = 4000
+	// DefaultRetrievalTokens is the token budget for code attached to a message
+	DefaultRetrievalTokens = 2000
+	// DefaultMentionTokens is the size of @ mentioned files sent without asking
+	DefaultMentionTokens = 8000
+)
+
+// getEnvInt reads a positive integer from the environment, falling back to def
+// when the variable is unset or invalid
+func getEnvInt(key string, def int) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
+}
+
+// GetMaxAgentSteps returns how many model turns the agent loop may take for a
+// single user message, configured with CAIA_MAX_STEPS
+func GetMaxAgentSteps() int {
+	return getEnvInt("CAIA_MAX_STEPS", DefaultMaxAgentSteps)
+}
+
+// GetWorkspaceTokenBudget returns the approximate number of tokens the
+// workspace summary in the system prompt may use, configured with
+// CAIA_WORKSPACE_TOKENS
+func GetWorkspaceTokenBudget() int {
+	return getEnvInt("CAIA_WORKSPACE_TOKENS", DefaultWorkspaceTokens)
+}
+
+// GetRetrievalTokenBudget returns the approximate number of tokens of
+// matching code attached to each message, configured with
+// CAIA_RETRIEVAL_TOKENS. Setting it to 0 turns retrieval off.
+func GetRetrievalTokenBudget() int {
+	if strings.TrimSpace(os.Getenv("CAIA_RETRIEVAL_TOKENS")) == "0" {
+		return 0
+	}
+	return getEnvInt("CAIA_RETRIEVAL_TOKENS", DefaultRetrievalTokens)
+}
+
+// GetMentionTokenBudget returns the approximate number of tokens of files
+// attached with @ mentions that may be sent without confirmation,
+// configured with CAIA_MENTION_TOKENS
+func GetMentionTokenBudget() int {
+	return getEnvInt("CAIA_MENTION_TOKENS", DefaultMentionTokens)
+}
+
+// GetLanguageFile returns the JSON file with extra language detection
+// rules, configured with CAIA_LANGUAGES and .caia/languages.json by default
+func GetLanguageFile() string {
+	if path := strings.TrimSpace(os.Getenv("CAIA_LANGUAGES")); path != "" {
+		return path
+	}
+	return ".caia/languages.json"
+}
+
+// GetWatchMode returns how the workspace is watched for changes, configured
+// with CAIA_WATCH: "auto" (native notifications, polling as a fallback),
+// "poll" or "off"
+func GetWatchMode() string {
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("CAIA_WATCH"))); mode {
+	case "poll", "off":
+		return mode
+	default:
+		return "auto"
+	}
+}
+
+// GetDenyPatterns returns the protected path patterns. CAIA_DENY_PATHS holds a
+// comma-separated list of extra patterns; prefixing a pattern with ! removes
+// it from the defaults instead.
+func GetDenyPatterns(defaults []string) []string {
+	patterns := append([]string{}, defaults...)
+
+	for _, item := range strings.Split(os.Getenv("CAIA_DENY_PATHS"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if strings.HasPrefix(item, "!") {
+			removed := strings.TrimPrefix(item, "!")
+			kept := patterns[:0]
+			for _, p := range patterns {
+				if p != removed {
+					kept = append(kept, p)
+				}
+			}
+			patterns = kept
+			continue
+		}
+		patterns = append(patterns, item)
+	}
+	return patterns
+}
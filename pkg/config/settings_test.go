@@ -0,0 +1,21 @@
+package config
+
+import "testing"
+
+func TestGetLanguageFile(t *testing.T) {
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{env: "", want: ".caia/languages.json"},
+		{env: "  ", want: ".caia/languages.json"},
+		{env: "rules/languages.json", want: "rules/languages.json"},
+		{env: " /etc/caia.json ", want: "/etc/caia.json"},
+	}
+	for _, tt := range tests {
+		t.Setenv("CAIA_LANGUAGES", tt.env)
+		if got := GetLanguageFile(); got != tt.want {
+			t.Errorf("GetLanguageFile() with CAIA_LANGUAGES=%q = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
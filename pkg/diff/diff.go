@@ -0,0 +1,416 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kind identifies how a line differs between the old and new text
+type Kind int
+
+const (
+	Equal Kind = iota
+	Delete
+	Insert
+)
+
+// Line is a single line of a hunk. Text keeps its trailing newline, if any.
+type Line struct {
+	Kind Kind
+	Text string
+}
+
+// Hunk is a group of nearby changes with surrounding context lines
+type Hunk struct {
+	OldStart int // 1-based line number in the old text
+	OldLines int
+	NewStart int // 1-based line number in the new text
+	NewLines int
+	Lines    []Line
+}
+
+// SplitLines splits text into lines, keeping each line's trailing newline
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// editScript returns the line operations that turn a into b using the
+// linear-space variant of Myers' O(ND) algorithm, so large rewrites do not
+// keep a copy of the search state for every edit
+func editScript(a, b []string) []Line {
+	size := 2*((len(a)+len(b)+1)/2) + 3
+	s := &scripter{forward: make([]int, size), backward: make([]int, size)}
+	s.compare(a, b)
+
+	// The halves around each snake can leave insertions before deletions;
+	// list the deletions of every run of changes first, as unified diffs do
+	for i := 0; i < len(s.script); {
+		j := i
+		for j < len(s.script) && s.script[j].Kind != Equal {
+			j++
+		}
+		run := s.script[i:j]
+		sort.SliceStable(run, func(p, q int) bool { return run[p].Kind < run[q].Kind })
+		i = max(j, i+1)
+	}
+	return s.script
+}
+
+// scripter builds an edit script, reusing the Myers search arrays across
+// the recursive calls
+type scripter struct {
+	forward, backward []int
+	script            []Line
+}
+
+func (s *scripter) emit(kind Kind, lines []string) {
+	for _, text := range lines {
+		s.script = append(s.script, Line{Kind: kind, Text: text})
+	}
+}
+
+// compare appends the script for a and b, splitting them at the middle snake
+// of an optimal path until one side is empty
+func (s *scripter) compare(a, b []string) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	s.emit(Equal, a[:prefix])
+	a, b = a[prefix:], b[prefix:]
+
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	switch {
+	case len(a) == 0:
+		s.emit(Insert, b)
+	case len(b) == 0:
+		s.emit(Delete, a)
+	default:
+		// Without a common prefix or suffix at least two edits are needed, so
+		// both halves around the snake are smaller than a and b
+		x, y, u, v := s.middleSnake(a, b)
+		s.compare(a[:x], b[:y])
+		s.emit(Equal, a[x:u])
+		s.compare(a[u:], b[v:])
+	}
+	s.emit(Equal, common)
+}
+
+// middleSnake searches forward from the start and backward from the end of
+// a and b at the same time and returns the snake, from (x, y) to (u, v),
+// where the two searches meet on an optimal path
+func (s *scripter) middleSnake(a, b []string) (x, y, u, v int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	offset := len(s.forward) / 2 // index of diagonal 0
+	vf, vb := s.forward, s.backward
+	vf[offset+1] = 0
+	vb[offset+1] = n + 1 // backward diagonals are relative to delta
+
+	for d := 0; d <= (n+m+1)/2; d++ {
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && vf[offset+k-1] < vf[offset+k+1]) {
+				x = vf[offset+k+1]
+			} else {
+				x = vf[offset+k-1] + 1
+			}
+			y = x - k
+			u, v = x, y
+			for u < n && v < m && a[u] == b[v] {
+				u++
+				v++
+			}
+			vf[offset+k] = u
+			if r := k - delta; odd && r >= -(d-1) && r <= d-1 && vb[offset+r] <= u {
+				return x, y, u, v
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && vb[offset+k+1]-1 < vb[offset+k-1]) {
+				u = vb[offset+k+1] - 1
+			} else {
+				u = vb[offset+k-1]
+			}
+			v = u - k - delta
+			x, y = u, v
+			for x > 0 && y > 0 && a[x-1] == b[y-1] {
+				x--
+				y--
+			}
+			vb[offset+k] = x
+			if f := k + delta; !odd && f >= -d && f <= d && vf[offset+f] >= x {
+				return x, y, u, v
+			}
+		}
+	}
+	// Not reached: the searches always meet within (n+m+1)/2 steps
+	return 0, 0, 0, 0
+}
+
+// Compute returns the hunks that turn oldText into newText, each with up to
+// context unchanged lines around its changes
+func Compute(oldText, newText string, context int) []Hunk {
+	script := editScript(SplitLines(oldText), SplitLines(newText))
+
+	var hunks []Hunk
+	var current *Hunk
+	oldLine, newLine := 1, 1
+	trailing := 0 // unchanged lines seen since the last change
+
+	for i, line := range script {
+		if line.Kind == Equal {
+			if current != nil {
+				// Close the hunk once the unchanged run can no longer be shared
+				// with a following change
+				if trailing >= context && !changeWithin(script[i:], context) {
+					hunks = append(hunks, *current)
+					current = nil
+				} else {
+					current.Lines = append(current.Lines, line)
+					current.OldLines++
+					current.NewLines++
+					trailing++
+				}
+			}
+			oldLine++
+			newLine++
+			continue
+		}
+
+		if current == nil {
+			// Start a new hunk with leading context
+			start := i
+			for start > 0 && i-start < context && script[start-1].Kind == Equal {
+				start--
+			}
+			lead := i - start
+			current = &Hunk{OldStart: oldLine - lead, NewStart: newLine - lead}
+			for _, c := range script[start:i] {
+				current.Lines = append(current.Lines, c)
+				current.OldLines++
+				current.NewLines++
+			}
+		}
+		trailing = 0
+
+		current.Lines = append(current.Lines, line)
+		if line.Kind == Delete {
+			current.OldLines++
+			oldLine++
+		} else {
+			current.NewLines++
+			newLine++
+		}
+	}
+	if current != nil {
+		hunks = append(hunks, *current)
+	}
+
+	return hunks
+}
+
+// changeWithin reports whether a change occurs within the next context
+// lines, meaning the context of two hunks would overlap and they should merge
+func changeWithin(script []Line, context int) bool {
+	for i := 0; i < len(script) && i <= context; i++ {
+		if script[i].Kind != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// Header returns the @@ line describing the hunk's position
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 0 {
+		// An empty range refers to the line before the insertion point
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if lines == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+const (
+	colorReset = "\033[0m"
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorCyan  = "\033[36m"
+)
+
+// Format renders the hunk in unified diff format, optionally with ANSI colors
+func (h Hunk) Format(color bool) string {
+	var b strings.Builder
+	if color {
+		b.WriteString(colorCyan + h.Header() + colorReset + "\n")
+	} else {
+		b.WriteString(h.Header() + "\n")
+	}
+
+	for _, line := range h.Lines {
+		prefix, col := " ", ""
+		switch line.Kind {
+		case Delete:
+			prefix, col = "-", colorRed
+		case Insert:
+			prefix, col = "+", colorGreen
+		}
+
+		text := strings.TrimSuffix(line.Text, "\n")
+		if color && col != "" {
+			b.WriteString(col + prefix + text + colorReset + "\n")
+		} else {
+			b.WriteString(prefix + text + "\n")
+		}
+		if !strings.HasSuffix(line.Text, "\n") {
+			b.WriteString("\\ No newline at end of file\n")
+		}
+	}
+	return b.String()
+}
+
+// Unified renders a complete unified diff with file headers
+func Unified(oldName, newName string, hunks []Hunk, color bool) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", oldName, newName))
+	for _, h := range hunks {
+		b.WriteString(h.Format(color))
+	}
+	return b.String()
+}
+
+// Apply applies the given hunks, which must be ordered and non-overlapping,
+// to oldText. Every context and deleted line must match oldText exactly.
+func Apply(oldText string, hunks []Hunk) (string, error) {
+	old := SplitLines(oldText)
+	var b strings.Builder
+	pos := 0 // index of the next unconsumed old line
+
+	for _, h := range hunks {
+		start := h.OldStart - 1
+		if start < pos || start > len(old) {
+			return "", fmt.Errorf("hunk %s is out of order or out of range", h.Header())
+		}
+
+		for _, line := range old[pos:start] {
+			b.WriteString(line)
+		}
+		pos = start
+
+		for _, line := range h.Lines {
+			switch line.Kind {
+			case Equal, Delete:
+				if pos >= len(old) || !sameLine(old[pos], line.Text) {
+					return "", fmt.Errorf("hunk %s does not match line %d", h.Header(), pos+1)
+				}
+				if line.Kind == Equal {
+					b.WriteString(old[pos])
+				}
+				pos++
+			case Insert:
+				b.WriteString(line.Text)
+			}
+		}
+	}
+
+	for _, line := range old[pos:] {
+		b.WriteString(line)
+	}
+	return b.String(), nil
+}
+
+// sameLine compares two lines ignoring a missing trailing newline, which an
+// edited hunk cannot express reliably
+func sameLine(a, b string) bool {
+	return strings.TrimSuffix(a, "\n") == strings.TrimSuffix(b, "\n")
+}
+
+// ParseHunk parses the body of a single hunk as written by Format, without
+// colors. The @@ header line is optional; positions are taken from orig.
+func ParseHunk(text string, orig Hunk) (Hunk, error) {
+	h := Hunk{OldStart: orig.OldStart, NewStart: orig.NewStart}
+
+	for i, raw := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if strings.HasPrefix(raw, "@@") || strings.HasPrefix(raw, "#") || strings.HasPrefix(raw, "\\") {
+			continue
+		}
+		if raw == "" {
+			// Editors often strip the space from empty context lines
+			raw = " "
+		}
+
+		line := Line{Text: raw[1:] + "\n"}
+		switch raw[0] {
+		case ' ':
+			line.Kind = Equal
+			h.OldLines++
+			h.NewLines++
+		case '-':
+			line.Kind = Delete
+			h.OldLines++
+		case '+':
+			line.Kind = Insert
+			h.NewLines++
+		default:
+			return Hunk{}, fmt.Errorf("line %d must start with ' ', '-' or '+'", i+1)
+		}
+		h.Lines = append(h.Lines, line)
+	}
+
+	// The old side must be unchanged so the hunk still applies
+	var want, got []string
+	for _, l := range orig.Lines {
+		if l.Kind != Insert {
+			want = append(want, strings.TrimSuffix(l.Text, "\n"))
+		}
+	}
+	for _, l := range h.Lines {
+		if l.Kind != Insert {
+			got = append(got, strings.TrimSuffix(l.Text, "\n"))
+		}
+	}
+	if strings.Join(want, "\n") != strings.Join(got, "\n") || len(want) != len(got) {
+		return Hunk{}, fmt.Errorf("edited hunk changes context or removed lines; only '+' lines may be edited")
+	}
+
+	// Keep the original line endings for lines taken from the old text
+	oldIdx := 0
+	var oldLines []string
+	for _, l := range orig.Lines {
+		if l.Kind != Insert {
+			oldLines = append(oldLines, l.Text)
+		}
+	}
+	for i := range h.Lines {
+		if h.Lines[i].Kind != Insert {
+			h.Lines[i].Text = oldLines[oldIdx]
+			oldIdx++
+		}
+	}
+
+	return h, nil
+}
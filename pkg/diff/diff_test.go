@@ -0,0 +1,173 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// numbered returns n lines l1 to ln, with the lines in changed replaced
+func numbered(n int, changed map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		if text, ok := changed[i]; ok {
+			b.WriteString(text + "\n")
+			continue
+		}
+		fmt.Fprintf(&b, "l%d\n", i)
+	}
+	return b.String()
+}
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		context  int
+		want     string
+	}{
+		{name: "both empty", want: ""},
+		{name: "identical", old: "a\nb\n", new: "a\nb\n", context: 3, want: ""},
+		{
+			name:    "only inserts",
+			new:     "a\nb\n",
+			context: 3,
+			want:    "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:    "only deletes",
+			old:     "a\nb\n",
+			context: 3,
+			want:    "@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name:    "insert in the middle",
+			old:     "a\nc\n",
+			new:     "a\nb\nc\n",
+			context: 1,
+			want:    "@@ -1,2 +1,3 @@\n a\n+b\n c\n",
+		},
+		{
+			name:    "deletions come before insertions",
+			old:     "x\na\nb\ny\n",
+			new:     "x\nc\nd\ny\n",
+			context: 3,
+			want:    "@@ -1,4 +1,4 @@\n x\n-a\n-b\n+c\n+d\n y\n",
+		},
+		{
+			name:    "deletions come before insertions without context",
+			old:     "a,b\n1,2\n",
+			new:     "a,b\n3,4\n",
+			context: 0,
+			want:    "@@ -2 +2 @@\n-1,2\n+3,4\n",
+		},
+		{
+			name:    "changes with overlapping context share a hunk",
+			old:     numbered(10, nil),
+			new:     numbered(10, map[int]string{3: "x", 7: "y"}),
+			context: 2,
+			want:    "@@ -1,9 +1,9 @@\n l1\n l2\n-l3\n+x\n l4\n l5\n l6\n-l7\n+y\n l8\n l9\n",
+		},
+		{
+			name:    "distant changes get their own hunks",
+			old:     numbered(10, nil),
+			new:     numbered(10, map[int]string{2: "x", 9: "y"}),
+			context: 2,
+			want: "@@ -1,4 +1,4 @@\n l1\n-l2\n+x\n l3\n l4\n" +
+				"@@ -7,4 +7,4 @@\n l7\n l8\n-l9\n+y\n l10\n",
+		},
+		{
+			name:    "missing newline at the end",
+			old:     "a\nb",
+			new:     "a\nc",
+			context: 1,
+			want:    "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hunks := Compute(tt.old, tt.new, tt.context)
+			var got strings.Builder
+			for _, h := range hunks {
+				got.WriteString(h.Format(false))
+			}
+			if got.String() != tt.want {
+				t.Errorf("Compute() =\n%s\nwant\n%s", got.String(), tt.want)
+			}
+			applied, err := Apply(tt.old, hunks)
+			if err != nil || applied != tt.new {
+				t.Errorf("Apply() = %q, %v, want %q", applied, err, tt.new)
+			}
+		})
+	}
+}
+
+// lcs returns the length of the longest common subsequence of a and b
+func lcs(a, b []string) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func TestComputeIsMinimal(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	text := func() string {
+		var b strings.Builder
+		for i := r.Intn(40); i > 0; i-- {
+			b.WriteByte(byte('a' + r.Intn(4)))
+			b.WriteByte('\n')
+		}
+		return b.String()
+	}
+
+	for i := 0; i < 2000; i++ {
+		old, new := text(), text()
+		hunks := Compute(old, new, r.Intn(4))
+
+		changes := 0
+		for _, h := range hunks {
+			for j, line := range h.Lines {
+				if line.Kind != Equal {
+					changes++
+				}
+				if j > 0 && h.Lines[j-1].Kind == Insert && line.Kind == Delete {
+					t.Fatalf("Compute(%q, %q) lists an insertion before a deletion", old, new)
+				}
+			}
+		}
+		a, b := SplitLines(old), SplitLines(new)
+		if want := len(a) + len(b) - 2*lcs(a, b); changes != want {
+			t.Fatalf("Compute(%q, %q) has %d changed lines, want %d", old, new, changes, want)
+		}
+		if applied, err := Apply(old, hunks); err != nil || applied != new {
+			t.Fatalf("Apply() of Compute(%q, %q) = %q, %v", old, new, applied, err)
+		}
+	}
+}
+
+func TestParseHunk(t *testing.T) {
+	orig := Compute("a\nb\nc\n", "a\nx\nc\n", 1)[0]
+
+	edited, err := ParseHunk("@@ -1,3 +1,3 @@\n a\n-b\n+y\n+z\n c\n", orig)
+	if err != nil {
+		t.Fatalf("ParseHunk() error = %v", err)
+	}
+	if got, err := Apply("a\nb\nc\n", []Hunk{edited}); err != nil || got != "a\ny\nz\nc\n" {
+		t.Errorf("Apply() of the edited hunk = %q, %v", got, err)
+	}
+
+	if _, err := ParseHunk(" a\n c\n+x\n", orig); err == nil {
+		t.Error("ParseHunk() accepted a hunk that drops a removed line")
+	}
+}
@@ -0,0 +1,252 @@
+package ignore
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// FileNames are the per-directory ignore files, in increasing precedence
+var FileNames = []string{".gitignore", ".caiaignore"}
+
+// pattern is a single compiled ignore rule
+type pattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// patternSet holds the rules from one source, relative to its base directory
+type patternSet struct {
+	base     string // slash-separated, "" for the workspace root
+	patterns []pattern
+}
+
+// Matcher decides whether workspace paths are ignored using gitignore
+// semantics. Later sets take precedence over earlier ones and within a set
+// the last matching pattern wins.
+type Matcher struct {
+	sets []patternSet
+}
+
+// New creates a matcher with the global excludes and the ignore files of the
+// workspace root loaded. Ignore files in subdirectories are added with
+// LoadDir while walking the tree.
+func New(root string) *Matcher {
+	m := &Matcher{}
+	for _, file := range globalExcludeFiles() {
+		m.AddFile(file, "")
+	}
+	m.AddFile(filepath.Join(root, ".git", "info", "exclude"), "")
+	m.LoadDir(root, ".")
+	return m
+}
+
+// LoadDir adds the ignore files found in dir, whose workspace-relative path is rel
+func (m *Matcher) LoadDir(dir, rel string) {
+	for _, name := range FileNames {
+		m.AddFile(filepath.Join(dir, name), rel)
+	}
+}
+
+// AddFile adds the patterns in file, relative to the base directory. Missing
+// files are ignored.
+func (m *Matcher) AddFile(file, base string) {
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	m.AddPatterns(lines, base)
+}
+
+// AddPatterns adds gitignore-style lines relative to the base directory
+func (m *Matcher) AddPatterns(lines []string, base string) {
+	set := patternSet{base: strings.Trim(filepath.ToSlash(filepath.Clean(base)), "/")}
+	if set.base == "." {
+		set.base = ""
+	}
+
+	for _, line := range lines {
+		if p, ok := compile(line); ok {
+			set.patterns = append(set.patterns, p)
+		}
+	}
+	if len(set.patterns) > 0 {
+		m.sets = append(m.sets, set)
+	}
+}
+
+// Match reports whether the workspace-relative path is ignored
+func (m *Matcher) Match(path string, isDir bool) bool {
+	path = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "./")
+	if path == "." || path == "" {
+		return false
+	}
+
+	ignored := false
+	for _, set := range m.sets {
+		rel := path
+		if set.base != "" {
+			if !strings.HasPrefix(path, set.base+"/") {
+				continue
+			}
+			rel = path[len(set.base)+1:]
+		}
+
+		for _, p := range set.patterns {
+			if p.dirOnly && !isDir {
+				continue
+			}
+			if p.re.MatchString(rel) {
+				ignored = !p.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// compile turns one gitignore line into a pattern
+func compile(line string) (pattern, bool) {
+	// Trailing spaces are ignored unless escaped with a backslash
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern{}, false
+	}
+
+	var p pattern
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return pattern{}, false
+	}
+
+	// A slash anywhere but the end anchors the pattern to its base directory
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(?:.*/)?")
+	}
+	expr.WriteString(translate(line))
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return pattern{}, false
+	}
+	p.re = re
+	return p, true
+}
+
+// translate converts a glob with gitignore's ** rules into a regular expression
+func translate(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			// Leading or middle **/ matches zero or more directories
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**") && i+2 == len(glob) && (i == 0 || glob[i-1] == '/'):
+			// Trailing /** matches everything inside
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, "/", "") + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// globalExcludeFiles returns git's user-wide exclude files: core.excludesFile
+// from ~/.gitconfig if set, otherwise $XDG_CONFIG_HOME/git/ignore
+func globalExcludeFiles() []string {
+	home, _ := os.UserHomeDir()
+
+	if home != "" {
+		if file := excludesFileFromConfig(filepath.Join(home, ".gitconfig")); file != "" {
+			if strings.HasPrefix(file, "~/") {
+				file = filepath.Join(home, file[2:])
+			}
+			return []string{file}
+		}
+	}
+
+	config := os.Getenv("XDG_CONFIG_HOME")
+	if config == "" {
+		if home == "" {
+			return nil
+		}
+		config = filepath.Join(home, ".config")
+	}
+	return []string{filepath.Join(config, "git", "ignore")}
+}
+
+// excludesFileFromConfig reads core.excludesFile from a git config file
+func excludesFileFromConfig(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			section = strings.ToLower(strings.Trim(line, "[] "))
+			continue
+		}
+		if section != "core" {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 && strings.EqualFold(strings.TrimSpace(parts[0]), "excludesfile") {
+			return strings.Trim(strings.TrimSpace(parts[1]), `"`)
+		}
+	}
+	return ""
+}
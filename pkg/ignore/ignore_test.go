@@ -0,0 +1,101 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		base     string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{name: "name at any depth", patterns: []string{"*.log"}, path: "a/b/debug.log", want: true},
+		{name: "no match", patterns: []string{"*.log"}, path: "main.go", want: false},
+		{name: "comment", patterns: []string{"#main.go"}, path: "main.go", want: false},
+		{name: "escaped hash", patterns: []string{`\#notes`}, path: "#notes", want: true},
+		{name: "trailing spaces", patterns: []string{"build   "}, path: "build", want: true},
+
+		{name: "negation re-includes", patterns: []string{"*.log", "!keep.log"}, path: "keep.log", want: false},
+		{name: "negation only affects its match", patterns: []string{"*.log", "!keep.log"}, path: "drop.log", want: true},
+		{name: "last pattern wins", patterns: []string{"!keep.log", "*.log"}, path: "keep.log", want: true},
+		{name: "escaped exclamation mark", patterns: []string{`\!important`}, path: "!important", want: true},
+
+		{name: "leading slash anchors to the base", patterns: []string{"/todo"}, path: "todo", want: true},
+		{name: "anchored pattern skips subdirectories", patterns: []string{"/todo"}, path: "docs/todo", want: false},
+		{name: "middle slash anchors", patterns: []string{"doc/*.txt"}, path: "doc/notes.txt", want: true},
+		{name: "middle slash anchors below other dirs", patterns: []string{"doc/*.txt"}, path: "src/doc/notes.txt", want: false},
+		{name: "star stays in one element", patterns: []string{"doc/*.txt"}, path: "doc/sub/notes.txt", want: false},
+		{name: "leading double star", patterns: []string{"**/logs"}, path: "a/b/logs", isDir: true, want: true},
+		{name: "middle double star", patterns: []string{"a/**/z"}, path: "a/z", want: true},
+		{name: "middle double star many levels", patterns: []string{"a/**/z"}, path: "a/b/c/z", want: true},
+		{name: "trailing double star", patterns: []string{"out/**"}, path: "out/x/y.o", want: true},
+		{name: "character class", patterns: []string{"file[0-9].txt"}, path: "file7.txt", want: true},
+		{name: "negated character class", patterns: []string{"file[!0-9].txt"}, path: "file7.txt", want: false},
+
+		{name: "directory-only pattern matches a directory", patterns: []string{"build/"}, path: "build", isDir: true, want: true},
+		{name: "directory-only pattern skips files", patterns: []string{"build/"}, path: "build", want: false},
+		{name: "directory-only pattern at depth", patterns: []string{"build/"}, path: "cmd/build", isDir: true, want: true},
+		{name: "anchored directory-only pattern", patterns: []string{"/build/"}, path: "cmd/build", isDir: true, want: false},
+		{name: "negated directory", patterns: []string{"*", "!src/"}, path: "src", isDir: true, want: false},
+
+		{name: "nested file applies below its directory", patterns: []string{"*.tmp"}, base: "pkg", path: "pkg/a/x.tmp", want: true},
+		{name: "nested file does not apply elsewhere", patterns: []string{"*.tmp"}, base: "pkg", path: "cmd/x.tmp", want: false},
+		{name: "nested anchored pattern", patterns: []string{"/gen"}, base: "pkg", path: "pkg/gen", isDir: true, want: true},
+		{name: "nested anchored pattern below", patterns: []string{"/gen"}, base: "pkg", path: "pkg/a/gen", isDir: true, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Matcher{}
+			m.AddPatterns(tt.patterns, tt.base)
+			if got := m.Match(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("Match(%q, %v) with %q = %v, want %v", tt.path, tt.isDir, tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNestedFilesTakePrecedence(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore":      "*.log\n",
+		"sub/.gitignore":  "!keep.log\n",
+		"sub/.caiaignore": "secret.txt\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &Matcher{}
+	m.LoadDir(root, ".")
+	m.LoadDir(filepath.Join(root, "sub"), "sub")
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"debug.log", true},
+		{"sub/debug.log", true},
+		{"sub/keep.log", false},
+		{"keep.log", true},
+		{"sub/secret.txt", true},
+		{"secret.txt", false},
+	}
+	for _, tt := range tests {
+		if got := m.Match(tt.path, false); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
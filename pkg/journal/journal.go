@@ -0,0 +1,462 @@
+package journal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"caia-ai-cli/pkg/txn"
+)
+
+const (
+	// DefaultDir is where the journal is kept, relative to the workspace root
+	DefaultDir = ".caia/journal"
+	// MaxEntries is how many changesets the journal keeps. Older entries are
+	// dropped along with the content only they refer to.
+	MaxEntries = 100
+)
+
+// File is one file or directory captured in a snapshot
+type File struct {
+	Path string      `json:"path"`
+	Dir  bool        `json:"dir,omitempty"`
+	Blob string      `json:"blob,omitempty"` // SHA-256 of the content
+	Mode os.FileMode `json:"mode"`
+}
+
+// Snapshot records the state of a path and, for directories, everything
+// below it. Files is empty when the path did not exist.
+type Snapshot struct {
+	Path  string `json:"path"`
+	Files []File `json:"files,omitempty"`
+}
+
+// Entry is one applied changeset with the state before and after it
+type Entry struct {
+	ID          int        `json:"id"`
+	Time        time.Time  `json:"time"`
+	Description string     `json:"description"`
+	Before      []Snapshot `json:"before"`
+	After       []Snapshot `json:"after"`
+}
+
+// Paths returns the paths touched by the entry
+func (e Entry) Paths() []string {
+	var paths []string
+	for _, s := range e.Before {
+		paths = append(paths, s.Path)
+	}
+	return paths
+}
+
+type state struct {
+	Entries []Entry `json:"entries"`
+	// Position is the number of entries currently applied; entries after it
+	// have been undone and can be redone
+	Position int `json:"position"`
+}
+
+// Journal stores pre- and post-images of every changeset so they can be
+// undone and redone across sessions
+type Journal struct {
+	dir        string
+	maxEntries int
+	state      state
+}
+
+// ErrNothingToUndo and ErrNothingToRedo are returned when the journal has no
+// entry to move to
+var (
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// Open loads the journal in dir. A missing journal is empty; the directory is
+// only created when the first entry is recorded.
+func Open(dir string) (*Journal, error) {
+	j := &Journal{dir: dir, maxEntries: MaxEntries}
+	data, err := os.ReadFile(j.indexPath())
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading journal: %v", err)
+	}
+	if err := json.Unmarshal(data, &j.state); err != nil {
+		return nil, fmt.Errorf("error parsing journal: %v", err)
+	}
+	return j, nil
+}
+
+func (j *Journal) indexPath() string {
+	return filepath.Join(j.dir, "journal.json")
+}
+
+func (j *Journal) blobPath(hash string) string {
+	return filepath.Join(j.dir, "blobs", hash[:2], hash)
+}
+
+// History returns every entry, oldest first, and how many are applied
+func (j *Journal) History() ([]Entry, int) {
+	return j.state.Entries, j.state.Position
+}
+
+// Pending holds the pre-images of a changeset that is about to be applied
+type Pending struct {
+	journal *Journal
+	paths   []string
+	before  []Snapshot
+}
+
+// Begin snapshots paths before they are changed. Call Finish on the result
+// once the changes have been applied.
+func (j *Journal) Begin(paths []string) (*Pending, error) {
+	for i, p := range paths {
+		paths[i] = outermostMissing(p)
+	}
+	paths = topLevel(paths)
+	before, err := j.snapshot(paths)
+	if err != nil {
+		return nil, fmt.Errorf("error saving journal snapshot: %v", err)
+	}
+	return &Pending{journal: j, paths: paths, before: before}, nil
+}
+
+// Finish records the applied changes as a new entry. Recording after an undo
+// discards the entries that could have been redone, and only the last
+// MaxEntries entries are kept.
+func (p *Pending) Finish(description string) error {
+	j := p.journal
+	after, err := j.snapshot(p.paths)
+	if err != nil {
+		return fmt.Errorf("error saving journal snapshot: %v", err)
+	}
+
+	id := 1
+	if n := len(j.state.Entries); n > 0 {
+		id = j.state.Entries[n-1].ID + 1
+	}
+	j.state.Entries = append(j.state.Entries[:j.state.Position], Entry{
+		ID:          id,
+		Time:        time.Now(),
+		Description: description,
+		Before:      p.before,
+		After:       after,
+	})
+	if n := len(j.state.Entries) - j.maxEntries; n > 0 {
+		j.state.Entries = j.state.Entries[n:]
+	}
+	j.state.Position = len(j.state.Entries)
+	if err := j.save(); err != nil {
+		return err
+	}
+	j.prune()
+	return nil
+}
+
+// Next returns the entry Undo (redo false) or Redo (redo true) would restore
+func (j *Journal) Next(redo bool) (Entry, error) {
+	if redo {
+		if j.state.Position >= len(j.state.Entries) {
+			return Entry{}, ErrNothingToRedo
+		}
+		return j.state.Entries[j.state.Position], nil
+	}
+	if j.state.Position == 0 {
+		return Entry{}, ErrNothingToUndo
+	}
+	return j.state.Entries[j.state.Position-1], nil
+}
+
+// Modified lists the paths of the next undo or redo entry whose current state
+// no longer matches what the journal expects, meaning they were changed
+// outside the journal and restoring would overwrite those changes
+func (j *Journal) Modified(redo bool) ([]string, error) {
+	entry, err := j.Next(redo)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := entry.After
+	if redo {
+		expected = entry.Before
+	}
+
+	var modified []string
+	for _, snap := range expected {
+		current, err := j.describe(snap.Path, false)
+		if err != nil {
+			return nil, err
+		}
+		if !sameFiles(current.Files, snap.Files) {
+			modified = append(modified, snap.Path)
+		}
+	}
+	return modified, nil
+}
+
+// Undo restores the files of the most recent applied entry to their state
+// before it
+func (j *Journal) Undo() (Entry, error) {
+	entry, err := j.Next(false)
+	if err != nil {
+		return entry, err
+	}
+	if err := j.restore(entry.Before); err != nil {
+		return entry, err
+	}
+	j.state.Position--
+	return entry, j.save()
+}
+
+// Redo reapplies the most recently undone entry
+func (j *Journal) Redo() (Entry, error) {
+	entry, err := j.Next(true)
+	if err != nil {
+		return entry, err
+	}
+	if err := j.restore(entry.After); err != nil {
+		return entry, err
+	}
+	j.state.Position++
+	return entry, j.save()
+}
+
+func (j *Journal) save() error {
+	if err := os.MkdirAll(j.dir, 0755); err != nil {
+		return fmt.Errorf("error creating journal directory: %v", err)
+	}
+	data, err := json.MarshalIndent(j.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tx := txn.New()
+	tx.WriteFile(j.indexPath(), data, 0644)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error writing journal: %v", err)
+	}
+	return nil
+}
+
+// snapshot captures paths, storing file contents as blobs
+func (j *Journal) snapshot(paths []string) ([]Snapshot, error) {
+	var snaps []Snapshot
+	for _, path := range paths {
+		snap, err := j.describe(path, true)
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snap)
+	}
+	return snaps, nil
+}
+
+// describe walks path and hashes every regular file. When store is set the
+// contents are saved as blobs. Symlinks and other special files are skipped.
+func (j *Journal) describe(path string, store bool) (Snapshot, error) {
+	snap := Snapshot{Path: filepath.Clean(path)}
+
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return snap, nil
+	}
+
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(path, p)
+		switch {
+		case d.IsDir():
+			snap.Files = append(snap.Files, File{Path: rel, Dir: true, Mode: info.Mode().Perm()})
+		case info.Mode().IsRegular():
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			hash := hashOf(data)
+			if store {
+				if err := j.storeBlob(hash, data); err != nil {
+					return err
+				}
+			}
+			snap.Files = append(snap.Files, File{Path: rel, Blob: hash, Mode: info.Mode().Perm()})
+		}
+		return nil
+	})
+	return snap, err
+}
+
+func (j *Journal) storeBlob(hash string, data []byte) error {
+	blob := j.blobPath(hash)
+	if _, err := os.Stat(blob); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(blob, data, 0644)
+}
+
+// prune removes the blobs no entry refers to any more. It is best effort: a
+// blob left behind only takes space.
+func (j *Journal) prune() {
+	used := make(map[string]bool)
+	for _, entry := range j.state.Entries {
+		for _, snaps := range [][]Snapshot{entry.Before, entry.After} {
+			for _, snap := range snaps {
+				for _, f := range snap.Files {
+					used[f.Blob] = true
+				}
+			}
+		}
+	}
+
+	filepath.WalkDir(filepath.Join(j.dir, "blobs"), func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && !used[d.Name()] {
+			os.Remove(p)
+		}
+		return nil
+	})
+}
+
+// restore brings every snapshot path back to its recorded state in a single
+// transaction
+func (j *Journal) restore(snaps []Snapshot) error {
+	tx := txn.New()
+
+	for _, snap := range snaps {
+		current, err := j.describe(snap.Path, false)
+		if err != nil {
+			return err
+		}
+
+		if len(snap.Files) == 0 {
+			if len(current.Files) > 0 {
+				tx.Remove(snap.Path)
+			}
+			continue
+		}
+
+		want := make(map[string]File)
+		for _, f := range snap.Files {
+			want[f.Path] = f
+		}
+		have := make(map[string]File)
+		for _, f := range current.Files {
+			have[f.Path] = f
+		}
+
+		// Remove what did not exist, outermost paths only
+		var removed []string
+		for _, f := range current.Files {
+			if w, ok := want[f.Path]; ok && w.Dir == f.Dir {
+				continue
+			}
+			if within(f.Path, removed) {
+				continue
+			}
+			removed = append(removed, f.Path)
+			tx.Remove(filepath.Join(snap.Path, f.Path))
+		}
+
+		// Recreate directories and files that differ
+		for _, f := range snap.Files {
+			target := filepath.Join(snap.Path, f.Path)
+			h, exists := have[f.Path]
+			if f.Dir {
+				if !exists || !h.Dir {
+					tx.MkdirAll(target, f.Mode)
+				}
+				continue
+			}
+			if exists && !h.Dir && h.Blob == f.Blob {
+				continue
+			}
+			data, err := os.ReadFile(j.blobPath(f.Blob))
+			if err != nil {
+				return fmt.Errorf("journal content for %s is missing: %v", target, err)
+			}
+			tx.WriteFile(target, data, f.Mode)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// topLevel removes duplicates and paths nested inside other paths, since
+// snapshotting a directory already covers its contents
+func topLevel(paths []string) []string {
+	cleaned := make([]string, 0, len(paths))
+	for _, p := range paths {
+		cleaned = append(cleaned, filepath.Clean(p))
+	}
+	sort.Strings(cleaned)
+
+	var result []string
+	for _, p := range cleaned {
+		if !within(p, result) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// outermostMissing returns the highest missing ancestor of path, so undoing
+// the creation of a file also removes the directories created for it
+func outermostMissing(path string) string {
+	path = filepath.Clean(path)
+	if _, err := os.Lstat(path); err == nil {
+		return path
+	}
+	for {
+		parent := filepath.Dir(path)
+		if parent == path || parent == "." {
+			return path
+		}
+		if _, err := os.Lstat(parent); err == nil {
+			return path
+		}
+		path = parent
+	}
+}
+
+// within reports whether path equals or is below one of dirs
+func within(path string, dirs []string) bool {
+	for _, d := range dirs {
+		if path == d || strings.HasPrefix(path, d+string(filepath.Separator)) || d == "." {
+			return true
+		}
+	}
+	return false
+}
+
+func sameFiles(a, b []File) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Path != b[i].Path || a[i].Dir != b[i].Dir || a[i].Blob != b[i].Blob {
+			return false
+		}
+	}
+	return true
+}
+
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,232 @@
+package journal
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"caia-ai-cli/pkg/txn"
+)
+
+// tree returns every file and directory under root with file contents
+func tree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		if d.IsDir() {
+			files[rel+"/"] = ""
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		files[rel] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// apply commits tx and records it in j the way the CLI does
+func apply(t *testing.T, j *Journal, description string, tx *txn.Tx) {
+	t.Helper()
+	pending, err := j.Begin(tx.Paths())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pending.Finish(description); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(tx *txn.Tx, dir string)
+	}{
+		{
+			name: "write",
+			build: func(tx *txn.Tx, dir string) {
+				tx.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed"), 0644)
+				tx.WriteFile(filepath.Join(dir, "new", "deep", "b.txt"), []byte("b"), 0644)
+			},
+		},
+		{
+			name: "delete",
+			build: func(tx *txn.Tx, dir string) {
+				tx.Remove(filepath.Join(dir, "a.txt"))
+				tx.Remove(filepath.Join(dir, "sub"))
+			},
+		},
+		{
+			name: "move",
+			build: func(tx *txn.Tx, dir string) {
+				tx.Rename(filepath.Join(dir, "a.txt"), filepath.Join(dir, "moved", "a.txt"))
+				tx.Rename(filepath.Join(dir, "sub"), filepath.Join(dir, "renamed"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, journalDir := t.TempDir(), t.TempDir()
+			writeFiles(t, dir, map[string]string{"a.txt": "a", "sub/c.txt": "c", "sub/d/e.txt": "e"})
+			before := tree(t, dir)
+
+			j, err := Open(journalDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tx := txn.New()
+			tt.build(tx, dir)
+			apply(t, j, tt.name, tx)
+			after := tree(t, dir)
+
+			// Undo and redo work in a later session
+			j, err = Open(journalDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if modified, err := j.Modified(false); err != nil || len(modified) > 0 {
+				t.Errorf("Modified() = %v, %v, want nothing", modified, err)
+			}
+			if entry, err := j.Undo(); err != nil || entry.Description != tt.name {
+				t.Fatalf("Undo() = %v, %v", entry, err)
+			}
+			if got := tree(t, dir); !reflect.DeepEqual(got, before) {
+				t.Errorf("tree after undo = %v, want %v", got, before)
+			}
+			if _, err := j.Undo(); !errors.Is(err, ErrNothingToUndo) {
+				t.Errorf("second Undo() error = %v, want ErrNothingToUndo", err)
+			}
+
+			j, err = Open(journalDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := j.Redo(); err != nil {
+				t.Fatalf("Redo() error = %v", err)
+			}
+			if got := tree(t, dir); !reflect.DeepEqual(got, after) {
+				t.Errorf("tree after redo = %v, want %v", got, after)
+			}
+			if _, err := j.Redo(); !errors.Is(err, ErrNothingToRedo) {
+				t.Errorf("second Redo() error = %v, want ErrNothingToRedo", err)
+			}
+		})
+	}
+}
+
+func TestModifiedReportsOutsideChanges(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "a"})
+	j, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := txn.New()
+	tx.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed"), 0644)
+	apply(t, j, "write", tx)
+
+	writeFiles(t, dir, map[string]string{"a.txt": "edited by hand"})
+	modified, err := j.Modified(false)
+	if err != nil || len(modified) != 1 || modified[0] != filepath.Join(dir, "a.txt") {
+		t.Errorf("Modified() = %v, %v, want a.txt", modified, err)
+	}
+}
+
+func TestNewChangeClearsRedo(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "a"})
+	j, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := txn.New()
+	tx.WriteFile(filepath.Join(dir, "a.txt"), []byte("first"), 0644)
+	apply(t, j, "first", tx)
+	if _, err := j.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.Next(true); err != nil {
+		t.Fatalf("Next(true) after undo error = %v", err)
+	}
+
+	tx = txn.New()
+	tx.WriteFile(filepath.Join(dir, "a.txt"), []byte("second"), 0644)
+	apply(t, j, "second", tx)
+
+	if _, err := j.Next(true); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("Next(true) after a new change error = %v, want ErrNothingToRedo", err)
+	}
+	entries, position := j.History()
+	if len(entries) != 1 || entries[0].Description != "second" || position != 1 {
+		t.Errorf("History() = %v, %d, want only the second change", entries, position)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	dir, journalDir := t.TempDir(), t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "original"})
+	j, err := Open(journalDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.maxEntries = 2
+
+	for _, content := range []string{"one", "two", "three"} {
+		tx := txn.New()
+		tx.WriteFile(filepath.Join(dir, "a.txt"), []byte(content), 0644)
+		apply(t, j, content, tx)
+	}
+
+	entries, position := j.History()
+	if len(entries) != 2 || entries[0].Description != "two" || position != 2 {
+		t.Fatalf("History() = %v, %d, want the last two changes", entries, position)
+	}
+	if _, err := os.Stat(j.blobPath(hashOf([]byte("original")))); !os.IsNotExist(err) {
+		t.Errorf("content only the dropped entry referred to was kept: %v", err)
+	}
+	for _, content := range []string{"one", "two", "three"} {
+		if _, err := os.Stat(j.blobPath(hashOf([]byte(content)))); err != nil {
+			t.Errorf("content of a kept entry is missing: %v", err)
+		}
+	}
+
+	// The kept entries can still be undone
+	for i := 0; i < 2; i++ {
+		if _, err := j.Undo(); err != nil {
+			t.Fatalf("Undo() error = %v", err)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "one" {
+		t.Errorf("a.txt after undoing the kept entries = %q, want %q", data, "one")
+	}
+	if _, err := j.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Undo() past the kept entries error = %v, want ErrNothingToUndo", err)
+	}
+}
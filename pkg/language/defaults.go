@@ -0,0 +1,46 @@
+package language
+
+// Defaults are the built-in language rules. Files can add to and override
+// them; see Load.
+var Defaults = []Language{
+	{Name: "Go", Extensions: []string{".go"}, Modes: []string{"go"}},
+	{Name: "JavaScript", Extensions: []string{".js", ".jsx", ".mjs", ".cjs"},
+		Interpreters: []string{"node", "nodejs"}, Modes: []string{"javascript", "js"}},
+	{Name: "TypeScript", Extensions: []string{".ts", ".tsx", ".mts", ".cts"},
+		Interpreters: []string{"ts-node", "deno", "bun"}, Modes: []string{"typescript", "ts"}},
+	{Name: "Python", Extensions: []string{".py", ".pyw", ".pyi"},
+		Interpreters: []string{"python", "python2", "python3", "pypy", "pypy3"}, Modes: []string{"python"}},
+	{Name: "Java", Extensions: []string{".java"}, Modes: []string{"java"}},
+	{Name: "C++", Extensions: []string{".cpp", ".cc", ".cxx", ".hpp", ".hh", ".hxx"}, Modes: []string{"cpp", "c++"}},
+	{Name: "C", Extensions: []string{".c", ".h"}, Modes: []string{"c"}},
+	{Name: "Rust", Extensions: []string{".rs"}, Modes: []string{"rust"}},
+	{Name: "Ruby", Extensions: []string{".rb", ".rake", ".gemspec"},
+		Filenames: []string{"Gemfile", "Rakefile"}, Interpreters: []string{"ruby"}, Modes: []string{"ruby"}},
+	{Name: "PHP", Extensions: []string{".php"}, Interpreters: []string{"php"}, Modes: []string{"php"}},
+	{Name: "Swift", Extensions: []string{".swift"}, Modes: []string{"swift"}},
+	{Name: "Kotlin", Extensions: []string{".kt", ".kts"}, Modes: []string{"kotlin"}},
+	{Name: "C#", Extensions: []string{".cs"}, Modes: []string{"cs", "csharp"}},
+	{Name: "Scala", Extensions: []string{".scala", ".sc"}, Interpreters: []string{"scala"}, Modes: []string{"scala"}},
+	{Name: "Lua", Extensions: []string{".lua"}, Interpreters: []string{"lua"}, Modes: []string{"lua"}},
+	{Name: "Perl", Extensions: []string{".pl", ".pm"}, Interpreters: []string{"perl"}, Modes: []string{"perl"}},
+	{Name: "R", Extensions: []string{".r"}, Interpreters: []string{"Rscript"}, Modes: []string{"r"}},
+	{Name: "Shell", Extensions: []string{".sh", ".bash", ".zsh", ".ksh"},
+		Filenames:    []string{".bashrc", ".bash_profile", ".zshrc", ".profile"},
+		Interpreters: []string{"sh", "bash", "zsh", "ksh", "dash"}, Modes: []string{"sh", "bash", "zsh", "shell-script"}},
+	{Name: "SQL", Extensions: []string{".sql"}, Modes: []string{"sql"}},
+	{Name: "HTML", Extensions: []string{".html", ".htm"}, Modes: []string{"html"}},
+	{Name: "CSS", Extensions: []string{".css", ".scss", ".less"}, Modes: []string{"css", "scss"}},
+	{Name: "XML", Extensions: []string{".xml", ".xsd", ".svg"}, Modes: []string{"xml"}},
+	{Name: "Markdown", Extensions: []string{".md", ".markdown"}, Modes: []string{"markdown", "md"}},
+	{Name: "JSON", Extensions: []string{".json"}, Modes: []string{"json"}},
+	{Name: "YAML", Extensions: []string{".yaml", ".yml"}, Modes: []string{"yaml"}},
+	{Name: "TOML", Extensions: []string{".toml"}, Filenames: []string{"Cargo.lock"}, Modes: []string{"toml"}},
+	{Name: "Makefile", Extensions: []string{".mk"}, Filenames: []string{"Makefile", "GNUmakefile", "makefile"},
+		Interpreters: []string{"make"}, Modes: []string{"make", "makefile"}},
+	{Name: "Dockerfile", Extensions: []string{".dockerfile"}, Filenames: []string{"Dockerfile", "Containerfile"},
+		Modes: []string{"dockerfile"}},
+	{Name: "CSV", Extensions: []string{".csv"}, Modes: []string{"csv"}},
+	{Name: "TSV", Extensions: []string{".tsv", ".tab"}, Modes: []string{"tsv"}},
+	{Name: "Text", Extensions: []string{".txt"}, Modes: []string{"text"}},
+	{Name: "Excel", Extensions: []string{".xlsx", ".xls"}},
+}
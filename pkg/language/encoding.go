@@ -0,0 +1,113 @@
+package language
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// Encodings reported by Stats
+const (
+	ASCII    = "ASCII"
+	UTF8     = "UTF-8"
+	UTF8BOM  = "UTF-8 with BOM"
+	UTF16LE  = "UTF-16LE"
+	UTF16BE  = "UTF-16BE"
+	EightBit = "8-bit"
+)
+
+// Stats counts the lines of a file and recognizes its encoding as the file
+// is written to it, so they can be gathered while hashing
+type Stats struct {
+	size    int64
+	lines   int
+	last    byte
+	head    []byte // the first bytes, for byte order marks
+	partial []byte // an incomplete UTF-8 sequence at the end of the last write
+	ascii   bool   // only while no other byte has been seen
+	invalid bool
+}
+
+// NewStats returns empty stats
+func NewStats() *Stats {
+	return &Stats{ascii: true}
+}
+
+// Write adds p to the stats. It never fails.
+func (s *Stats) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if len(s.head) < 3 {
+		n := min(3-len(s.head), len(p))
+		s.head = append(s.head, p[:n]...)
+	}
+	s.size += int64(len(p))
+	s.lines += bytes.Count(p, []byte{'\n'})
+	s.last = p[len(p)-1]
+
+	if s.ascii {
+		for _, c := range p {
+			if c >= utf8.RuneSelf {
+				s.ascii = false
+				break
+			}
+		}
+	}
+	if !s.ascii && !s.invalid {
+		s.checkUTF8(p)
+	}
+	return len(p), nil
+}
+
+// checkUTF8 validates p, carrying a sequence split across writes over to
+// the next one
+func (s *Stats) checkUTF8(p []byte) {
+	data := p
+	if len(s.partial) > 0 {
+		data = append(s.partial, p...)
+		s.partial = nil
+	}
+
+	// Hold back a trailing sequence that may be completed by the next write
+	start := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			start = i
+			break
+		}
+	}
+	if start < len(data) && !utf8.FullRune(data[start:]) {
+		s.partial = append([]byte{}, data[start:]...)
+		data = data[:start]
+	}
+	if !utf8.Valid(data) {
+		s.invalid = true
+	}
+}
+
+// Lines returns the number of lines, counting a last line without a newline
+func (s *Stats) Lines() int {
+	if s.size > 0 && s.last != '\n' {
+		return s.lines + 1
+	}
+	return s.lines
+}
+
+// Encoding names the text encoding: a byte order mark wins, then ASCII and
+// UTF-8, and anything else is reported as 8-bit
+func (s *Stats) Encoding() string {
+	switch {
+	case bytes.HasPrefix(s.head, []byte{0xEF, 0xBB, 0xBF}):
+		return UTF8BOM
+	case bytes.HasPrefix(s.head, []byte{0xFF, 0xFE}):
+		return UTF16LE
+	case bytes.HasPrefix(s.head, []byte{0xFE, 0xFF}):
+		return UTF16BE
+	case s.ascii:
+		return ASCII
+	case s.invalid || len(s.partial) > 0:
+		return EightBit
+	default:
+		return UTF8
+	}
+}
@@ -0,0 +1,41 @@
+package language
+
+import "testing"
+
+func TestStats(t *testing.T) {
+	tests := []struct {
+		name     string
+		writes   []string
+		lines    int
+		encoding string
+	}{
+		{name: "empty", lines: 0, encoding: ASCII},
+		{name: "ascii", writes: []string{"a\nb\n"}, lines: 2, encoding: ASCII},
+		{name: "last line without a newline", writes: []string{"a\nb"}, lines: 2, encoding: ASCII},
+		{name: "blank lines", writes: []string{"\n\n\n"}, lines: 3, encoding: ASCII},
+		{name: "utf-8", writes: []string{"héllo\n"}, lines: 1, encoding: UTF8},
+		{name: "utf-8 split across writes", writes: []string{"h\xc3", "\xa9llo\n"}, lines: 1, encoding: UTF8},
+		{name: "four byte rune split across writes", writes: []string{"\xf0\x9f", "\x98", "\x80\n"}, lines: 1, encoding: UTF8},
+		{name: "latin-1", writes: []string{"h\xe9llo\n"}, lines: 1, encoding: EightBit},
+		{name: "truncated utf-8 at the end", writes: []string{"ok\xc3"}, lines: 1, encoding: EightBit},
+		{name: "utf-8 byte order mark", writes: []string{"\xef\xbb\xbfa\n"}, lines: 1, encoding: UTF8BOM},
+		{name: "byte order mark split across writes", writes: []string{"\xef", "\xbb\xbf"}, lines: 1, encoding: UTF8BOM},
+		{name: "utf-16le", writes: []string{"\xff\xfea\x00"}, lines: 1, encoding: UTF16LE},
+		{name: "utf-16be", writes: []string{"\xfe\xff\x00a"}, lines: 1, encoding: UTF16BE},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStats()
+			for _, w := range tt.writes {
+				s.Write([]byte(w))
+			}
+			if got := s.Lines(); got != tt.lines {
+				t.Errorf("Lines() = %d, want %d", got, tt.lines)
+			}
+			if got := s.Encoding(); got != tt.encoding {
+				t.Errorf("Encoding() = %q, want %q", got, tt.encoding)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package language
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Language describes how files of one language are recognized
+type Language struct {
+	Name string `json:"name"`
+	// Extensions include the dot, e.g. ".py"
+	Extensions []string `json:"extensions,omitempty"`
+	// Filenames are exact base names such as Makefile
+	Filenames []string `json:"filenames,omitempty"`
+	// Interpreters are the programs named in a #! line, e.g. python3
+	Interpreters []string `json:"interpreters,omitempty"`
+	// Modes are the names used in vim and emacs modelines, e.g. sh
+	Modes []string `json:"modes,omitempty"`
+}
+
+// Registry maps file names and contents to languages
+type Registry struct {
+	extensions   map[string]string
+	filenames    map[string]string
+	interpreters map[string]string
+	modes        map[string]string
+	fingerprint  string
+}
+
+// New creates a registry from languages. Later languages take precedence
+// when they claim the same extension, filename, interpreter or mode.
+func New(languages []Language) *Registry {
+	r := &Registry{
+		extensions:   make(map[string]string),
+		filenames:    make(map[string]string),
+		interpreters: make(map[string]string),
+		modes:        make(map[string]string),
+	}
+	r.Add(languages)
+	return r
+}
+
+// Add registers more languages, overriding earlier rules they conflict with
+func (r *Registry) Add(languages []Language) {
+	for _, l := range languages {
+		for _, ext := range l.Extensions {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			r.extensions[strings.ToLower(ext)] = l.Name
+		}
+		for _, name := range l.Filenames {
+			r.filenames[name] = l.Name
+		}
+		for _, interp := range l.Interpreters {
+			r.interpreters[interp] = l.Name
+		}
+		for _, mode := range l.Modes {
+			r.modes[strings.ToLower(mode)] = l.Name
+		}
+	}
+}
+
+// Load creates a registry with the default languages and the ones in a
+// JSON file holding a list of Language objects. A missing file only yields
+// the defaults.
+func Load(path string) (*Registry, error) {
+	r := New(Defaults)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return r, fmt.Errorf("error reading language rules: %v", err)
+	}
+
+	var languages []Language
+	if err := json.Unmarshal(data, &languages); err != nil {
+		return r, fmt.Errorf("error parsing language rules in %s: %v", path, err)
+	}
+	r.Add(languages)
+
+	sum := sha256.Sum256(data)
+	r.fingerprint = hex.EncodeToString(sum[:8])
+	return r, nil
+}
+
+// Fingerprint identifies the loaded rules, so detection results cached with
+// other rules can be recognized. It is "" for the defaults.
+func (r *Registry) Fingerprint() string {
+	return r.fingerprint
+}
+
+// ByName returns the language of a file name alone, by exact filename and
+// then by extension, or ""
+func (r *Registry) ByName(name string) string {
+	base := filepath.Base(name)
+	if lang, ok := r.filenames[base]; ok {
+		return lang
+	}
+	return r.extensions[strings.ToLower(filepath.Ext(base))]
+}
+
+// Detect returns the language of a file from its name and content, checking
+// a modeline first, then the filename, the #! line and the extension. head
+// is the start of the file and tail its end, which may overlap.
+func (r *Registry) Detect(name string, head, tail []byte) string {
+	if lang := r.byModeline(head, tail); lang != "" {
+		return lang
+	}
+	base := filepath.Base(name)
+	if lang, ok := r.filenames[base]; ok {
+		return lang
+	}
+	if lang := r.byShebang(head); lang != "" {
+		return lang
+	}
+	return r.extensions[strings.ToLower(filepath.Ext(base))]
+}
+
+// DetectFile reads the start and end of a file and returns its language and
+// whether it is binary. Binary files have no language.
+func (r *Registry) DetectFile(path string) (lang string, binary bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", false, err
+	}
+	head = head[:n]
+
+	tail := head
+	if n == sniffLen {
+		if info, err := f.Stat(); err == nil && info.Size() > int64(sniffLen) {
+			tail = make([]byte, tailLen)
+			if m, err := f.ReadAt(tail, info.Size()-int64(tailLen)); err == nil || err == io.EOF {
+				tail = tail[:m]
+			}
+		}
+	}
+
+	// Workbooks are zip or OLE containers but have a language of their own
+	if byName := r.ByName(path); byName == "Excel" {
+		return byName, true, nil
+	}
+	if IsBinary(head) {
+		return "", true, nil
+	}
+	return r.Detect(path, head, tail), false, nil
+}
+
+const (
+	// sniffLen is how much of the start of a file is examined
+	sniffLen = 8000
+	// tailLen is how much of the end is searched for modelines
+	tailLen = 1024
+	// modelineLines is how many lines at either end may hold a modeline
+	modelineLines = 5
+)
+
+// IsBinary reports whether data, the start of a file, looks binary: it
+// holds a NUL byte, as git checks, or is mostly not valid text
+func IsBinary(data []byte) bool {
+	if len(data) > sniffLen {
+		data = data[:sniffLen]
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return true
+	}
+	if utf8.Valid(data) {
+		return false
+	}
+
+	// Allow legacy 8-bit encodings but not arbitrary bytes
+	control := 0
+	for _, c := range data {
+		if c < 32 && c != '\n' && c != '\r' && c != '\t' && c != '\f' && c != '\b' && c != 27 {
+			control++
+		}
+	}
+	return control*10 > len(data)
+}
+
+var (
+	vimModeline   = regexp.MustCompile(`(?:^|\s)(?:vi|vim|ex):\s*(?:set?\s+)?(?:.*[\s:])?(?:ft|filetype|syntax)=([\w+#-]+)`)
+	emacsModeline = regexp.MustCompile(`-\*-\s*(?:(?:.*;)?\s*mode:\s*([\w+#-]+)|([\w+#-]+))\s*(?:;.*)?-\*-`)
+)
+
+// byModeline looks for a vim or emacs modeline in the first and last lines
+func (r *Registry) byModeline(head, tail []byte) string {
+	lines := firstLines(head, modelineLines)
+	lines = append(lines, lastLines(tail, modelineLines)...)
+	for _, line := range lines {
+		var mode string
+		if m := vimModeline.FindStringSubmatch(line); m != nil {
+			mode = m[1]
+		} else if m := emacsModeline.FindStringSubmatch(line); m != nil {
+			mode = m[1] + m[2]
+		}
+		if lang, ok := r.modes[strings.ToLower(mode)]; ok {
+			return lang
+		}
+	}
+	return ""
+}
+
+// byShebang maps the interpreter of a #! line, looking through env
+func (r *Registry) byShebang(head []byte) string {
+	if !bytes.HasPrefix(head, []byte("#!")) {
+		return ""
+	}
+	line := firstLines(head, 1)[0]
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interp := filepath.Base(fields[0])
+	if interp == "env" {
+		interp = ""
+		for _, f := range fields[1:] {
+			// Skip env options such as -S and variable assignments
+			if !strings.HasPrefix(f, "-") && !strings.Contains(f, "=") {
+				interp = f
+				break
+			}
+		}
+	}
+	if lang, ok := r.interpreters[interp]; ok {
+		return lang
+	}
+	// python3.12 and similar versioned names
+	return r.interpreters[strings.TrimRight(interp, "0123456789.")]
+}
+
+func firstLines(data []byte, n int) []string {
+	lines := strings.SplitN(string(data), "\n", n+1)
+	if len(lines) > n {
+		lines = lines[:n]
+	}
+	return lines
+}
+
+func lastLines(data []byte, n int) []string {
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
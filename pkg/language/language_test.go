@@ -0,0 +1,144 @@
+package language
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	r := New(Defaults)
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{name: "extension", file: "main.go", want: "Go"},
+		{name: "extension case", file: "SCRIPT.PY", want: "Python"},
+		{name: "filename", file: "Makefile", want: "Makefile"},
+		{name: "filename in a directory", file: "build/Dockerfile", want: "Dockerfile"},
+		{name: "filename is case sensitive", file: "dockerfile"},
+		{name: "unknown", file: "notes.xyz"},
+		{name: "shebang", file: "run", content: "#!/bin/bash\necho hi\n", want: "Shell"},
+		{name: "shebang through env", file: "run", content: "#!/usr/bin/env python3\n", want: "Python"},
+		{name: "shebang with env options", file: "run", content: "#!/usr/bin/env -S NODE_ENV=dev node --harmony\n", want: "JavaScript"},
+		{name: "versioned interpreter", file: "run", content: "#!/usr/bin/python3.12\n", want: "Python"},
+		{name: "unknown interpreter", file: "run", content: "#!/usr/bin/tclsh\n"},
+		{name: "vim modeline", file: "run", content: "x\n# vim: set ft=ruby :\n", want: "Ruby"},
+		{name: "vim filetype", file: "run", content: "// vi: filetype=javascript\n", want: "JavaScript"},
+		{name: "emacs mode", file: "run", content: "# -*- mode: python; coding: utf-8 -*-\n", want: "Python"},
+		{name: "emacs short form", file: "run", content: "# -*- Perl -*-\n", want: "Perl"},
+		{name: "unknown mode falls through", file: "a.go", content: "// vim: ft=cobol\n", want: "Go"},
+		{name: "modeline beats shebang", file: "run", content: "#!/bin/sh\n# vim: ft=python\n", want: "Python"},
+		{name: "modeline beats filename", file: "Makefile", content: "# vim: ft=sh\n", want: "Shell"},
+		{name: "modeline beats extension", file: "a.txt", content: "-*- mode: markdown -*-\n", want: "Markdown"},
+		{name: "filename beats shebang", file: "Rakefile", content: "#!/usr/bin/env python\n", want: "Ruby"},
+		{name: "shebang beats extension", file: "tool.txt", content: "#!/usr/bin/env ruby\n", want: "Ruby"},
+		{name: "shebang only on the first line", file: "a.txt", content: "\n#!/bin/sh\n", want: "Text"},
+		{
+			name:    "modeline beyond the first and last lines",
+			file:    "a.txt",
+			content: "1\n2\n3\n4\n5\n# vim: ft=go\n7\n8\n9\n10\n11\n",
+			want:    "Text",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := []byte(tt.content)
+			if got := r.Detect(tt.file, content, content); got != tt.want {
+				t.Errorf("Detect(%q) = %q, want %q", tt.file, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectFile(t *testing.T) {
+	dir := t.TempDir()
+	r := New(Defaults)
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+		binary  bool
+	}{
+		{name: "text", file: "a.go", content: "package a\n", want: "Go"},
+		{name: "modeline at the end of a long file", file: "a.txt", content: strings.Repeat("x\n", 10000) + "# vim: ft=yaml\n", want: "YAML"},
+		{name: "binary", file: "a.go", content: "\x00\x01\x02", binary: true},
+		{name: "workbook", file: "a.xlsx", content: "PK\x03\x04\x00\x00", want: "Excel", binary: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			lang, binary, err := r.DetectFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lang != tt.want || binary != tt.binary {
+				t.Errorf("DetectFile() = %q, %v, want %q, %v", lang, binary, tt.want, tt.binary)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	rules := filepath.Join(dir, "languages.json")
+	err := os.WriteFile(rules, []byte(`[
+		{"name": "Starlark", "extensions": ["bzl", ".star"], "filenames": ["BUILD"], "modes": ["starlark"]},
+		{"name": "Template", "extensions": [".TXT"], "interpreters": ["python3"]}
+	]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Load(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Fingerprint() == "" {
+		t.Error("Fingerprint() of loaded rules is empty")
+	}
+
+	tests := []struct {
+		file    string
+		content string
+		want    string
+	}{
+		{file: "rules.bzl", want: "Starlark"},
+		{file: "rules.star", want: "Starlark"},
+		{file: "BUILD", want: "Starlark"},
+		{file: "run", content: "# vim: ft=starlark\n", want: "Starlark"},
+		{file: "notes.txt", want: "Template"},
+		{file: "run", content: "#!/usr/bin/env python3\n", want: "Template"},
+		{file: "run", content: "#!/usr/bin/env python\n", want: "Python"},
+		{file: "main.go", want: "Go"},
+	}
+	for _, tt := range tests {
+		content := []byte(tt.content)
+		if got := r.Detect(tt.file, content, content); got != tt.want {
+			t.Errorf("Detect(%q, %q) = %q, want %q", tt.file, tt.content, got, tt.want)
+		}
+	}
+
+	if r, err := Load(filepath.Join(dir, "missing.json")); err != nil || r.Fingerprint() != "" || r.ByName("a.go") != "Go" {
+		t.Errorf("Load() of a missing file = %v, want the defaults", err)
+	}
+
+	broken := filepath.Join(dir, "broken.json")
+	if err := os.WriteFile(broken, []byte(`{"name": "x"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := Load(broken); err == nil || r.ByName("a.go") != "Go" {
+		t.Errorf("Load() of invalid rules = %v, want an error and the defaults", err)
+	}
+}
@@ -0,0 +1,286 @@
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInterrupted is returned by ReadLine when the user presses Ctrl+C
+var ErrInterrupted = errors.New("interrupted")
+
+// Completer returns the candidates for word, the text between the last
+// space before the cursor and the cursor. line is the whole input so far.
+type Completer func(line, word string) []string
+
+// Editor reads lines with basic editing, history and tab completion when
+// stdin is a terminal, and plain lines otherwise
+type Editor struct {
+	complete Completer
+	in       *os.File
+	out      io.Writer
+	plain    *bufio.Reader // set when stdin is not a terminal
+	history  []string
+	pending  []byte // bytes read past the end of the last line
+}
+
+// New creates an editor on stdin and stdout. complete may be nil.
+func New(complete Completer) *Editor {
+	e := &Editor{complete: complete, in: os.Stdin, out: os.Stdout}
+	if !isTerminal(int(e.in.Fd())) {
+		e.plain = bufio.NewReader(e.in)
+	}
+	return e
+}
+
+// ReadLine prints prompt and returns the line entered, without the newline.
+// It returns io.EOF at the end of input or on Ctrl+D on an empty line.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(e.out, prompt)
+	if e.plain != nil {
+		return e.readPlain()
+	}
+
+	restore, err := makeRaw(int(e.in.Fd()))
+	if err != nil {
+		e.plain = bufio.NewReader(e.in)
+		return e.readPlain()
+	}
+	defer restore()
+
+	s := &state{editor: e, prompt: prompt, historyPos: len(e.history)}
+	line, err := s.run()
+	fmt.Fprint(e.out, "\r\n")
+	if err == nil && strings.TrimSpace(line) != "" {
+		e.history = append(e.history, line)
+	}
+	return line, err
+}
+
+func (e *Editor) readPlain() (string, error) {
+	line, err := e.plain.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readByte returns the next input byte
+func (e *Editor) readByte() (byte, error) {
+	if len(e.pending) == 0 {
+		buf := make([]byte, 256)
+		n, err := e.in.Read(buf)
+		if n == 0 {
+			if err == nil {
+				err = io.EOF
+			}
+			return 0, err
+		}
+		e.pending = buf[:n]
+	}
+	c := e.pending[0]
+	e.pending = e.pending[1:]
+	return c, nil
+}
+
+// state is one line being edited
+type state struct {
+	editor     *Editor
+	prompt     string
+	line       []rune
+	cursor     int
+	historyPos int
+	draft      []rune // the new line while browsing history
+}
+
+func (s *state) run() (string, error) {
+	e := s.editor
+	for {
+		c, err := e.readByte()
+		if err != nil {
+			return "", err
+		}
+
+		switch c {
+		case '\r', '\n':
+			return string(s.line), nil
+		case 3: // Ctrl+C
+			return "", ErrInterrupted
+		case 4: // Ctrl+D
+			if len(s.line) == 0 {
+				return "", io.EOF
+			}
+		case 1: // Ctrl+A
+			s.cursor = 0
+		case 5: // Ctrl+E
+			s.cursor = len(s.line)
+		case 21: // Ctrl+U
+			s.line = s.line[s.cursor:]
+			s.cursor = 0
+		case 11: // Ctrl+K
+			s.line = s.line[:s.cursor]
+		case 127, 8: // Backspace
+			if s.cursor > 0 {
+				s.line = append(s.line[:s.cursor-1], s.line[s.cursor:]...)
+				s.cursor--
+			}
+		case '\t':
+			s.completeWord()
+		case 27:
+			s.escape()
+		default:
+			if c < 32 {
+				continue
+			}
+			s.insert(s.decode(c))
+		}
+		s.redraw()
+	}
+}
+
+// decode reads the rest of a UTF-8 sequence starting with c
+func (s *state) decode(c byte) rune {
+	buf := []byte{c}
+	for !utf8.FullRune(buf) && len(buf) < utf8.UTFMax {
+		next, err := s.editor.readByte()
+		if err != nil {
+			break
+		}
+		buf = append(buf, next)
+	}
+	r, _ := utf8.DecodeRune(buf)
+	return r
+}
+
+func (s *state) insert(runes ...rune) {
+	tail := append([]rune{}, s.line[s.cursor:]...)
+	s.line = append(append(s.line[:s.cursor], runes...), tail...)
+	s.cursor += len(runes)
+}
+
+// escape handles arrow keys and similar escape sequences
+func (s *state) escape() {
+	e := s.editor
+	b, err := e.readByte()
+	if err != nil || (b != '[' && b != 'O') {
+		return
+	}
+	// Sequences such as ESC [ 3 ~ carry parameters before the final byte
+	var params []byte
+	code, err := e.readByte()
+	for err == nil && (code >= '0' && code <= '9' || code == ';') {
+		params = append(params, code)
+		code, err = e.readByte()
+	}
+	if err != nil {
+		return
+	}
+	if code == '~' {
+		switch string(params) {
+		case "3": // Delete
+			if s.cursor < len(s.line) {
+				s.line = append(s.line[:s.cursor], s.line[s.cursor+1:]...)
+			}
+		case "1", "7": // Home
+			s.cursor = 0
+		case "4", "8": // End
+			s.cursor = len(s.line)
+		}
+		return
+	}
+
+	switch code {
+	case 'C':
+		if s.cursor < len(s.line) {
+			s.cursor++
+		}
+	case 'D':
+		if s.cursor > 0 {
+			s.cursor--
+		}
+	case 'H':
+		s.cursor = 0
+	case 'F':
+		s.cursor = len(s.line)
+	case 'A':
+		s.browse(-1)
+	case 'B':
+		s.browse(1)
+	}
+}
+
+// browse moves through the history by delta entries
+func (s *state) browse(delta int) {
+	history := s.editor.history
+	pos := s.historyPos + delta
+	if pos < 0 || pos > len(history) {
+		return
+	}
+	if s.historyPos == len(history) {
+		s.draft = append([]rune{}, s.line...)
+	}
+	s.historyPos = pos
+	if pos == len(history) {
+		s.line = append([]rune{}, s.draft...)
+	} else {
+		s.line = []rune(history[pos])
+	}
+	s.cursor = len(s.line)
+}
+
+// completeWord completes the word before the cursor. A single candidate
+// replaces the word; several are narrowed to their common prefix, or listed
+// when that does not add anything.
+func (s *state) completeWord() {
+	if s.editor.complete == nil {
+		return
+	}
+	start := s.cursor
+	for start > 0 && s.line[start-1] != ' ' {
+		start--
+	}
+	word := string(s.line[start:s.cursor])
+	candidates := s.editor.complete(string(s.line[:s.cursor]), word)
+	if len(candidates) == 0 {
+		return
+	}
+
+	replacement := commonPrefix(candidates)
+	if len(candidates) == 1 && !strings.HasSuffix(replacement, "/") {
+		replacement += " "
+	}
+	if replacement != word && strings.HasPrefix(replacement, word) {
+		s.insert([]rune(replacement[len(word):])...)
+		return
+	}
+
+	if len(candidates) > 1 {
+		fmt.Fprintf(s.editor.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	}
+}
+
+// redraw prints the prompt and line and puts the cursor in place
+func (s *state) redraw() {
+	out := s.editor.out
+	// The prompt may start with a newline that was already printed
+	prompt := s.prompt[strings.LastIndex(s.prompt, "\n")+1:]
+	fmt.Fprintf(out, "\r%s%s\033[K", prompt, string(s.line))
+	if back := len(s.line) - s.cursor; back > 0 {
+		fmt.Fprintf(out, "\033[%dD", back)
+	}
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
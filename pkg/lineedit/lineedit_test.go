@@ -0,0 +1,113 @@
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// edit runs the line editor on input as if it were typed
+func edit(t *testing.T, input string, history []string, complete Completer) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	w.WriteString(input)
+	w.Close()
+
+	e := &Editor{complete: complete, in: r, out: io.Discard, history: history}
+	s := &state{editor: e, prompt: "> ", historyPos: len(history)}
+	return s.run()
+}
+
+func TestEditing(t *testing.T) {
+	files := func(line, word string) []string {
+		var matches []string
+		for _, c := range []string{"@main.go", "@pkg/a.go", "@pkg/b.go"} {
+			if strings.HasPrefix(c, word) {
+				matches = append(matches, c)
+			}
+		}
+		return matches
+	}
+	history := []string{"first", "second"}
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		err   error
+	}{
+		{name: "typed line", input: "abc\r", want: "abc"},
+		{name: "newline ends the line", input: "abc\n", want: "abc"},
+		{name: "backspace", input: "abd\x7fc\r", want: "abc"},
+		{name: "left arrow", input: "ac\x1b[Db\r", want: "abc"},
+		{name: "right arrow", input: "ac\x1b[D\x1b[Cb\r", want: "acb"},
+		{name: "home and end keys", input: "bc\x1b[Ha\x1b[Fd\r", want: "abcd"},
+		{name: "home and end with parameters", input: "bc\x1b[1~a\x1b[4~d\r", want: "abcd"},
+		{name: "ctrl a and ctrl e", input: "bc\x01a\x05d\r", want: "abcd"},
+		{name: "ctrl u deletes before the cursor", input: "abc\x1b[D\x15\r", want: "c"},
+		{name: "ctrl k deletes after the cursor", input: "abc\x1b[D\x0b\r", want: "ab"},
+		{name: "delete key", input: "abc\x01\x1b[3~\r", want: "bc"},
+		{name: "utf-8", input: "h\xc3\xa9llo\x1b[D\x1b[D\x1b[D\x7f\r", want: "hllo"},
+		{name: "other control characters are ignored", input: "a\x02b\r", want: "ab"},
+		{name: "previous history entry", input: "\x1b[A\r", want: "second"},
+		{name: "older history entry", input: "\x1b[A\x1b[A\x1b[A\r", want: "first"},
+		{name: "back to the draft", input: "dr\x1b[A\x1b[A\x1b[B\x1b[B\r", want: "dr"},
+		{name: "edit a history entry", input: "\x1b[A!\r", want: "second!"},
+		{name: "single completion", input: "see @ma\t\r", want: "see @main.go "},
+		{name: "common prefix of completions", input: "@p\t\r", want: "@pkg/"},
+		{name: "ambiguous completion", input: "@pkg/\t\r", want: "@pkg/"},
+		{name: "completion before the cursor", input: "@m x\x1b[D\x1b[D\t\r", want: "@main.go  x"},
+		{name: "ctrl c", input: "abc\x03", err: ErrInterrupted},
+		{name: "ctrl d on an empty line", input: "\x04", err: io.EOF},
+		{name: "ctrl d with text", input: "a\x04b\r", want: "ab"},
+		{name: "end of input", input: "abc", err: io.EOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := edit(t, tt.input, history, files)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("run() error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("run() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadLinePlain(t *testing.T) {
+	e := &Editor{out: io.Discard, plain: bufio.NewReader(strings.NewReader("one\r\ntwo\nthree"))}
+	for _, want := range []string{"one", "two", "three"} {
+		if got, err := e.ReadLine("> "); err != nil || got != want {
+			t.Errorf("ReadLine() = %q, %v, want %q", got, err, want)
+		}
+	}
+	if _, err := e.ReadLine("> "); err != io.EOF {
+		t.Errorf("ReadLine() at the end error = %v, want io.EOF", err)
+	}
+}
+
+func TestCommonPrefix(t *testing.T) {
+	tests := []struct {
+		words []string
+		want  string
+	}{
+		{[]string{"abc"}, "abc"},
+		{[]string{"abc", "abd"}, "ab"},
+		{[]string{"abc", "xyz"}, ""},
+		{[]string{"héllo", "hèllo"}, "h"},
+	}
+	for _, tt := range tests {
+		if got := commonPrefix(tt.words); got != tt.want {
+			t.Errorf("commonPrefix(%q) = %q, want %q", tt.words, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package lineedit
+
+import "errors"
+
+// Raw terminal mode is only implemented on Linux; other platforms read
+// plain lines without completion
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
@@ -0,0 +1,199 @@
+package patch
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Block replaces the text matched by Search with Replace. Search must
+// identify exactly one location in the file.
+type Block struct {
+	Search  string `json:"search"`
+	Replace string `json:"replace"`
+}
+
+// Failure describes why a single block could not be applied
+type Failure struct {
+	Index  int // 0-based index of the block
+	Reason string
+}
+
+// Error reports every block that failed to apply
+type Error struct {
+	Failures []Failure
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("%d of the patch blocks could not be applied:", len(e.Failures)))
+	for _, f := range e.Failures {
+		b.WriteString(fmt.Sprintf("\n- block %d: %s", f.Index+1, f.Reason))
+	}
+	return b.String()
+}
+
+// Apply applies the blocks in order and returns the patched content. If any
+// block is missing or ambiguous nothing is applied and an *Error lists the
+// failures.
+func Apply(content string, blocks []Block) (string, error) {
+	if len(blocks) == 0 {
+		return "", fmt.Errorf("no patch blocks given")
+	}
+
+	report := &Error{}
+	for i, block := range blocks {
+		patched, reason := applyBlock(content, block)
+		if reason != "" {
+			report.Failures = append(report.Failures, Failure{Index: i, Reason: reason})
+			continue
+		}
+		content = patched
+	}
+
+	if len(report.Failures) > 0 {
+		return "", report
+	}
+	return content, nil
+}
+
+// applyBlock applies a single block, first as an exact match and then with
+// whitespace-insensitive line matching. It returns a reason on failure.
+func applyBlock(content string, block Block) (string, string) {
+	if strings.TrimSpace(block.Search) == "" {
+		return "", "search text is empty"
+	}
+
+	// Exact match
+	switch count := strings.Count(content, block.Search); {
+	case count == 1:
+		return strings.Replace(content, block.Search, block.Replace, 1), ""
+	case count > 1:
+		return "", fmt.Sprintf("search text is ambiguous, it matches %d locations at lines %s; "+
+			"include more surrounding lines", count, joinLines(exactMatchLines(content, block.Search)))
+	}
+
+	// Fuzzy match on lines, ignoring indentation and trailing whitespace
+	lines := strings.SplitAfter(content, "\n")
+	search := trimBlankLines(strings.Split(strings.TrimRight(block.Search, "\n"), "\n"))
+	if len(search) == 0 {
+		return "", "search text is empty"
+	}
+
+	var matches []int
+	for i := 0; i+len(search) <= len(lines); i++ {
+		if linesMatch(lines[i:i+len(search)], search) {
+			matches = append(matches, i)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", notFoundReason(lines, search)
+	case 1:
+	default:
+		var at []int
+		for _, m := range matches {
+			at = append(at, m+1)
+		}
+		return "", fmt.Sprintf("search text is ambiguous, it matches %d locations at lines %s; "+
+			"include more surrounding lines", len(matches), joinLines(at))
+	}
+
+	start := matches[0]
+	end := start + len(search)
+	replacement := reindent(block.Replace, leadingSpace(search[0]), leadingSpace(lines[start]))
+	if replacement != "" && !strings.HasSuffix(replacement, "\n") && strings.HasSuffix(lines[end-1], "\n") {
+		replacement += "\n"
+	}
+
+	return strings.Join(lines[:start], "") + replacement + strings.Join(lines[end:], ""), ""
+}
+
+// linesMatch compares lines ignoring surrounding whitespace
+func linesMatch(lines, search []string) bool {
+	for i := range search {
+		if strings.TrimSpace(lines[i]) != strings.TrimSpace(search[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// notFoundReason describes a missing anchor and points at the closest candidate
+func notFoundReason(lines, search []string) string {
+	best, bestScore := -1, 0
+	for i := 0; i+len(search) <= len(lines); i++ {
+		score := 0
+		for j := range search {
+			if strings.TrimSpace(lines[i+j]) == strings.TrimSpace(search[j]) {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	reason := "search text not found"
+	if best >= 0 {
+		reason += fmt.Sprintf("; the closest match starts at line %d where %d of %d lines match",
+			best+1, bestScore, len(search))
+	}
+	return reason
+}
+
+// trimBlankLines drops blank lines at the start and end of lines
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func leadingSpace(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// reindent replaces the from indentation prefix with to on every line of text,
+// so a replacement written with the wrong indentation fits the matched code
+func reindent(text, from, to string) string {
+	if from == to {
+		return text
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, from) {
+			lines[i] = to + line[len(from):]
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// exactMatchLines returns the 1-based line numbers where search occurs
+func exactMatchLines(content, search string) []int {
+	var at []int
+	offset := 0
+	for {
+		i := strings.Index(content[offset:], search)
+		if i < 0 {
+			return at
+		}
+		at = append(at, strings.Count(content[:offset+i], "\n")+1)
+		offset += i + 1
+	}
+}
+
+func joinLines(lines []int) string {
+	parts := make([]string, len(lines))
+	for i, l := range lines {
+		parts[i] = fmt.Sprintf("%d", l)
+	}
+	return strings.Join(parts, ", ")
+}
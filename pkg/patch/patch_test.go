@@ -0,0 +1,107 @@
+package patch
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	const source = "func main() {\n\tif ok {\n\t\trun()\n\t}\n}\n"
+
+	tests := []struct {
+		name    string
+		content string
+		blocks  []Block
+		want    string
+		err     string // substring of the error, if one is expected
+	}{
+		{
+			name:    "exact match",
+			content: source,
+			blocks:  []Block{{Search: "\t\trun()\n", Replace: "\t\trun()\n\t\tstop()\n"}},
+			want:    "func main() {\n\tif ok {\n\t\trun()\n\t\tstop()\n\t}\n}\n",
+		},
+		{
+			name:    "anchor with different indentation is reindented",
+			content: source,
+			blocks:  []Block{{Search: "if ok {\n\trun()\n}", Replace: "if ok {\n\trun()\n} else {\n\twait()\n}"}},
+			want:    "func main() {\n\tif ok {\n\t\trun()\n\t} else {\n\t\twait()\n\t}\n}\n",
+		},
+		{
+			name:    "trailing whitespace and blank lines around the anchor are ignored",
+			content: "a := 1   \nb := 2\n",
+			blocks:  []Block{{Search: "\n\na := 1\nb := 2\n\n", Replace: "a := 3\nb := 4"}},
+			want:    "a := 3\nb := 4\n",
+		},
+		{
+			name:    "blocks apply in order",
+			content: "one\ntwo\n",
+			blocks:  []Block{{Search: "one", Replace: "uno"}, {Search: "uno\ntwo", Replace: "uno\ndos"}},
+			want:    "uno\ndos\n",
+		},
+		{
+			name:    "ambiguous exact match",
+			content: "x++\ny++\nx++\n",
+			blocks:  []Block{{Search: "x++", Replace: "x--"}},
+			err:     "matches 2 locations at lines 1, 3",
+		},
+		{
+			name:    "ambiguous fuzzy match",
+			content: "\tx++\n  x++\n",
+			blocks:  []Block{{Search: "x++ ", Replace: "x--"}},
+			err:     "matches 2 locations at lines 1, 2",
+		},
+		{
+			name:    "missing anchor points at the closest match",
+			content: "a\nb\nc\nd\n",
+			blocks:  []Block{{Search: "b\nc\nz", Replace: "q"}},
+			err:     "closest match starts at line 2 where 2 of 3 lines match",
+		},
+		{
+			name:    "empty search",
+			content: source,
+			blocks:  []Block{{Search: " \n", Replace: "x"}},
+			err:     "search text is empty",
+		},
+		{
+			name:    "no blocks",
+			content: source,
+			err:     "no patch blocks given",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(tt.content, tt.blocks)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Apply() error = %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Apply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyReportsEveryFailure(t *testing.T) {
+	_, err := Apply("a\nb\n", []Block{
+		{Search: "missing", Replace: "x"},
+		{Search: "a", Replace: "c"},
+		{Search: "also missing", Replace: "y"},
+	})
+
+	var report *Error
+	if !errors.As(err, &report) {
+		t.Fatalf("Apply() error = %v, want *Error", err)
+	}
+	if len(report.Failures) != 2 || report.Failures[0].Index != 0 || report.Failures[1].Index != 2 {
+		t.Errorf("failures = %+v, want blocks 0 and 2", report.Failures)
+	}
+}
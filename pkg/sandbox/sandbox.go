@@ -0,0 +1,175 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultDeny lists path patterns that are protected by default. A pattern
+// without a slash matches any single path element, so ".git" covers
+// everything inside the .git directory; a pattern with a slash is matched
+// against the start of the workspace-relative path.
+var DefaultDeny = []string{
+	".git",
+	".caia",
+	".env",
+	".env.*",
+	"*.pem",
+	"*.key",
+	"*.p12",
+	"*.pfx",
+	"id_rsa*",
+	"id_dsa*",
+	"id_ecdsa*",
+	"id_ed25519*",
+	".ssh",
+	".aws",
+	".netrc",
+	".npmrc",
+	".pypirc",
+}
+
+// Violation explains why a path was refused
+type Violation struct {
+	Path   string
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("refusing to access %q: %s", v.Path, v.Reason)
+}
+
+// Sandbox confines paths to a workspace root
+type Sandbox struct {
+	root string
+	deny []string
+}
+
+// New creates a sandbox rooted at root. Symlinks in root itself are resolved
+// so that containment checks compare real paths.
+func New(root string, deny []string) (*Sandbox, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving workspace root: %v", err)
+	}
+	return &Sandbox{root: real, deny: deny}, nil
+}
+
+// Root returns the absolute workspace root
+func (s *Sandbox) Root() string {
+	return s.root
+}
+
+// Resolve validates name and returns it as a clean path relative to the
+// workspace root. It returns a *Violation when the path leaves the workspace,
+// directly or through a symlink, or matches a protected pattern.
+func (s *Sandbox) Resolve(name string) (string, error) {
+	if strings.TrimSpace(name) == "" {
+		return "", &Violation{Path: name, Reason: "the path is empty"}
+	}
+
+	abs := name
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(s.root, name)
+	}
+	abs = filepath.Clean(abs)
+
+	rel, ok := s.relative(abs)
+	if !ok {
+		return "", &Violation{Path: name, Reason: "it is outside the workspace " + s.root}
+	}
+	if rel == "." {
+		return "", &Violation{Path: name, Reason: "it is the workspace root itself"}
+	}
+
+	real, err := resolveExisting(abs)
+	if err != nil {
+		return "", &Violation{Path: name, Reason: fmt.Sprintf("it could not be resolved: %v", err)}
+	}
+	realRel, ok := s.relative(real)
+	if !ok {
+		return "", &Violation{Path: name, Reason: "it resolves through a symlink to " + real + ", outside the workspace"}
+	}
+
+	for _, p := range []string{rel, realRel} {
+		if pattern := s.denied(p); pattern != "" {
+			return "", &Violation{Path: name, Reason: fmt.Sprintf("it matches the protected pattern %q", pattern)}
+		}
+	}
+	return rel, nil
+}
+
+// Allowed reports whether a workspace-relative path is outside the deny-list
+func (s *Sandbox) Allowed(rel string) bool {
+	return s.denied(rel) == ""
+}
+
+// relative returns abs relative to the root and whether it lies inside it
+func (s *Sandbox) relative(abs string) (string, bool) {
+	rel, err := filepath.Rel(s.root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// denied returns the first deny pattern matching rel, or ""
+func (s *Sandbox) denied(rel string) string {
+	rel = filepath.ToSlash(rel)
+	elements := strings.Split(rel, "/")
+
+	for _, pattern := range s.deny {
+		pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+		if pattern == "" {
+			continue
+		}
+
+		if strings.Contains(pattern, "/") {
+			// Match the pattern against leading path elements
+			n := strings.Count(pattern, "/") + 1
+			if len(elements) >= n {
+				if ok, _ := filepath.Match(pattern, strings.Join(elements[:n], "/")); ok {
+					return pattern
+				}
+			}
+			continue
+		}
+
+		for _, element := range elements {
+			if ok, _ := filepath.Match(pattern, element); ok {
+				return pattern
+			}
+		}
+	}
+	return ""
+}
+
+// resolveExisting resolves symlinks in the longest existing prefix of abs and
+// appends the components that do not exist yet
+func resolveExisting(abs string) (string, error) {
+	existing := abs
+	var rest []string
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		rest = append([]string{filepath.Base(existing)}, rest...)
+		existing = parent
+	}
+
+	real, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(append([]string{real}, rest...)...), nil
+}
@@ -0,0 +1,140 @@
+package sandbox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setup creates a workspace with symlinks into and out of it and returns the
+// workspace root and a directory outside it
+func setup(t *testing.T) (string, string) {
+	t.Helper()
+	base := t.TempDir()
+	root := filepath.Join(base, "workspace")
+	outside := filepath.Join(base, "outside")
+
+	for _, dir := range []string{filepath.Join(root, "sub"), filepath.Join(root, ".git"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(root, "sub", "file.txt"), filepath.Join(outside, "secret.txt")} {
+		if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"link_out":      outside,
+		"link_file_out": filepath.Join(outside, "secret.txt"),
+		"link_in":       filepath.Join(root, "sub"),
+		"link_git":      filepath.Join(root, ".git"),
+		"link_up":       "..",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+	return root, outside
+}
+
+func TestResolve(t *testing.T) {
+	root, outside := setup(t)
+	s, err := New(root, append(DefaultDeny, "config/secrets/*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		want   string
+		reason string // substring of the violation, if one is expected
+	}{
+		{name: "existing file", path: "sub/file.txt", want: filepath.Join("sub", "file.txt")},
+		{name: "new file", path: "sub/new/file.go", want: filepath.Join("sub", "new", "file.go")},
+		{name: "dot dot inside the workspace", path: "sub/../main.go", want: "main.go"},
+		{name: "absolute path inside", path: filepath.Join(root, "sub", "file.txt"), want: filepath.Join("sub", "file.txt")},
+		{name: "symlink inside the workspace", path: "link_in/file.txt", want: filepath.Join("link_in", "file.txt")},
+
+		{name: "empty", path: " ", reason: "empty"},
+		{name: "root itself", path: ".", reason: "workspace root itself"},
+		{name: "parent directory", path: "..", reason: "outside the workspace"},
+		{name: "dot dot escape", path: "../outside/secret.txt", reason: "outside the workspace"},
+		{name: "nested dot dot escape", path: "sub/../../outside/secret.txt", reason: "outside the workspace"},
+		{name: "absolute path outside", path: filepath.Join(outside, "secret.txt"), reason: "outside the workspace"},
+		{name: "symlinked directory outside", path: "link_out/secret.txt", reason: "through a symlink"},
+		{name: "new file below a symlink outside", path: "link_out/new/file.txt", reason: "through a symlink"},
+		{name: "symlinked file outside", path: "link_file_out", reason: "through a symlink"},
+		{name: "relative symlink to the parent", path: "link_up/outside/secret.txt", reason: "through a symlink"},
+		{name: "protected directory", path: ".git/config", reason: `".git"`},
+		{name: "symlink to a protected directory", path: "link_git/config", reason: `".git"`},
+		{name: "protected element in a subdirectory", path: "sub/.env", reason: `".env"`},
+		{name: "protected extension", path: "certs/server.pem", reason: `"*.pem"`},
+		{name: "protected path pattern", path: "config/secrets/prod.json", reason: `"config/secrets/*"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Resolve(tt.path)
+			if tt.reason != "" {
+				var v *Violation
+				if !errors.As(err, &v) || !strings.Contains(v.Reason, tt.reason) {
+					t.Fatalf("Resolve(%q) = %q, %v, want a violation containing %q", tt.path, got, err, tt.reason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve(%q) error = %v", tt.path, err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveWithSymlinkedRoot(t *testing.T) {
+	root, _ := setup(t)
+	link := filepath.Join(t.TempDir(), "ws")
+	if err := os.Symlink(root, link); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+
+	s, err := New(link, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Resolve("sub/file.txt"); err != nil || got != filepath.Join("sub", "file.txt") {
+		t.Errorf("Resolve() = %q, %v, want sub/file.txt", got, err)
+	}
+	if _, err := s.Resolve("link_out/secret.txt"); err == nil {
+		t.Error("Resolve() of a symlink outside the workspace succeeded")
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	s := &Sandbox{deny: []string{".git", "*.key", "build/out/"}}
+
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{"main.go", true},
+		{".gitignore", true},
+		{".git", false},
+		{"vendor/.git/HEAD", false},
+		{"keys/server.key", false},
+		{"build/out/app", false},
+		{"build/output", true},
+		{"src/build/out/app", true},
+	}
+	for _, tt := range tests {
+		if got := s.Allowed(tt.rel); got != tt.want {
+			t.Errorf("Allowed(%q) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+}
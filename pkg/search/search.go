@@ -0,0 +1,160 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"caia-ai-cli/pkg/language"
+)
+
+// MaxFileSize is the largest file that is searched
+const MaxFileSize = 4 << 20
+
+// maxLineLength is where long lines are cut in snippets
+const maxLineLength = 300
+
+// Options describe a search
+type Options struct {
+	Pattern string
+	// Literal matches Pattern as plain text instead of a regular expression
+	Literal    bool
+	IgnoreCase bool
+	// Context is the number of lines shown around each match
+	Context int
+}
+
+// Snippet is a run of lines around one or more matches
+type Snippet struct {
+	// Start is the line number of the first line
+	Start int
+	Lines []string
+	// Matches holds the line numbers of the matching lines
+	Matches []int
+}
+
+// Searcher finds matching lines in files
+type Searcher struct {
+	re      *regexp.Regexp
+	context int
+}
+
+// New compiles the pattern in opts
+func New(opts Options) (*Searcher, error) {
+	if opts.Pattern == "" {
+		return nil, fmt.Errorf("the search pattern is empty")
+	}
+
+	expr := opts.Pattern
+	if opts.Literal {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if opts.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %v", err)
+	}
+
+	context := opts.Context
+	if context < 0 {
+		context = 0
+	}
+	return &Searcher{re: re, context: context}, nil
+}
+
+// File returns the snippets of a file, with overlapping context merged.
+// Binary files and files over MaxFileSize have none.
+func (s *Searcher) File(path string) ([]Snippet, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > MaxFileSize {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if language.IsBinary(data) {
+		return nil, nil
+	}
+	return s.Text(data), nil
+}
+
+// Text returns the snippets of data, with overlapping context merged
+func (s *Searcher) Text(data []byte) []Snippet {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), MaxFileSize)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	var snippets []Snippet
+	end := -1 // index of the last line in the current snippet
+	for i, line := range lines {
+		if !s.re.MatchString(line) {
+			continue
+		}
+
+		from := max(i-s.context, 0)
+		to := min(i+s.context, len(lines)-1)
+		if len(snippets) == 0 || from > end+1 {
+			snippets = append(snippets, Snippet{Start: from + 1})
+		} else {
+			from = end + 1
+		}
+
+		current := &snippets[len(snippets)-1]
+		for j := from; j <= to; j++ {
+			current.Lines = append(current.Lines, clip(lines[j]))
+		}
+		current.Matches = append(current.Matches, i+1)
+		end = max(end, to)
+	}
+	return snippets
+}
+
+// Format renders snippets like grep -n: matching lines as path:N: and
+// context lines as path-N-, with -- between snippets
+func Format(path string, snippets []Snippet) string {
+	var b strings.Builder
+	for i, s := range snippets {
+		if i > 0 {
+			b.WriteString("--\n")
+		}
+		matched := make(map[int]bool, len(s.Matches))
+		for _, m := range s.Matches {
+			matched[m] = true
+		}
+		for j, line := range s.Lines {
+			n := s.Start + j
+			sep := "-"
+			if matched[n] {
+				sep = ":"
+			}
+			fmt.Fprintf(&b, "%s%s%d%s %s\n", path, sep, n, sep, line)
+		}
+	}
+	return b.String()
+}
+
+// clip shortens long lines, such as minified code, on a rune boundary
+func clip(line string) string {
+	if len(line) <= maxLineLength {
+		return line
+	}
+	n := maxLineLength
+	for n > 0 && !utf8.RuneStart(line[n]) {
+		n--
+	}
+	return line[:n] + "..."
+}
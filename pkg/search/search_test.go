@@ -0,0 +1,117 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	const text = "func Open() {}\nfunc open() {}\nvar a.b = 1\nvar axb = 2\n\n\n\n\nfunc OpenFile() {}\n"
+
+	tests := []struct {
+		name string
+		opts Options
+		want []Snippet
+	}{
+		{
+			name: "regular expression",
+			opts: Options{Pattern: `^func [A-Z]`},
+			want: []Snippet{
+				{Start: 1, Lines: []string{"func Open() {}"}, Matches: []int{1}},
+				{Start: 9, Lines: []string{"func OpenFile() {}"}, Matches: []int{9}},
+			},
+		},
+		{
+			name: "pattern is a regular expression by default",
+			opts: Options{Pattern: "a.b"},
+			want: []Snippet{{Start: 3, Lines: []string{"var a.b = 1", "var axb = 2"}, Matches: []int{3, 4}}},
+		},
+		{
+			name: "literal",
+			opts: Options{Pattern: "a.b", Literal: true},
+			want: []Snippet{{Start: 3, Lines: []string{"var a.b = 1"}, Matches: []int{3}}},
+		},
+		{
+			name: "literal with regular expression syntax",
+			opts: Options{Pattern: "Open()", Literal: true},
+			want: []Snippet{{Start: 1, Lines: []string{"func Open() {}"}, Matches: []int{1}}},
+		},
+		{
+			name: "case sensitive by default",
+			opts: Options{Pattern: "func open"},
+			want: []Snippet{{Start: 2, Lines: []string{"func open() {}"}, Matches: []int{2}}},
+		},
+		{
+			name: "ignore case",
+			opts: Options{Pattern: "func open(", Literal: true, IgnoreCase: true},
+			want: []Snippet{{Start: 1, Lines: []string{"func Open() {}", "func open() {}"}, Matches: []int{1, 2}}},
+		},
+		{
+			name: "overlapping context is merged",
+			opts: Options{Pattern: "^func", Context: 1},
+			want: []Snippet{
+				{Start: 1, Lines: []string{"func Open() {}", "func open() {}", "var a.b = 1"}, Matches: []int{1, 2}},
+				{Start: 8, Lines: []string{"", "func OpenFile() {}"}, Matches: []int{9}},
+			},
+		},
+		{
+			name: "no match",
+			opts: Options{Pattern: "missing"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Text([]byte(text)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Text() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(Options{}); err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Errorf("New() with no pattern error = %v", err)
+	}
+	if _, err := New(Options{Pattern: "a("}); err == nil || !strings.Contains(err.Error(), "invalid pattern") {
+		t.Errorf("New() with an invalid pattern error = %v", err)
+	}
+	if _, err := New(Options{Pattern: "a(", Literal: true}); err != nil {
+		t.Errorf("New() with a literal pattern error = %v", err)
+	}
+}
+
+func TestFileSkipsBinaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "data.bin")
+	if err := os.WriteFile(binary, []byte("match\x00match\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(Options{Pattern: "match"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snippets, err := s.File(binary); err != nil || snippets != nil {
+		t.Errorf("File() of a binary file = %v, %v, want no snippets", snippets, err)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	snippets := []Snippet{
+		{Start: 1, Lines: []string{"a", "match"}, Matches: []int{2}},
+		{Start: 9, Lines: []string{"match " + strings.Repeat("x", maxLineLength)}, Matches: []int{9}},
+	}
+	snippets[1].Lines[0] = clip(snippets[1].Lines[0])
+
+	want := "f.go-1- a\nf.go:2: match\n--\nf.go:9: match " + strings.Repeat("x", maxLineLength-6) + "...\n"
+	if got := Format("f.go", snippets); got != want {
+		t.Errorf("Format() = %q, want %q", got, want)
+	}
+}
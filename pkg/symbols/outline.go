@@ -0,0 +1,65 @@
+package symbols
+
+import "sync"
+
+// Outline is what an extractor finds in one source file
+type Outline struct {
+	// Package is the package or module the file declares, if any
+	Package string
+	Symbols []Symbol
+}
+
+// Extractor finds the declarations of a source file. Extractors should
+// return what they could find even when the file does not parse.
+type Extractor interface {
+	Extract(filename string, src []byte) (Outline, error)
+}
+
+// ExtractorFunc adapts a function to the Extractor interface
+type ExtractorFunc func(filename string, src []byte) (Outline, error)
+
+// Extract calls f
+func (f ExtractorFunc) Extract(filename string, src []byte) (Outline, error) {
+	return f(filename, src)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Extractor)
+)
+
+// Register makes an extractor available for a language, replacing any
+// extractor registered for it before. Language names are those the index
+// assigns, e.g. "Go" or "Python".
+func Register(language string, e Extractor) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[language] = e
+}
+
+// For returns the extractor registered for language
+func For(language string) (Extractor, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	e, ok := registry[language]
+	return e, ok
+}
+
+func init() {
+	Register("Go", ExtractorFunc(func(filename string, src []byte) (Outline, error) {
+		pkg, symbols, err := ParseGo(filename, src)
+		return Outline{Package: pkg, Symbols: symbols}, err
+	}))
+	Register("Python", pythonExtractor)
+	Register("JavaScript", javaScriptExtractor)
+	Register("TypeScript", typeScriptExtractor)
+	Register("Java", javaExtractor)
+	Register("Rust", rustExtractor)
+	Register("C", cExtractor)
+	Register("C++", cppExtractor)
+	Register("C#", csharpExtractor)
+	Register("Ruby", rubyExtractor)
+	Register("PHP", phpExtractor)
+	Register("Swift", swiftExtractor)
+	Register("Kotlin", kotlinExtractor)
+}
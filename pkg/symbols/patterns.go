@@ -0,0 +1,497 @@
+package symbols
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// rule recognizes one kind of declaration on a single line. The name group
+// captures the declared name; an optional kind group overrides the rule's
+// kind, and an optional trait group names the trait an impl implements.
+type rule struct {
+	kind string
+	re   *regexp.Regexp
+	// container marks declarations whose functions become its methods
+	container bool
+	// member rules only apply directly inside a container
+	member bool
+	// constructor rules only match the name of the enclosing container
+	constructor bool
+}
+
+// blockStyle decides how the end of a declaration is found
+type blockStyle int
+
+const (
+	// braces: the declaration ends where its outermost {} block closes, or
+	// at a ; before any block opens
+	braces blockStyle = iota
+	// indentation: the declaration ends before the next line that is not
+	// indented deeper than the declaration itself
+	indentation
+	// endKeyword: the declaration ends at the end keyword indented like it,
+	// as in Ruby, or before the next line that is not indented deeper
+	endKeyword
+)
+
+// endLine matches the end keyword that closes a block in endKeyword style
+var endLine = regexp.MustCompile(`^\s*end\b`)
+
+// syntax describes the comments and strings to skip when matching braces
+type syntax struct {
+	lineComment  string
+	blockComment bool // /* ... */
+	tripleQuotes bool // Python's """ and ''' strings
+	backticks    bool // JavaScript template literals
+	// charQuotes means single quotes only delimit short character literals,
+	// as in Java and Rust where 'a may also be a lifetime
+	charQuotes bool
+}
+
+// patternExtractor outlines languages without a parser in the standard
+// library using line-based rules. It finds top-level declarations and the
+// members of classes, skipping anything nested in function bodies.
+type patternExtractor struct {
+	rules  []rule
+	block  blockStyle
+	syntax syntax
+	// pkg captures the package declaration in its name group, if any
+	pkg *regexp.Regexp
+	// noBlock matches declarations that have no {} block when their line
+	// has no {, such as Kotlin's expression bodies and Swift's protocol
+	// requirements; they end by indentation instead
+	noBlock *regexp.Regexp
+}
+
+// keywords are never declaration names; they catch control statements that
+// look like method headers
+var keywords = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "catch": true,
+	"return": true, "new": true, "else": true, "do": true, "try": true,
+	"match": true, "loop": true, "with": true, "function": true,
+	"sizeof": true, "func": true, "var": true, "let": true,
+}
+
+// maxBlockSearch is how many lines after a declaration its block may open
+const maxBlockSearch = 20
+
+// container is an enclosing declaration while scanning
+type container struct {
+	receiver string
+	end      int
+}
+
+// Extract implements Extractor
+func (p *patternExtractor) Extract(filename string, src []byte) (Outline, error) {
+	lines := strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+	code, continued := stripLines(lines, p.syntax)
+
+	var outline Outline
+	var stack []container
+	funcEnd := -1
+
+	for i, line := range lines {
+		if continued[i] || strings.TrimSpace(code[i]) == "" {
+			continue
+		}
+		if outline.Package == "" && p.pkg != nil {
+			if m := p.pkg.FindStringSubmatch(line); m != nil {
+				outline.Package = m[p.pkg.SubexpIndex("name")]
+				continue
+			}
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].end < i {
+			stack = stack[:len(stack)-1]
+		}
+		// Skip declarations nested in function bodies
+		if i <= funcEnd {
+			continue
+		}
+
+		for _, r := range p.rules {
+			if r.member && len(stack) == 0 {
+				continue
+			}
+			m := r.re.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			name := m[r.re.SubexpIndex("name")]
+			if name == "" || keywords[name] {
+				continue
+			}
+			if r.constructor && name != stack[len(stack)-1].receiver {
+				continue
+			}
+
+			s := Symbol{Kind: r.kind, Name: name, Line: i + 1}
+			if k := r.re.SubexpIndex("kind"); k >= 0 && m[k] != "" {
+				s.Kind = m[k]
+			}
+			// Methods of Point<'a> are listed as Point.method
+			receiver, _, _ := strings.Cut(name, "<")
+			if t := r.re.SubexpIndex("trait"); t >= 0 && m[t] != "" {
+				s.Name = strings.TrimSpace(m[t]) + " for " + name
+			}
+
+			end := p.end(lines, code, continued, i)
+			s.EndLine = end + 1
+
+			if len(stack) > 0 {
+				s.Receiver = stack[len(stack)-1].receiver
+				if s.Kind == "func" {
+					s.Kind = "method"
+				}
+			}
+			outline.Symbols = append(outline.Symbols, s)
+
+			switch {
+			case r.container:
+				stack = append(stack, container{receiver: receiver, end: end})
+			case s.Kind == "func" || s.Kind == "method":
+				funcEnd = end
+			}
+			break
+		}
+	}
+	return outline, nil
+}
+
+// end returns the index of the last line of the declaration starting at i
+func (p *patternExtractor) end(lines, code []string, continued []bool, i int) int {
+	switch {
+	case p.block == indentation:
+		return indentEnd(lines, code, continued, i)
+	case p.block == endKeyword:
+		indent := indentOf(lines[i])
+		end := i
+		for j := i + 1; j < len(lines); j++ {
+			if strings.TrimSpace(code[j]) == "" || continued[j] {
+				continue
+			}
+			if indentOf(lines[j]) <= indent {
+				// An end further out closes an enclosing block
+				if indentOf(lines[j]) == indent && endLine.MatchString(code[j]) {
+					return j
+				}
+				break
+			}
+			end = j
+		}
+		return end
+	case p.noBlock != nil && !strings.Contains(code[i], "{") && p.noBlock.MatchString(code[i]):
+		return indentEnd(lines, code, continued, i)
+	}
+
+	depth := 0
+	opened := false
+	for j := i; j < len(code); j++ {
+		if !opened && j > i && (j-i > maxBlockSearch || strings.TrimSpace(lines[j]) == "") {
+			// No block follows, e.g. an arrow function with an expression body
+			return i
+		}
+		for _, c := range code[j] {
+			switch c {
+			case '{':
+				depth++
+				opened = true
+			case '}':
+				depth--
+				if opened && depth == 0 {
+					return j
+				}
+			case ';':
+				if !opened {
+					return j
+				}
+			}
+		}
+	}
+	if !opened {
+		return i
+	}
+	return len(lines) - 1
+}
+
+// indentEnd returns the last line indented deeper than line i, or i
+func indentEnd(lines, code []string, continued []bool, i int) int {
+	indent := indentOf(lines[i])
+	end := i
+	for j := i + 1; j < len(lines); j++ {
+		if strings.TrimSpace(code[j]) == "" {
+			continue
+		}
+		if !continued[j] && indentOf(lines[j]) <= indent {
+			break
+		}
+		end = j
+	}
+	return end
+}
+
+// indentOf returns the width of a line's leading whitespace
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// stripLines returns each line with comments and string contents removed,
+// and whether the line starts inside a multi-line string or comment
+func stripLines(lines []string, syn syntax) ([]string, []bool) {
+	code := make([]string, len(lines))
+	continued := make([]bool, len(lines))
+
+	// Delimiter of the string or comment that is still open at the end of
+	// a line: "*/", `"""`, "'''" or "`"
+	open := ""
+
+	for n, line := range lines {
+		continued[n] = open != ""
+		var b strings.Builder
+
+		for i := 0; i < len(line); {
+			if open != "" {
+				if j := strings.Index(line[i:], open); j >= 0 {
+					i += j + len(open)
+					open = ""
+					continue
+				}
+				break
+			}
+
+			rest := line[i:]
+			switch {
+			case syn.lineComment != "" && strings.HasPrefix(rest, syn.lineComment):
+				i = len(line)
+			case syn.blockComment && strings.HasPrefix(rest, "/*"):
+				open = "*/"
+				i += 2
+			case syn.tripleQuotes && (strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, "'''")):
+				open = rest[:3]
+				i += 3
+			case syn.backticks && rest[0] == '`':
+				open = "`"
+				i++
+			case rest[0] == '"' || (rest[0] == '\'' && !syn.charQuotes):
+				i += 1 + stringLength(rest[1:], rest[0])
+				b.WriteString(`""`)
+			case rest[0] == '\'' && syn.charQuotes:
+				// A character literal such as 'x' or '\n', otherwise a
+				// lifetime or label
+				if n := charLength(rest); n > 0 {
+					i += n
+					continue
+				}
+				b.WriteByte('\'')
+				i++
+			default:
+				b.WriteByte(rest[0])
+				i++
+			}
+		}
+		code[n] = b.String()
+	}
+	return code, continued
+}
+
+// charLength returns the length of the character literal s starts with, or
+// 0 if the quote does not start one
+func charLength(s string) int {
+	if strings.HasPrefix(s, `'\`) {
+		if len(s) > 3 {
+			if j := strings.IndexByte(s[3:min(len(s), 14)], '\''); j >= 0 {
+				return j + 4
+			}
+		}
+		return 0
+	}
+	_, size := utf8.DecodeRuneInString(s[1:])
+	if len(s) > 1+size && s[1+size] == '\'' {
+		return size + 2
+	}
+	return 0
+}
+
+// stringLength returns the length of a string literal body up to and
+// including the closing quote, or the rest of the line if it does not close
+func stringLength(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// newRule compiles a declaration rule
+func newRule(kind, pattern string) rule {
+	return rule{kind: kind, re: regexp.MustCompile(pattern)}
+}
+
+func containerRule(kind, pattern string) rule {
+	r := newRule(kind, pattern)
+	r.container = true
+	return r
+}
+
+func memberRule(kind, pattern string) rule {
+	r := newRule(kind, pattern)
+	r.member = true
+	return r
+}
+
+func constructorRule(pattern string) rule {
+	r := memberRule("func", pattern)
+	r.constructor = true
+	return r
+}
+
+var pythonExtractor = &patternExtractor{
+	block:  indentation,
+	syntax: syntax{lineComment: "#", tripleQuotes: true},
+	rules: []rule{
+		containerRule("class", `^\s*class\s+(?P<name>\w+)`),
+		newRule("func", `^\s*(?:async\s+)?def\s+(?P<name>\w+)`),
+	},
+}
+
+// jsMembers are the class member rules shared by JavaScript and TypeScript
+var jsMembers = []rule{
+	memberRule("func", `^\s+(?:(?:static|async|get|set|public|private|protected|readonly|abstract|override|declare)\s+)*\*?(?P<name>#?[A-Za-z_$][\w$]*)\s*(?:<[^>]*>)?\s*\(`),
+	memberRule("func", `^\s+(?:(?:static|public|private|protected|readonly)\s+)*(?P<name>#?[A-Za-z_$][\w$]*)\s*(?::[^=]+)?=\s*(?:async\s+)?(?:\([^)]*\)|[\w$]+)\s*(?::[^=]+)?=>`),
+}
+
+// jsDeclarations are the top-level rules shared by JavaScript and TypeScript
+var jsDeclarations = []rule{
+	containerRule("class", `^\s*(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+(?P<name>[A-Za-z_$][\w$]*)`),
+	newRule("func", `^\s*(?:export\s+)?(?:default\s+)?(?:async\s+)?function\s*\*?\s*(?P<name>[A-Za-z_$][\w$]*)`),
+	newRule("func", `^(?:export\s+)?(?:const|let|var)\s+(?P<name>[A-Za-z_$][\w$]*)\s*(?::[^=]+)?=\s*(?:async\s+)?(?:function\b|\([^)]*\)\s*(?::[^=]+)?=>|[\w$]+\s*=>)`),
+}
+
+var javaScriptExtractor = &patternExtractor{
+	block:  braces,
+	syntax: syntax{lineComment: "//", blockComment: true, backticks: true},
+	rules:  append(append([]rule{}, jsDeclarations...), jsMembers...),
+}
+
+var typeScriptExtractor = &patternExtractor{
+	block:  braces,
+	syntax: syntax{lineComment: "//", blockComment: true, backticks: true},
+	rules: append(append([]rule{
+		containerRule("interface", `^\s*(?:export\s+)?(?:declare\s+)?interface\s+(?P<name>[A-Za-z_$][\w$]*)`),
+		newRule("enum", `^\s*(?:export\s+)?(?:declare\s+)?(?:const\s+)?enum\s+(?P<name>[A-Za-z_$][\w$]*)`),
+		newRule("type", `^\s*(?:export\s+)?(?:declare\s+)?type\s+(?P<name>[A-Za-z_$][\w$]*)\s*(?:<[^>]*>)?\s*=`),
+		newRule("module", `^\s*(?:export\s+)?(?:declare\s+)?(?:namespace|module)\s+(?P<name>[A-Za-z_$][\w$.]*)`),
+	}, jsDeclarations...), jsMembers...),
+}
+
+var javaExtractor = &patternExtractor{
+	block:  braces,
+	syntax: syntax{lineComment: "//", blockComment: true, charQuotes: true},
+	pkg:    regexp.MustCompile(`^\s*package\s+(?P<name>[\w.]+)\s*;`),
+	rules: []rule{
+		containerRule("class", `^\s*(?:@\w+\s+)*(?:(?:public|protected|private|static|final|abstract|sealed|non-sealed|strictfp)\s+)*(?P<kind>class|interface|enum|record)\s+(?P<name>\w+)`),
+		memberRule("func", `^\s+(?:@\w+(?:\([^)]*\))?\s+)*(?:(?:public|protected|private|static|final|abstract|synchronized|native|default|strictfp)\s+)*(?:<[^>]+>\s+)?[\w.$]+(?:<[^()]*>)?(?:\[\])*\s+(?P<name>[A-Za-z_$][\w$]*)\s*\(`),
+		// Constructors have no return type
+		constructorRule(`^\s+(?:(?:public|protected|private)\s+)?(?P<name>[A-Z][\w$]*)\s*\(`),
+	},
+}
+
+var rustExtractor = &patternExtractor{
+	block:  braces,
+	syntax: syntax{lineComment: "//", blockComment: true, charQuotes: true},
+	rules: []rule{
+		containerRule("impl", `^\s*(?:unsafe\s+)?impl(?:<[^{]*?>)?\s+(?:(?P<trait>[^{]+?)\s+for\s+)?(?P<name>[\w:]+(?:<[^{]*?>)?)`),
+		containerRule("trait", `^\s*(?:pub(?:\([^)]*\))?\s+)?(?:unsafe\s+)?trait\s+(?P<name>\w+)`),
+		newRule("func", `^\s*(?:pub(?:\([^)]*\))?\s+)?(?:default\s+)?(?:const\s+)?(?:async\s+)?(?:unsafe\s+)?(?:extern\s+(?:"[^"]*"\s+)?)?fn\s+(?P<name>\w+)`),
+		newRule("struct", `^\s*(?:pub(?:\([^)]*\))?\s+)?(?:struct|union)\s+(?P<name>\w+)`),
+		newRule("enum", `^\s*(?:pub(?:\([^)]*\))?\s+)?enum\s+(?P<name>\w+)`),
+		newRule("type", `^\s*(?:pub(?:\([^)]*\))?\s+)?type\s+(?P<name>\w+)`),
+		newRule("module", `^\s*(?:pub(?:\([^)]*\))?\s+)?mod\s+(?P<name>\w+)`),
+		newRule("macro", `^\s*macro_rules!\s*(?P<name>\w+)`),
+	},
+}
+
+// cFunction matches a function definition starting in the first column with
+// its return type on the same line; prototypes ending in ; are left out
+const cFunction = `^(?:[A-Za-z_][\w:<>,]*[\s*&]+)+(?P<name>~?[A-Za-z_][\w:~]*)\s*\([^;]*$`
+
+var cExtractor = &patternExtractor{
+	block:  braces,
+	syntax: syntax{lineComment: "//", blockComment: true, charQuotes: true},
+	rules: []rule{
+		newRule("struct", `^\s*(?:typedef\s+)?(?P<kind>struct|union|enum)\s+(?P<name>\w+)\s*\{?\s*$`),
+		newRule("func", cFunction),
+	},
+}
+
+var cppExtractor = &patternExtractor{
+	block:  braces,
+	syntax: syntax{lineComment: "//", blockComment: true, charQuotes: true},
+	rules: []rule{
+		newRule("module", `^\s*(?:inline\s+)?namespace\s+(?P<name>[\w:]+)\s*\{?\s*$`),
+		containerRule("class", `^\s*(?:template\s*<.*>\s*)?(?P<kind>class|struct|union)\s+(?:\w+\s+)*?(?P<name>\w+)\s*(?:final\s*)?(?::[^;{]*)?\{?\s*$`),
+		newRule("enum", `^\s*enum\s+(?:class\s+|struct\s+)?(?P<name>\w+)\s*(?::\s*[\w:]+\s*)?(?:\{.*)?$`),
+		memberRule("func", `^\s+(?:(?:virtual|static|inline|explicit|constexpr|friend)\s+)*(?:[\w:<>,*&]+\s+)*[*&]?(?P<name>~?\w+|operator\W+)\s*\(`),
+		newRule("func", cFunction),
+		// Constructors and destructors defined outside their class
+		newRule("func", `^(?P<name>\w+::~?\w+)\s*\([^;]*$`),
+	},
+}
+
+var csharpExtractor = &patternExtractor{
+	block:  braces,
+	syntax: syntax{lineComment: "//", blockComment: true, charQuotes: true},
+	rules: []rule{
+		newRule("module", `^\s*namespace\s+(?P<name>[\w.]+)`),
+		containerRule("class", `^\s*(?:\[.*\]\s*)*(?:(?:public|private|protected|internal|static|abstract|sealed|partial|readonly|unsafe|new|file|ref)\s+)*(?P<kind>class|interface|struct|enum|record)\s+(?:(?:class|struct)\s+)?(?P<name>\w+)`),
+		memberRule("func", `^\s+(?:\[.*\]\s*)*(?:(?:public|private|protected|internal|static|virtual|override|abstract|sealed|async|extern|unsafe|new|partial|readonly)\s+)*[\w.?\[\]]+(?:<[^()]*>)?[?\[\]]*\s+(?P<name>\w+)\s*(?:<[^()]*>)?\s*\(`),
+		constructorRule(`^\s+(?:(?:public|private|protected|internal|static)\s+)*(?P<name>[A-Z]\w*)\s*\(`),
+	},
+}
+
+var rubyExtractor = &patternExtractor{
+	block:  endKeyword,
+	syntax: syntax{lineComment: "#"},
+	rules: []rule{
+		containerRule("class", `^\s*(?P<kind>class|module)\s+(?P<name>[A-Z][\w:]*)`),
+		newRule("func", `^\s*def\s+(?:self\.)?(?P<name>[A-Za-z_]\w*[?!=]?)`),
+	},
+}
+
+var phpExtractor = &patternExtractor{
+	block:  braces,
+	syntax: syntax{lineComment: "//", blockComment: true},
+	pkg:    regexp.MustCompile(`^\s*namespace\s+(?P<name>[\w\\]+)\s*[;{]`),
+	rules: []rule{
+		containerRule("class", `^\s*(?:(?:abstract|final|readonly)\s+)*(?P<kind>class|interface|trait|enum)\s+(?P<name>\w+)`),
+		newRule("func", `^\s*(?:(?:public|private|protected|static|abstract|final)\s+)*function\s+&?(?P<name>\w+)`),
+	},
+}
+
+var swiftExtractor = &patternExtractor{
+	block:   braces,
+	syntax:  syntax{lineComment: "//", blockComment: true},
+	noBlock: regexp.MustCompile(`\)\s*(?:(?:async|throws|rethrows)\s*)*(?:->\s*.+)?$`),
+	rules: []rule{
+		// Before the types, since class is also a modifier
+		newRule("func", `^\s*(?:@\w+(?:\([^)]*\))?\s+)*(?:(?:public|private|fileprivate|internal|open|final|static|class|mutating|nonmutating|override|convenience|required|dynamic|optional|nonisolated)\s+)*func\s+(?P<name>[^\s(<]+)`),
+		memberRule("func", `^\s+(?:(?:public|private|fileprivate|internal|open|override|convenience|required)\s+)*(?P<name>init)[?!]?\s*[(<]`),
+		containerRule("class", `^\s*(?:@\w+(?:\([^)]*\))?\s+)*(?:(?:public|private|fileprivate|internal|open|final|indirect)\s+)*(?P<kind>class|struct|enum|protocol|extension|actor)\s+(?P<name>\w[\w.]*)`),
+	},
+}
+
+var kotlinExtractor = &patternExtractor{
+	block:   braces,
+	syntax:  syntax{lineComment: "//", blockComment: true, charQuotes: true},
+	pkg:     regexp.MustCompile(`^\s*package\s+(?P<name>[\w.]+)`),
+	noBlock: regexp.MustCompile(`(?:\)\s*(?::\s*[^=]+)?|=.*|\w)$`),
+	rules: []rule{
+		containerRule("class", `^\s*(?:@\w+(?:\([^)]*\))?\s+)*(?:(?:public|private|protected|internal|open|abstract|sealed|data|enum|annotation|inner|value|final|expect|actual|fun)\s+)*(?P<kind>class|interface|object)\s+(?P<name>\w+)`),
+		newRule("func", `^\s*(?:@\w+(?:\([^)]*\))?\s+)*(?:(?:public|private|protected|internal|open|override|abstract|final|suspend|inline|operator|infix|tailrec|external|expect|actual)\s+)*fun\s+(?:<[^>]*>\s*)?(?:[\w.<>?]+\.)?(?P<name>\w+)\s*\(`),
+	},
+}
@@ -0,0 +1,244 @@
+package symbols
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPatternExtractors(t *testing.T) {
+	tests := []struct {
+		language string
+		src      string
+		pkg      string
+		want     []string
+	}{
+		{
+			language: "Python",
+			src: `class Point:
+    def __init__(self, x):
+        self.x = x
+
+    def norm(self):
+        def helper():
+            pass
+        return helper()
+
+async def main():
+    pass
+`,
+			want: []string{"class Point L1-8", "method Point.__init__ L2-3", "method Point.norm L5-8", "func main L10-11"},
+		},
+		{
+			language: "C",
+			src: `#include <stdio.h>
+
+struct point {
+	int x, y;
+};
+
+static int helper(int x);
+
+static const char *name(struct point *p)
+{
+	if (p->x) {
+		return "}";
+	}
+	return "x";
+}
+
+int main(int argc,
+         char **argv) {
+	return helper(argc);
+}
+`,
+			want: []string{"struct point L3-5", "func name L9-15", "func main L17-20"},
+		},
+		{
+			language: "C++",
+			src: `namespace geo {
+
+template <typename T>
+class Shape : public Base {
+public:
+	Shape(T size);
+	virtual ~Shape();
+	double area() const;
+	std::string name() const { return "shape"; }
+};
+
+enum class Color { Red, Green };
+
+double Shape::area() const {
+	return 0;
+}
+
+Shape::Shape(T size) : size_(size) {}
+
+}
+`,
+			want: []string{
+				"module geo L1-20", "class Shape L4-10", "method Shape.Shape L6", "method Shape.~Shape L7",
+				"method Shape.area L8", "method Shape.name L9", "enum Color L12", "func Shape::area L14-16",
+				"func Shape::Shape L18",
+			},
+		},
+		{
+			language: "C#",
+			src: `namespace App.Models
+{
+    [Serializable]
+    public sealed class Order : IEntity
+    {
+        public Order(int id) { Id = id; }
+
+        public int Id { get; }
+
+        public async Task<List<Item>> LoadItems(string filter)
+        {
+            return await Fetch(filter);
+        }
+
+        private static bool IsValid() => true;
+    }
+
+    public record struct Money(decimal Amount);
+}
+`,
+			want: []string{
+				"module App.Models L1-19", "class Order L4-16", "method Order.Order L6",
+				"method Order.LoadItems L10-13", "method Order.IsValid L15", "record Money L18",
+			},
+		},
+		{
+			language: "Ruby",
+			src: `module Billing
+  class Invoice < Base
+    def self.build(attrs)
+      new(attrs)
+    end
+
+    def paid?
+      items.each do |item|
+        return false unless item.paid
+      end
+      true
+    end
+
+    def total; items.sum; end
+  end
+end
+`,
+			want: []string{
+				"module Billing L1-16", "class Billing.Invoice L2-15", "method Invoice.build L3-5",
+				"method Invoice.paid? L7-12", "method Invoice.total L14",
+			},
+		},
+		{
+			language: "PHP",
+			src: `<?php
+namespace App\Http;
+
+final class Controller extends Base
+{
+    public function index(Request $request)
+    {
+        return "{";
+    }
+
+    private static function &helper() {}
+}
+
+function route($path) {
+    return $path;
+}
+`,
+			pkg:  `App\Http`,
+			want: []string{"class Controller L4-12", "method Controller.index L6-9", "method Controller.helper L11", "func route L14-16"},
+		},
+		{
+			language: "Swift",
+			src: `protocol Drawable {
+    func draw() -> String
+    func size() async throws -> Int
+}
+
+public struct Circle: Drawable {
+    init(radius: Double) {
+        self.radius = radius
+    }
+
+    func draw() -> String {
+        return "circle"
+    }
+}
+
+extension Circle {
+    static func unit() -> Circle { Circle(radius: 1) }
+}
+
+class func ignored() {}
+`,
+			want: []string{
+				"protocol Drawable L1-4", "method Drawable.draw L2", "method Drawable.size L3",
+				"struct Circle L6-14", "method Circle.init L7-9", "method Circle.draw L11-13",
+				"extension Circle L16-18", "method Circle.unit L17", "func ignored L20",
+			},
+		},
+		{
+			language: "Kotlin",
+			src: `package com.example.app
+
+data class User(val id: Int, val name: String)
+
+interface Repository {
+    fun find(id: Int): User?
+    fun all(): List<User>
+}
+
+class UserRepository : Repository {
+    override fun find(id: Int): User? = users[id]
+
+    override fun all(): List<User> {
+        return users.values.toList()
+    }
+}
+
+fun String.shout() = uppercase()
+
+suspend fun main() {
+    println("}")
+}
+`,
+			pkg: "com.example.app",
+			want: []string{
+				"class User L3", "interface Repository L5-8", "method Repository.find L6", "method Repository.all L7",
+				"class UserRepository L10-16", "method UserRepository.find L11", "method UserRepository.all L13-15",
+				"func shout L18", "func main L20-22",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.language, func(t *testing.T) {
+			e, ok := For(tt.language)
+			if !ok {
+				t.Fatalf("no extractor registered for %s", tt.language)
+			}
+			outline, err := e.Extract("file", []byte(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, s := range outline.Symbols {
+				got = append(got, s.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("symbols =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			if outline.Package != tt.pkg {
+				t.Errorf("package = %q, want %q", outline.Package, tt.pkg)
+			}
+		})
+	}
+}
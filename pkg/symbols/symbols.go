@@ -0,0 +1,119 @@
+package symbols
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// Symbol is a top-level declaration with the lines it spans
+type Symbol struct {
+	// Kind is func, method, class, struct, union, record, interface,
+	// protocol, enum, trait, impl, extension, object, actor, module, macro or
+	// type
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Receiver is the receiver type of a method, e.g. *Tx, or the class,
+	// impl or trait it is declared in
+	Receiver string `json:"receiver,omitempty"`
+	Line     int    `json:"line"`
+	EndLine  int    `json:"end_line"`
+}
+
+// String formats the symbol as kind, name and line range
+func (s Symbol) String() string {
+	name := s.Name
+	switch {
+	case strings.ContainsAny(s.Receiver, "*[ "):
+		name = fmt.Sprintf("(%s).%s", s.Receiver, s.Name)
+	case s.Receiver != "":
+		name = s.Receiver + "." + s.Name
+	}
+	return fmt.Sprintf("%s %s %s", s.Kind, name, s.Lines())
+}
+
+// Lines formats the line range, e.g. L10-42
+func (s Symbol) Lines() string {
+	if s.EndLine <= s.Line {
+		return fmt.Sprintf("L%d", s.Line)
+	}
+	return fmt.Sprintf("L%d-%d", s.Line, s.EndLine)
+}
+
+// ParseGo returns the package name and the top-level functions, methods and
+// types of a Go source file. Files with syntax errors yield whatever could be
+// parsed before the error.
+func ParseGo(filename string, src []byte) (string, []Symbol, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.SkipObjectResolution)
+	if file == nil {
+		return "", nil, err
+	}
+
+	span := func(node ast.Node) (int, int) {
+		return fset.Position(node.Pos()).Line, fset.Position(node.End()).Line
+	}
+
+	var symbols []Symbol
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			s := Symbol{Kind: "func", Name: d.Name.Name}
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				s.Kind = "method"
+				s.Receiver = typeString(d.Recv.List[0].Type)
+			}
+			s.Line, s.EndLine = span(d)
+			symbols = append(symbols, s)
+
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				ts := spec.(*ast.TypeSpec)
+				s := Symbol{Kind: "type", Name: ts.Name.Name}
+				switch ts.Type.(type) {
+				case *ast.StructType:
+					s.Kind = "struct"
+				case *ast.InterfaceType:
+					s.Kind = "interface"
+				}
+				// An unparenthesized declaration starts at its type keyword
+				if !d.Lparen.IsValid() {
+					s.Line, s.EndLine = span(d)
+				} else {
+					s.Line, s.EndLine = span(ts)
+				}
+				symbols = append(symbols, s)
+			}
+		}
+	}
+	return file.Name.Name, symbols, err
+}
+
+// typeString renders a receiver type expression such as *List[T]
+func typeString(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return "*" + typeString(t.X)
+	case *ast.IndexExpr:
+		return typeString(t.X) + "[" + typeString(t.Index) + "]"
+	case *ast.IndexListExpr:
+		var params []string
+		for _, index := range t.Indices {
+			params = append(params, typeString(index))
+		}
+		return typeString(t.X) + "[" + strings.Join(params, ", ") + "]"
+	case *ast.SelectorExpr:
+		return typeString(t.X) + "." + t.Sel.Name
+	case *ast.ParenExpr:
+		return typeString(t.X)
+	default:
+		return "?"
+	}
+}
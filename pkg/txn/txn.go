@@ -0,0 +1,350 @@
+package txn
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type opKind int
+
+const (
+	opWrite opKind = iota
+	opRemove
+	opRename
+	opMkdir
+)
+
+type op struct {
+	kind opKind
+	path string
+	dest string // rename target
+	data []byte // write content
+	perm os.FileMode
+
+	tmp    string // staged content for writes
+	backup string // original moved aside by writes and removes
+}
+
+// Tx groups file system changes so they are applied together or not at all.
+// Nothing touches the workspace until Commit.
+type Tx struct {
+	ops []*op
+}
+
+// New creates an empty transaction
+func New() *Tx {
+	return &Tx{}
+}
+
+// Len returns the number of pending changes
+func (t *Tx) Len() int {
+	return len(t.ops)
+}
+
+// WriteFile schedules path to be replaced with data
+func (t *Tx) WriteFile(path string, data []byte, perm os.FileMode) {
+	t.ops = append(t.ops, &op{kind: opWrite, path: path, data: data, perm: perm})
+}
+
+// Remove schedules a file or directory tree to be removed
+func (t *Tx) Remove(path string) {
+	t.ops = append(t.ops, &op{kind: opRemove, path: path})
+}
+
+// Rename schedules oldpath to be moved to newpath
+func (t *Tx) Rename(oldpath, newpath string) {
+	t.ops = append(t.ops, &op{kind: opRename, path: oldpath, dest: newpath})
+}
+
+// MkdirAll schedules a directory and its missing parents to be created
+func (t *Tx) MkdirAll(path string, perm os.FileMode) {
+	t.ops = append(t.ops, &op{kind: opMkdir, path: path, perm: perm})
+}
+
+// ReadFile returns the content path will have once the transaction commits.
+// Pending writes, removes and renames are applied to what is on disk.
+func (t *Tx) ReadFile(path string) ([]byte, error) {
+	current := filepath.Clean(path)
+	for i := len(t.ops) - 1; i >= 0; i-- {
+		o := t.ops[i]
+		switch o.kind {
+		case opWrite:
+			if filepath.Clean(o.path) == current {
+				return o.data, nil
+			}
+		case opRemove:
+			if within(current, o.path) {
+				return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+			}
+		case opRename:
+			// Follow the file back to where it is before the rename
+			if within(current, o.dest) {
+				current = filepath.Join(o.path, strings.TrimPrefix(current, filepath.Clean(o.dest)))
+			} else if within(current, o.path) {
+				return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+			}
+		}
+	}
+	return os.ReadFile(current)
+}
+
+// Paths returns every path the transaction changes, including rename targets
+func (t *Tx) Paths() []string {
+	var paths []string
+	for _, o := range t.ops {
+		paths = append(paths, o.path)
+		if o.kind == opRename {
+			paths = append(paths, o.dest)
+		}
+	}
+	return paths
+}
+
+// Commit applies all changes. New content is first written to temporary files
+// next to their targets and then renamed into place. If any step fails every
+// change already made is rolled back and the error is returned.
+func (t *Tx) Commit() error {
+	var undo []func() error
+	rollback := func(cause error) error {
+		// Staged files go first so the directories created for them can be removed
+		t.cleanup()
+		for i := len(undo) - 1; i >= 0; i-- {
+			if err := undo[i](); err != nil {
+				cause = fmt.Errorf("%v (rollback incomplete: %v)", cause, err)
+			}
+		}
+		return cause
+	}
+
+	// Stage the content of every write so a full disk or permission problem
+	// is found before anything is replaced. Writes below a path that an
+	// earlier rename or remove changes are staged once that has happened,
+	// since their directory is not in place before.
+	for i, o := range t.ops {
+		if o.kind != opWrite || t.movedBefore(i) {
+			continue
+		}
+		if err := stageWrite(o, &undo); err != nil {
+			return rollback(err)
+		}
+	}
+
+	for _, o := range t.ops {
+		if o.kind == opWrite && o.tmp == "" {
+			if err := stageWrite(o, &undo); err != nil {
+				return rollback(err)
+			}
+		}
+		if err := t.apply(o, &undo); err != nil {
+			return rollback(err)
+		}
+	}
+
+	// Everything is in place; drop the originals
+	for _, o := range t.ops {
+		if o.backup != "" {
+			os.RemoveAll(o.backup)
+			o.backup = ""
+		}
+	}
+	return nil
+}
+
+// movedBefore reports whether the path of the write at index i is below a
+// path renamed or removed by an earlier operation
+func (t *Tx) movedBefore(i int) bool {
+	for _, o := range t.ops[:i] {
+		switch o.kind {
+		case opRemove:
+			if within(t.ops[i].path, o.path) {
+				return true
+			}
+		case opRename:
+			if within(t.ops[i].path, o.path) || within(t.ops[i].path, o.dest) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stageWrite creates the directory of a write and writes its content to a
+// temporary file there
+func stageWrite(o *op, undo *[]func() error) error {
+	created, err := mkdirAll(filepath.Dir(o.path), 0755)
+	*undo = append(*undo, removeDirs(created))
+	if err != nil {
+		return fmt.Errorf("error creating directory for %s: %v", o.path, err)
+	}
+	if o.tmp, err = stage(o.path, o.data, o.perm); err != nil {
+		return fmt.Errorf("error staging %s: %v", o.path, err)
+	}
+	return nil
+}
+
+// apply performs a single operation and records how to undo it
+func (t *Tx) apply(o *op, undo *[]func() error) error {
+	switch o.kind {
+	case opWrite:
+		if _, err := os.Lstat(o.path); err == nil {
+			backup, err := moveAside(o.path)
+			if err != nil {
+				return fmt.Errorf("error replacing %s: %v", o.path, err)
+			}
+			o.backup = backup
+		}
+		if err := os.Rename(o.tmp, o.path); err != nil {
+			if o.backup != "" {
+				os.Rename(o.backup, o.path)
+				o.backup = ""
+			}
+			return fmt.Errorf("error writing %s: %v", o.path, err)
+		}
+		o.tmp = ""
+		path, backup := o.path, o.backup
+		*undo = append(*undo, func() error {
+			if backup != "" {
+				o.backup = ""
+				return os.Rename(backup, path)
+			}
+			return os.Remove(path)
+		})
+
+	case opRemove:
+		backup, err := moveAside(o.path)
+		if err != nil {
+			return fmt.Errorf("error deleting %s: %v", o.path, err)
+		}
+		o.backup = backup
+		path := o.path
+		*undo = append(*undo, func() error {
+			o.backup = ""
+			return os.Rename(backup, path)
+		})
+
+	case opRename:
+		if _, err := os.Lstat(o.dest); err == nil {
+			return fmt.Errorf("cannot move %s: %s already exists", o.path, o.dest)
+		}
+		created, err := mkdirAll(filepath.Dir(o.dest), 0755)
+		*undo = append(*undo, removeDirs(created))
+		if err != nil {
+			return fmt.Errorf("error creating directory for %s: %v", o.dest, err)
+		}
+		if err := os.Rename(o.path, o.dest); err != nil {
+			return fmt.Errorf("error moving %s: %v", o.path, err)
+		}
+		src, dest := o.path, o.dest
+		*undo = append(*undo, func() error {
+			return os.Rename(dest, src)
+		})
+
+	case opMkdir:
+		created, err := mkdirAll(o.path, o.perm)
+		*undo = append(*undo, removeDirs(created))
+		if err != nil {
+			return fmt.Errorf("error creating directory %s: %v", o.path, err)
+		}
+	}
+	return nil
+}
+
+// cleanup removes staged files that were never renamed into place
+func (t *Tx) cleanup() {
+	for _, o := range t.ops {
+		if o.tmp != "" {
+			os.Remove(o.tmp)
+			o.tmp = ""
+		}
+	}
+}
+
+// stage writes data to a temporary file in the same directory as path
+func stage(path string, data []byte, perm os.FileMode) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".caia-tmp-*")
+	if err != nil {
+		return "", err
+	}
+	name := f.Name()
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(name)
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(name)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(name)
+		return "", err
+	}
+	if err := os.Chmod(name, perm); err != nil {
+		os.Remove(name)
+		return "", err
+	}
+	return name, nil
+}
+
+// moveAside renames path to an unused backup name in the same directory
+func moveAside(path string) (string, error) {
+	dir, base := filepath.Dir(path), filepath.Base(path)
+	for i := 0; ; i++ {
+		backup := filepath.Join(dir, fmt.Sprintf(".%s.caia-bak-%d", base, i))
+		if _, err := os.Lstat(backup); err == nil {
+			continue
+		}
+		if err := os.Rename(path, backup); err != nil {
+			return "", err
+		}
+		return backup, nil
+	}
+}
+
+// mkdirAll creates dir and its missing parents, returning the directories it
+// created from the outermost in
+func mkdirAll(dir string, perm os.FileMode) ([]string, error) {
+	var missing []string
+	for d := filepath.Clean(dir); d != "." && d != string(filepath.Separator); d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append([]string{d}, missing...)
+	}
+
+	var created []string
+	for _, d := range missing {
+		if err := os.Mkdir(d, perm); err != nil {
+			// A directory created in the meantime is not ours to remove
+			if os.IsExist(err) {
+				continue
+			}
+			return created, err
+		}
+		created = append(created, d)
+	}
+	return created, nil
+}
+
+// within reports whether path is dir or a path below it
+func within(path, dir string) bool {
+	path, dir = filepath.Clean(path), filepath.Clean(dir)
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// removeDirs returns an undo step that removes the created directories
+func removeDirs(created []string) func() error {
+	return func() error {
+		for i := len(created) - 1; i >= 0; i-- {
+			if err := os.Remove(created[i]); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	}
+}
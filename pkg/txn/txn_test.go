@@ -0,0 +1,297 @@
+package txn
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// snapshot returns every file and directory under root with file contents,
+// so a rolled back tree can be compared with the original
+func snapshot(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		if d.IsDir() {
+			files[rel+"/"] = ""
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		files[rel] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCommitRollsBackWhenAStepFails(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(tx *Tx, dir string)
+		err   string
+	}{
+		{
+			name: "rename onto an existing file",
+			build: func(tx *Tx, dir string) {
+				tx.Rename(filepath.Join(dir, "d.txt"), filepath.Join(dir, "a.txt"))
+			},
+			err: "already exists",
+		},
+		{
+			name: "rename of a missing file",
+			build: func(tx *Tx, dir string) {
+				tx.Rename(filepath.Join(dir, "missing.txt"), filepath.Join(dir, "moved", "x.txt"))
+			},
+			err: "error moving",
+		},
+		{
+			name: "remove of a missing file",
+			build: func(tx *Tx, dir string) {
+				tx.Remove(filepath.Join(dir, "missing.txt"))
+			},
+			err: "error deleting",
+		},
+		{
+			name: "write into a directory a rename created",
+			build: func(tx *Tx, dir string) {
+				tx.WriteFile(filepath.Join(dir, "moved", "f.txt"), []byte("f"), 0644)
+				tx.Remove(filepath.Join(dir, "missing.txt"))
+			},
+			err: "error deleting",
+		},
+		{
+			name: "write below a file",
+			build: func(tx *Tx, dir string) {
+				tx.WriteFile(filepath.Join(dir, "a.txt", "x.txt"), []byte("x"), 0644)
+			},
+			err: "error staging",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{
+				"a.txt":     "a",
+				"c.txt":     "c",
+				"d.txt":     "d",
+				"sub/e.txt": "e",
+			})
+			before := snapshot(t, dir)
+
+			// Earlier steps succeed before the failing one
+			tx := New()
+			tx.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed"), 0644)
+			tx.WriteFile(filepath.Join(dir, "new", "deep", "b.txt"), []byte("b"), 0644)
+			tx.Remove(filepath.Join(dir, "c.txt"))
+			tx.Rename(filepath.Join(dir, "sub", "e.txt"), filepath.Join(dir, "moved", "e.txt"))
+			tx.MkdirAll(filepath.Join(dir, "empty", "dir"), 0755)
+			tt.build(tx, dir)
+
+			err := tx.Commit()
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Commit() error = %v, want it to contain %q", err, tt.err)
+			}
+			if after := snapshot(t, dir); !reflect.DeepEqual(after, before) {
+				t.Errorf("tree after rollback = %v, want %v", after, before)
+			}
+		})
+	}
+}
+
+func TestCommit(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "a", "c.txt": "c", "d.txt": "d"})
+
+	tx := New()
+	tx.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed"), 0644)
+	tx.WriteFile(filepath.Join(dir, "new", "b.txt"), []byte("b"), 0644)
+	tx.Remove(filepath.Join(dir, "c.txt"))
+	tx.Rename(filepath.Join(dir, "d.txt"), filepath.Join(dir, "moved", "d.txt"))
+
+	if data, err := tx.ReadFile(filepath.Join(dir, "a.txt")); err != nil || string(data) != "changed" {
+		t.Errorf("ReadFile() before commit = %q, %v, want the staged content", data, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	want := map[string]string{
+		"./":          "",
+		"a.txt":       "changed",
+		"new/":        "",
+		"new/b.txt":   "b",
+		"moved/":      "",
+		"moved/d.txt": "d",
+	}
+	if got := snapshot(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("tree after commit = %v, want %v", got, want)
+	}
+}
+
+func TestCommitWritesBelowRenamedAndRemovedPaths(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"old/a.txt": "a", "gone/b.txt": "b"})
+
+	tx := New()
+	tx.Rename(filepath.Join(dir, "old"), filepath.Join(dir, "new"))
+	tx.WriteFile(filepath.Join(dir, "new", "a.txt"), []byte("changed"), 0644)
+	tx.WriteFile(filepath.Join(dir, "new", "c.txt"), []byte("c"), 0644)
+	tx.Remove(filepath.Join(dir, "gone"))
+	tx.WriteFile(filepath.Join(dir, "gone", "d.txt"), []byte("d"), 0644)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	want := map[string]string{
+		"./":         "",
+		"new/":       "",
+		"new/a.txt":  "changed",
+		"new/c.txt":  "c",
+		"gone/":      "",
+		"gone/d.txt": "d",
+	}
+	if got := snapshot(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("tree after commit = %v, want %v", got, want)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(tx *Tx, dir string)
+		path  string
+		want  string // empty when the file should not exist
+	}{
+		{
+			name:  "no pending change",
+			build: func(tx *Tx, dir string) {},
+			path:  "a.txt",
+			want:  "a",
+		},
+		{
+			name: "pending write",
+			build: func(tx *Tx, dir string) {
+				tx.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed"), 0644)
+			},
+			path: "a.txt",
+			want: "changed",
+		},
+		{
+			name: "last write wins",
+			build: func(tx *Tx, dir string) {
+				tx.WriteFile(filepath.Join(dir, "a.txt"), []byte("first"), 0644)
+				tx.WriteFile(filepath.Join(dir, "a.txt"), []byte("second"), 0644)
+			},
+			path: "a.txt",
+			want: "second",
+		},
+		{
+			name: "removed file",
+			build: func(tx *Tx, dir string) {
+				tx.Remove(filepath.Join(dir, "a.txt"))
+			},
+			path: "a.txt",
+		},
+		{
+			name: "file in a removed directory",
+			build: func(tx *Tx, dir string) {
+				tx.Remove(filepath.Join(dir, "sub"))
+			},
+			path: "sub/b.txt",
+		},
+		{
+			name: "written again after its removal",
+			build: func(tx *Tx, dir string) {
+				tx.Remove(filepath.Join(dir, "a.txt"))
+				tx.WriteFile(filepath.Join(dir, "a.txt"), []byte("new"), 0644)
+			},
+			path: "a.txt",
+			want: "new",
+		},
+		{
+			name: "source of a rename",
+			build: func(tx *Tx, dir string) {
+				tx.Rename(filepath.Join(dir, "a.txt"), filepath.Join(dir, "c.txt"))
+			},
+			path: "a.txt",
+		},
+		{
+			name: "target of a rename",
+			build: func(tx *Tx, dir string) {
+				tx.Rename(filepath.Join(dir, "a.txt"), filepath.Join(dir, "c.txt"))
+			},
+			path: "c.txt",
+			want: "a",
+		},
+		{
+			name: "written before a rename",
+			build: func(tx *Tx, dir string) {
+				tx.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed"), 0644)
+				tx.Rename(filepath.Join(dir, "a.txt"), filepath.Join(dir, "c.txt"))
+			},
+			path: "c.txt",
+			want: "changed",
+		},
+		{
+			name: "file in a renamed directory",
+			build: func(tx *Tx, dir string) {
+				tx.Rename(filepath.Join(dir, "sub"), filepath.Join(dir, "moved", "sub"))
+			},
+			path: "moved/sub/b.txt",
+			want: "b",
+		},
+		{
+			name: "file in a directory renamed twice",
+			build: func(tx *Tx, dir string) {
+				tx.Rename(filepath.Join(dir, "sub"), filepath.Join(dir, "one"))
+				tx.Rename(filepath.Join(dir, "one"), filepath.Join(dir, "two"))
+			},
+			path: "two/b.txt",
+			want: "b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+			tx := New()
+			tt.build(tx, dir)
+
+			got, err := tx.ReadFile(filepath.Join(dir, tt.path))
+			if tt.want == "" {
+				if !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("ReadFile(%s) = %q, %v, want fs.ErrNotExist", tt.path, got, err)
+				}
+				return
+			}
+			if err != nil || string(got) != tt.want {
+				t.Errorf("ReadFile(%s) = %q, %v, want %q", tt.path, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+//go:build linux
+
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY |
+	syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_ATTRIB | syscall.IN_DELETE_SELF | syscall.IN_ONLYDIR
+
+// inotify watches directories with Linux inotify
+type inotify struct {
+	file *os.File
+	fd   int
+
+	mu    sync.Mutex
+	byWd  map[int]string
+	byDir map[string]int
+}
+
+func newNative(raw chan<- string, done <-chan struct{}) (backend, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	// A non-blocking descriptor is read through the runtime poller, so
+	// closing the file interrupts a pending read
+	n := &inotify{
+		file:  os.NewFile(uintptr(fd), "inotify"),
+		fd:    fd,
+		byWd:  make(map[int]string),
+		byDir: make(map[string]int),
+	}
+	go n.read(raw, done)
+	return n, nil
+}
+
+func (n *inotify) set(dirs []string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	wanted := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		wanted[dir] = true
+	}
+
+	for dir, wd := range n.byDir {
+		if !wanted[dir] {
+			syscall.InotifyRmWatch(n.fd, uint32(wd))
+			delete(n.byDir, dir)
+			delete(n.byWd, wd)
+		}
+	}
+
+	for _, dir := range dirs {
+		if _, ok := n.byDir[dir]; ok {
+			continue
+		}
+		wd, err := syscall.InotifyAddWatch(n.fd, dir, inotifyMask)
+		if err == syscall.ENOENT || err == syscall.ENOTDIR {
+			// Removed since it was listed; its parent reports the change
+			continue
+		}
+		if err != nil {
+			return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+		}
+		n.byDir[dir] = wd
+		n.byWd[wd] = dir
+	}
+	return nil
+}
+
+func (n *inotify) close() error {
+	return n.file.Close()
+}
+
+// read turns inotify events into changed paths until the file is closed
+func (n *inotify) read(raw chan<- string, done <-chan struct{}) {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		count, err := n.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= count; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+			offset = nameEnd
+			if nameEnd > count {
+				break
+			}
+
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				// Events were lost; report the root so everything is rescanned
+				send(raw, done, ".")
+				continue
+			}
+
+			n.mu.Lock()
+			dir, ok := n.byWd[int(event.Wd)]
+			if event.Mask&syscall.IN_IGNORED != 0 && ok {
+				delete(n.byWd, int(event.Wd))
+				delete(n.byDir, dir)
+			}
+			n.mu.Unlock()
+			if !ok {
+				continue
+			}
+
+			path := dir
+			if event.Len > 0 {
+				name := buf[nameStart:nameEnd]
+				for len(name) > 0 && name[len(name)-1] == 0 {
+					name = name[:len(name)-1]
+				}
+				path = filepath.Join(dir, string(name))
+			}
+			send(raw, done, path)
+		}
+	}
+}
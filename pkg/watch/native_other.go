@@ -0,0 +1,10 @@
+//go:build !linux
+
+package watch
+
+import "errors"
+
+// newNative is only implemented on Linux; other platforms poll
+func newNative(raw chan<- string, done <-chan struct{}) (backend, error) {
+	return nil, errors.New("native file notifications are not supported on this platform")
+}
@@ -0,0 +1,106 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// stamp is what the poller compares to detect a change
+type stamp struct {
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+// poller lists the watched directories every interval and reports entries
+// that appeared, disappeared or changed size or modification time
+type poller struct {
+	mu   sync.Mutex
+	dirs []string
+	stop chan struct{}
+}
+
+func newPoller(raw chan<- string, done <-chan struct{}, interval time.Duration) *poller {
+	p := &poller{stop: make(chan struct{})}
+	go p.run(raw, done, interval)
+	return p
+}
+
+func (p *poller) set(dirs []string) error {
+	p.mu.Lock()
+	p.dirs = dirs
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *poller) close() error {
+	close(p.stop)
+	return nil
+}
+
+func (p *poller) run(raw chan<- string, done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var previous map[string]map[string]stamp
+	for {
+		select {
+		case <-done:
+			return
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		dirs := p.dirs
+		p.mu.Unlock()
+
+		current := make(map[string]map[string]stamp, len(dirs))
+		for _, dir := range dirs {
+			current[dir] = scan(dir)
+		}
+
+		// Directories that were not watched before only set a baseline
+		for dir, entries := range current {
+			before, ok := previous[dir]
+			if !ok {
+				continue
+			}
+			for path, s := range entries {
+				if b, ok := before[path]; !ok || b != s {
+					send(raw, done, path)
+				}
+			}
+			for path := range before {
+				if _, ok := entries[path]; !ok {
+					send(raw, done, path)
+				}
+			}
+		}
+		previous = current
+	}
+}
+
+// scan stamps the entries of dir. A missing directory has no entries.
+func scan(dir string) map[string]stamp {
+	stamps := make(map[string]stamp)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return stamps
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		s := stamp{modTime: info.ModTime(), isDir: entry.IsDir()}
+		if !s.isDir {
+			s.size = info.Size()
+		}
+		stamps[filepath.Join(dir, entry.Name())] = s
+	}
+	return stamps
+}
@@ -0,0 +1,150 @@
+package watch
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// backend delivers the paths of changed entries in the watched directories
+type backend interface {
+	// set replaces the watched directories
+	set(dirs []string) error
+	close() error
+}
+
+// Watcher reports changes in a set of directories. Changes are debounced:
+// a batch is sent on Events once no further change arrived for the debounce
+// interval.
+type Watcher struct {
+	// Events receives the changed paths, relative to how the directories
+	// were given. It is closed by Close.
+	Events chan []string
+
+	mu       sync.Mutex
+	backend  backend
+	polling  bool
+	interval time.Duration
+	raw      chan string
+	done     chan struct{}
+	closed   bool
+}
+
+// New starts a watcher using the platform's native notifications, or
+// polling every interval when they are unavailable or forcePolling is set
+func New(debounce, interval time.Duration, forcePolling bool) *Watcher {
+	w := &Watcher{
+		Events:   make(chan []string),
+		interval: interval,
+		raw:      make(chan string, 256),
+		done:     make(chan struct{}),
+	}
+
+	if !forcePolling {
+		if b, err := newNative(w.raw, w.done); err == nil {
+			w.backend = b
+		}
+	}
+	if w.backend == nil {
+		w.backend = newPoller(w.raw, w.done, interval)
+		w.polling = true
+	}
+
+	go w.debounce(debounce)
+	return w
+}
+
+// Polling reports whether the watcher fell back to polling
+func (w *Watcher) Polling() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.polling
+}
+
+// SetDirs replaces the watched directories. If the native backend cannot
+// watch them, for example because the system's watch limit is reached, the
+// watcher switches to polling.
+func (w *Watcher) SetDirs(dirs []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+
+	cleaned := make([]string, 0, len(dirs))
+	for _, d := range dirs {
+		cleaned = append(cleaned, filepath.Clean(d))
+	}
+
+	err := w.backend.set(cleaned)
+	if err != nil && !w.polling {
+		w.backend.close()
+		w.backend = newPoller(w.raw, w.done, w.interval)
+		w.polling = true
+		err = w.backend.set(cleaned)
+	}
+	return err
+}
+
+// Close stops watching and closes Events
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	close(w.done)
+	return w.backend.close()
+}
+
+// debounce collects raw changes and sends them as one batch after a quiet
+// period
+func (w *Watcher) debounce(quiet time.Duration) {
+	defer close(w.Events)
+
+	pending := make(map[string]bool)
+	timer := time.NewTimer(quiet)
+	timer.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case path := <-w.raw:
+			pending[path] = true
+			// Before Go 1.23 a fired timer keeps its value in the channel
+			// after Reset, which would end the quiet period early
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(quiet)
+		case <-timer.C:
+			if len(pending) == 0 {
+				continue
+			}
+			batch := make([]string, 0, len(pending))
+			for path := range pending {
+				batch = append(batch, path)
+			}
+			pending = make(map[string]bool)
+
+			select {
+			case w.Events <- batch:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// send delivers a raw change unless the watcher is closing
+func send(raw chan<- string, done <-chan struct{}, path string) {
+	select {
+	case raw <- path:
+	case <-done:
+	}
+}
@@ -0,0 +1,110 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// next returns the next batch of events, or fails after timeout
+func next(t *testing.T, w *Watcher, timeout time.Duration) []string {
+	t.Helper()
+	select {
+	case batch, ok := <-w.Events:
+		if !ok {
+			t.Fatal("Events was closed")
+		}
+		sort.Strings(batch)
+		return batch
+	case <-time.After(timeout):
+		t.Fatal("no events")
+		return nil
+	}
+}
+
+// quiet fails if a batch arrives within d
+func quiet(t *testing.T, w *Watcher, d time.Duration) {
+	t.Helper()
+	select {
+	case batch := <-w.Events:
+		t.Errorf("unexpected batch %v", batch)
+	case <-time.After(d):
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	const debounce = 100 * time.Millisecond
+	w := &Watcher{Events: make(chan []string), raw: make(chan string), done: make(chan struct{})}
+	go w.debounce(debounce)
+	defer close(w.done)
+
+	// Changes closer together than the debounce interval form one batch,
+	// even when an earlier quiet period already ran out
+	for _, path := range []string{"a", "b", "a", "c"} {
+		w.raw <- path
+		time.Sleep(debounce / 4)
+	}
+	if got, want := next(t, w, 2*time.Second), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("batch = %v, want %v", got, want)
+	}
+	quiet(t, w, 3*debounce)
+
+	w.raw <- "d"
+	if got, want := next(t, w, 2*time.Second), []string{"d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("batch = %v, want %v", got, want)
+	}
+	quiet(t, w, 3*debounce)
+}
+
+func TestPolling(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "old.txt"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New(50*time.Millisecond, 10*time.Millisecond, true)
+	defer w.Close()
+	if !w.Polling() {
+		t.Fatal("Polling() = false with forcePolling set")
+	}
+	if err := w.SetDirs([]string{dir}); err != nil {
+		t.Fatal(err)
+	}
+	// Let the first scan record the directory as it is
+	time.Sleep(100 * time.Millisecond)
+
+	created := filepath.Join(dir, "new.txt")
+	if err := os.WriteFile(created, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "old.txt")); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{created, filepath.Join(dir, "old.txt")}
+	sort.Strings(want)
+	if got := next(t, w, 2*time.Second); !reflect.DeepEqual(got, want) {
+		t.Errorf("batch = %v, want %v", got, want)
+	}
+	quiet(t, w, 200*time.Millisecond)
+
+	// Growing a file is a change even within the same second
+	if err := os.WriteFile(created, []byte("longer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(t, w, 2*time.Second); !reflect.DeepEqual(got, []string{created}) {
+		t.Errorf("batch = %v, want %v", got, []string{created})
+	}
+
+	w.Close()
+	select {
+	case _, ok := <-w.Events:
+		if ok {
+			t.Error("Events received a batch after Close")
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Events was not closed by Close")
+	}
+}
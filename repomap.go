@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// symbolShare is the part of the workspace budget reserved for symbols when
+// the workspace has any
+const symbolShare = 4
+
+// describeSymbols formats the symbols of one file on a single line
+func describeSymbols(file FileInfo) string {
+	parts := make([]string, 0, len(file.Symbols))
+	for _, s := range file.Symbols {
+		parts = append(parts, s.String())
+	}
+	if file.Package != "" {
+		return fmt.Sprintf("- %s (package %s): %s\n", file.Path, file.Package, strings.Join(parts, ", "))
+	}
+	return fmt.Sprintf("- %s: %s\n", file.Path, strings.Join(parts, ", "))
+}
+
+// summarizeSymbols lists the symbols of files, most relevant to focus first,
+// within roughly budget tokens
+func summarizeSymbols(files []FileInfo, focus string, budget int) string {
+	var candidates []FileInfo
+	for _, file := range files {
+		if len(file.Symbols) > 0 {
+			candidates = append(candidates, file)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	scores := scoreFiles(candidates, focus)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return scores[candidates[i].Path] > scores[candidates[j].Path]
+	})
+
+	header := "\nRepository map (declarations with line ranges):\n"
+	used := estimateTokens(header)
+	var lines []string
+	for _, file := range candidates {
+		line := describeSymbols(file)
+		cost := estimateTokens(line)
+		if used+cost > budget {
+			continue
+		}
+		used += cost
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	sort.Strings(lines)
+
+	var b strings.Builder
+	b.WriteString(header)
+	for _, line := range lines {
+		b.WriteString(line)
+	}
+	if omitted := len(candidates) - len(lines); omitted > 0 {
+		b.WriteString(fmt.Sprintf("(Symbols of %d more files omitted; read a file to see its declarations.)\n", omitted))
+	}
+	return b.String()
+}
+
+// printSymbols handles /symbols, listing the declarations whose name or file
+// path contains filter
+func printSymbols(filter string) {
+	filter = strings.ToLower(strings.TrimSpace(filter))
+
+	found := false
+	for _, file := range indexedFiles() {
+		if len(file.Symbols) == 0 {
+			continue
+		}
+		pathMatches := strings.Contains(strings.ToLower(file.Path), filter)
+
+		var matched []string
+		for _, s := range file.Symbols {
+			if filter == "" || pathMatches || strings.Contains(strings.ToLower(s.Name), filter) {
+				matched = append(matched, fmt.Sprintf("  %-50s %s", strings.TrimSuffix(s.String(), " "+s.Lines()), s.Lines()))
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		found = true
+		heading := file.Path
+		if file.Package != "" {
+			heading += fmt.Sprintf(" (package %s)", file.Package)
+		}
+		fmt.Printf("\n%s\n%s\n", heading, strings.Join(matched, "\n"))
+	}
+
+	if !found {
+		if filter == "" {
+			fmt.Println("No symbols indexed.")
+		} else {
+			fmt.Printf("No symbols matching %q.\n", filter)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"caia-ai-cli/pkg/bm25"
+	"caia-ai-cli/pkg/language"
+)
+
+const (
+	// chunkLines is the length of a retrieval chunk; consecutive chunks
+	// overlap by chunkOverlap lines so code near a boundary is not split
+	chunkLines   = 40
+	chunkOverlap = 10
+	// maxChunkFileSize is the largest file that is chunked
+	maxChunkFileSize = 1 << 20
+	// maxRetrievedSnippets caps the snippets attached to one message
+	maxRetrievedSnippets = 5
+)
+
+// chunkSpan is a range of lines of a file with its terms. The text is not
+// kept; it is read again when the chunk is retrieved. Spans are cached with
+// the index entry of the file version they were computed from.
+type chunkSpan struct {
+	Start int           `json:"start"` // 1-based
+	End   int           `json:"end"`   // inclusive
+	Doc   bm25.Document `json:"doc"`
+}
+
+// chunk is a span of an indexed file
+type chunk struct {
+	path string
+	chunkSpan
+}
+
+var (
+	retrievalMu     sync.RWMutex
+	retrievalChunks []chunk
+	retrievalIndex  *bm25.Index
+)
+
+// chunksFor splits a newly indexed version of a file into chunks.
+// Workbooks, binary files and very large files have none.
+func chunksFor(path string, entry cacheEntry) []chunkSpan {
+	if entry.Hash == "" || entry.Info.Binary || entry.Size > maxChunkFileSize {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || language.IsBinary(data) {
+		return nil
+	}
+	return chunkText(path, string(data))
+}
+
+// chunkText splits a file into overlapping chunks of lines. The path is
+// indexed with every chunk so file names match too.
+func chunkText(path, text string) []chunkSpan {
+	// A final newline ends the last line rather than starting another
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	var chunks []chunkSpan
+	for start := 0; start < len(lines); start += chunkLines - chunkOverlap {
+		end := min(start+chunkLines, len(lines))
+		body := strings.Join(lines[start:end], "\n")
+		if strings.TrimSpace(body) != "" {
+			chunks = append(chunks, chunkSpan{
+				Start: start + 1,
+				End:   end,
+				Doc:   bm25.NewDocument(path + "\n" + body),
+			})
+		}
+		if end == len(lines) {
+			break
+		}
+	}
+	return chunks
+}
+
+// updateRetrieval replaces the retrieval index with the chunks of the
+// current files. It is called by indexWorkspace.
+func updateRetrieval(entries map[string]cacheEntry) {
+	paths := make([]string, 0, len(entries))
+	for path := range entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var chunks []chunk
+	var docs []bm25.Document
+	for _, path := range paths {
+		for _, span := range entries[path].Chunks {
+			chunks = append(chunks, chunk{path: path, chunkSpan: span})
+			docs = append(docs, span.Doc)
+		}
+	}
+	index := bm25.Build(docs)
+
+	retrievalMu.Lock()
+	retrievalChunks, retrievalIndex = chunks, index
+	retrievalMu.Unlock()
+}
+
+// retrieveSnippets returns the chunks that best match query as a text block
+// of roughly budget tokens at most, or "" when nothing matches
+func retrieveSnippets(query string, budget int) string {
+	retrievalMu.RLock()
+	chunks, index := retrievalChunks, retrievalIndex
+	retrievalMu.RUnlock()
+	if index == nil || index.Len() == 0 {
+		return ""
+	}
+
+	header := "Code that may be relevant to this request, found by keyword search " +
+		"(read the files for full context):\n"
+	used := estimateTokens(header)
+
+	var b strings.Builder
+	var picked []chunk
+	for _, result := range index.Search(query) {
+		if len(picked) == maxRetrievedSnippets {
+			break
+		}
+		c := chunks[result.Doc]
+		if overlapsPicked(c, picked) {
+			continue
+		}
+
+		text, ok := readLines(c.path, c.Start, c.End)
+		if !ok {
+			continue
+		}
+		block := fmt.Sprintf("\n%s lines %d-%d:\n```\n%s\n```\n", c.path, c.Start, c.End, text)
+		cost := estimateTokens(block)
+		if used+cost > budget {
+			continue
+		}
+		used += cost
+		picked = append(picked, c)
+		b.WriteString(block)
+	}
+
+	if len(picked) == 0 {
+		return ""
+	}
+	return header + b.String()
+}
+
+// overlapsPicked reports whether c shares lines with an already picked chunk
+func overlapsPicked(c chunk, picked []chunk) bool {
+	for _, p := range picked {
+		if p.path == c.path && c.Start <= p.End && p.Start <= c.End {
+			return true
+		}
+	}
+	return false
+}
+
+// readLines returns lines start to end of a file, unless it no longer
+// resolves inside the workspace
+func readLines(path string, start, end int) (string, bool) {
+	if !insideWorkspace(path) {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	lines := strings.Split(string(data), "\n")
+	if start > len(lines) {
+		return "", false
+	}
+	end = min(end, len(lines))
+	return strings.Join(lines[start-1:end], "\n"), true
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"caia-ai-cli/pkg/bm25"
+)
+
+// lines returns n numbered lines of text
+func lines(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "line%d\n", i)
+	}
+	return b.String()
+}
+
+func TestChunkText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want [][2]int // start and end line of every chunk
+	}{
+		{name: "empty", text: ""},
+		{name: "blank lines only", text: "\n\n  \n"},
+		{name: "shorter than a chunk", text: lines(10), want: [][2]int{{1, 10}}},
+		{name: "chunks overlap", text: lines(100), want: [][2]int{{1, 40}, {31, 70}, {61, 100}}},
+		{name: "one line past a chunk", text: lines(41), want: [][2]int{{1, 40}, {31, 41}}},
+		{name: "no final newline", text: strings.TrimSuffix(lines(70), "\n"), want: [][2]int{{1, 40}, {31, 70}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][2]int
+			for _, c := range chunkText("a.go", tt.text) {
+				got = append(got, [2]int{c.Start, c.End})
+				if c.Doc.Terms["go"] == 0 {
+					t.Errorf("chunk %d-%d does not include the path", c.Start, c.End)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("chunkText() spans = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetrieveSnippetsSkipsOverlappingChunks(t *testing.T) {
+	inTempWorkspace(t, map[string]string{"a.go": strings.Repeat("needle\n", 60), "b.go": "needle\n"})
+	chunks, index := retrievalChunks, retrievalIndex
+	t.Cleanup(func() { retrievalChunks, retrievalIndex = chunks, index })
+
+	entries := map[string]cacheEntry{
+		"a.go": {Chunks: chunkText("a.go", strings.Repeat("needle\n", 60))},
+		"b.go": {Chunks: chunkText("b.go", "needle\n")},
+	}
+	updateRetrieval(entries)
+
+	got := retrieveSnippets("needle", 10000)
+	for _, want := range []string{"a.go lines 1-40:", "b.go lines 1-1:"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("retrieveSnippets() is missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "a.go lines 31-60:") {
+		t.Errorf("retrieveSnippets() included a chunk overlapping one already picked:\n%s", got)
+	}
+	if retrieveSnippets("haystack", 10000) != "" {
+		t.Error("retrieveSnippets() returned snippets for a query without matches")
+	}
+}
+
+func TestChunksAreCachedWithTheIndex(t *testing.T) {
+	inTempWorkspace(t, map[string]string{"a.go": "package a\n\nfunc Needle() {}\n"})
+	cache, files := workspaceCache, workspaceFiles
+	chunks, index := retrievalChunks, retrievalIndex
+	workspaceCache = nil
+	t.Cleanup(func() {
+		workspaceCache, workspaceFiles = cache, files
+		retrievalChunks, retrievalIndex = chunks, index
+	})
+
+	if err := indexWorkspace(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if len(retrievalChunks) != 1 || retrievalChunks[0].Doc.Terms["needle"] == 0 {
+		t.Fatalf("chunks = %+v, want one chunk of a.go", retrievalChunks)
+	}
+
+	// Replace the cached chunks; they are used as long as the content is the same
+	marker := chunkSpan{Start: 1, End: 1, Doc: bm25.NewDocument("marker")}
+	entry := workspaceCache.Entries["a.go"]
+	entry.Chunks = []chunkSpan{marker}
+	workspaceCache.Entries["a.go"] = entry
+
+	if err := indexWorkspace(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if len(retrievalChunks) != 1 || retrievalChunks[0].Doc.Terms["marker"] == 0 {
+		t.Errorf("chunks of an unchanged file = %+v, want the cached ones", retrievalChunks)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes("a.go", later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexWorkspace(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if len(retrievalChunks) != 1 || retrievalChunks[0].Doc.Terms["marker"] == 0 {
+		t.Errorf("chunks of a touched file = %+v, want the cached ones", retrievalChunks)
+	}
+
+	if err := os.WriteFile("a.go", []byte("package a\n\nfunc Changed() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexWorkspace(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if len(retrievalChunks) != 1 || retrievalChunks[0].Doc.Terms["changed"] == 0 {
+		t.Errorf("chunks of a changed file = %+v, want new ones", retrievalChunks)
+	}
+}
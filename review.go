@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"caia-ai-cli/pkg/diff"
+	"caia-ai-cli/pkg/txn"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// useColor reports whether output goes to a terminal that should get ANSI colors
+func useColor() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// reviewEdit shows the proposed edit as a unified diff against the current
+// file, including changes already staged in tx, and lets the user accept,
+// reject or edit each hunk. It returns the content to write and whether any
+// change was accepted.
+func reviewEdit(action Action, tx *txn.Tx) (string, bool) {
+	current, err := tx.ReadFile(action.Filename)
+	if err != nil {
+		fmt.Printf("\nCould not read %s for a diff: %v\n", action.Filename, err)
+		return action.Content, confirm(fmt.Sprintf("Do you want to write '%s' anyway? (y/n): ", action.Filename))
+	}
+
+	hunks := diff.Compute(string(current), action.Content, diffContext)
+	if len(hunks) == 0 {
+		fmt.Printf("\nNo changes to %s.\n", action.Filename)
+		return action.Content, false
+	}
+
+	color := useColor()
+	fmt.Printf("\nProposed changes to %s (%d hunks):\n\n", action.Filename, len(hunks))
+	fmt.Printf("--- a/%s\n+++ b/%s\n", action.Filename, action.Filename)
+
+	var accepted []diff.Hunk
+	decideAll := "" // "y" or "n" once the user answers for all remaining hunks
+
+	for i := 0; i < len(hunks); i++ {
+		hunk := hunks[i]
+		answer := decideAll
+		if answer == "" {
+			fmt.Print(hunk.Format(color))
+			response, err := readResponse(fmt.Sprintf("(%d/%d) Apply this hunk [y,n,e,a,d,?]? ", i+1, len(hunks)))
+			if err != nil {
+				fmt.Printf("Error reading response: %v\n", err)
+				return action.Content, false
+			}
+			answer = response
+		}
+
+		switch answer {
+		case "y", "yes":
+			accepted = append(accepted, hunk)
+		case "n", "no":
+		case "a":
+			decideAll = "y"
+			accepted = append(accepted, hunk)
+		case "d", "q":
+			decideAll = "n"
+		case "e":
+			edited, err := editHunk(hunk)
+			if err != nil {
+				fmt.Printf("Hunk not changed: %v\n", err)
+				i-- // Ask about the same hunk again
+				continue
+			}
+			hunks[i] = edited
+			accepted = append(accepted, edited)
+		default:
+			fmt.Println("y - apply this hunk")
+			fmt.Println("n - skip this hunk")
+			fmt.Println("e - edit this hunk in $EDITOR")
+			fmt.Println("a - apply this hunk and all remaining hunks")
+			fmt.Println("d - skip this hunk and all remaining hunks")
+			i--
+		}
+	}
+
+	if len(accepted) == 0 {
+		return action.Content, false
+	}
+
+	content, err := diff.Apply(string(current), accepted)
+	if err != nil {
+		fmt.Printf("Error applying hunks: %v\n", err)
+		return action.Content, false
+	}
+	return content, true
+}
+
+// editHunk opens the hunk in the user's editor and parses the result
+func editHunk(hunk diff.Hunk) (diff.Hunk, error) {
+	tmp, err := os.CreateTemp("", "caia-hunk-*.diff")
+	if err != nil {
+		return hunk, err
+	}
+	defer os.Remove(tmp.Name())
+
+	text := hunk.Format(false) +
+		"# Edit the '+' lines above to change what will be written.\n" +
+		"# Do not change ' ' or '-' lines. Lines starting with # are ignored.\n"
+	if _, err := tmp.WriteString(text); err != nil {
+		tmp.Close()
+		return hunk, err
+	}
+	tmp.Close()
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], tmp.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return hunk, fmt.Errorf("editor failed: %v", err)
+	}
+
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return hunk, err
+	}
+	return diff.ParseHunk(string(data), hunk)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"caia-ai-cli/pkg/ignore"
+	"caia-ai-cli/pkg/search"
+)
+
+const (
+	// maxSearchMatches caps the matching lines returned by one search
+	maxSearchMatches = 100
+	// defaultSearchContext is the number of context lines when none is given
+	defaultSearchContext = 2
+)
+
+// searchWorkspace searches the indexed text files whose paths match globs,
+// or all of them when globs is empty. Globs use .gitignore syntax, so *.go
+// matches at any depth and a leading ! excludes paths.
+func searchWorkspace(opts search.Options, globs []string) (string, error) {
+	searcher, err := search.New(opts)
+	if err != nil {
+		return "", err
+	}
+
+	filter := newPathFilter(globs)
+
+	var b strings.Builder
+	files, matches := 0, 0
+	truncated := false
+	for _, file := range indexedFiles() {
+		if file.IsDir || file.Binary || !filter.matches(file.Path) || !insideWorkspace(file.Path) {
+			continue
+		}
+
+		snippets, err := searcher.File(file.Path)
+		if err != nil || len(snippets) == 0 {
+			continue
+		}
+
+		// Keep whole snippets until the match limit is reached
+		kept := snippets[:0]
+		for _, s := range snippets {
+			if matches+len(s.Matches) > maxSearchMatches && matches > 0 {
+				truncated = true
+				break
+			}
+			matches += len(s.Matches)
+			kept = append(kept, s)
+		}
+		if len(kept) == 0 {
+			break
+		}
+		if files > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(search.Format(file.Path, kept))
+		files++
+		if truncated {
+			break
+		}
+	}
+
+	if matches == 0 {
+		return fmt.Sprintf("No matches for %q.", opts.Pattern), nil
+	}
+	summary := fmt.Sprintf("%d matching lines in %d files", matches, files)
+	if truncated {
+		summary += fmt.Sprintf("; stopped after %d matches, narrow the pattern or paths to see more", matches)
+	}
+	return fmt.Sprintf("%s:\n\n%s", summary, b.String()), nil
+}
+
+// pathFilter selects the files a search covers. A file is searched when it
+// or a parent directory matches an include glob, or there are none, and
+// neither it nor a parent directory matches an exclude glob.
+type pathFilter struct {
+	include, exclude *ignore.Matcher // nil when there are no such globs
+}
+
+// newPathFilter sorts globs into includes and, with a leading !, excludes
+func newPathFilter(globs []string) pathFilter {
+	var include, exclude []string
+	for _, glob := range globs {
+		if strings.HasPrefix(glob, "!") {
+			exclude = append(exclude, glob[1:])
+		} else {
+			include = append(include, glob)
+		}
+	}
+
+	var f pathFilter
+	if len(include) > 0 {
+		f.include = &ignore.Matcher{}
+		f.include.AddPatterns(include, ".")
+	}
+	if len(exclude) > 0 {
+		f.exclude = &ignore.Matcher{}
+		f.exclude.AddPatterns(exclude, ".")
+	}
+	return f
+}
+
+func (f pathFilter) matches(path string) bool {
+	if f.exclude != nil && matchesPathOrParent(f.exclude, path) {
+		return false
+	}
+	return f.include == nil || matchesPathOrParent(f.include, path)
+}
+
+// matchesPathOrParent reports whether path or one of its parent directories
+// matches m
+func matchesPathOrParent(m *ignore.Matcher, path string) bool {
+	if m.Match(path, false) {
+		return true
+	}
+	for dir := filepath.Dir(path); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if m.Match(dir, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// grepCommand handles /grep [-i] [-F] pattern [glob...]
+func grepCommand(args string) {
+	opts := search.Options{Context: defaultSearchContext}
+	var rest []string
+	for _, field := range strings.Fields(args) {
+		switch {
+		case field == "-i" && opts.Pattern == "":
+			opts.IgnoreCase = true
+		case field == "-F" && opts.Pattern == "":
+			opts.Literal = true
+		case opts.Pattern == "":
+			opts.Pattern = field
+		default:
+			rest = append(rest, field)
+		}
+	}
+	if opts.Pattern == "" {
+		fmt.Println("Usage: /grep [-i] [-F] pattern [glob...]")
+		return
+	}
+
+	output, err := searchWorkspace(opts, rest)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Println(output)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"caia-ai-cli/pkg/search"
+)
+
+func TestSearchWorkspaceGlobs(t *testing.T) {
+	paths := []string{
+		"main.go",
+		filepath.Join("pkg", "a", "a.go"),
+		filepath.Join("pkg", "a", "a_test.go"),
+		filepath.Join("vendor", "v", "v.go"),
+		filepath.Join("docs", "notes.md"),
+	}
+	files := make(map[string]string)
+	for _, path := range paths {
+		files[path] = "needle\n"
+	}
+	inTempWorkspace(t, files)
+
+	indexed := workspaceFiles
+	t.Cleanup(func() { workspaceFiles = indexed })
+	workspaceFiles = nil
+	for _, path := range paths {
+		workspaceFiles = append(workspaceFiles, FileInfo{Path: path, Name: filepath.Base(path)})
+	}
+
+	tests := []struct {
+		name  string
+		globs []string
+		want  []string
+	}{
+		{name: "no globs", want: paths},
+		{name: "extension at any depth", globs: []string{"*.go"}, want: paths[:4]},
+		{name: "directory", globs: []string{"pkg/"}, want: paths[1:3]},
+		{name: "exclude a directory", globs: []string{"!vendor/"}, want: []string{paths[0], paths[1], paths[2], paths[4]}},
+		{name: "include and exclude", globs: []string{"*.go", "!*_test.go", "!vendor"}, want: paths[:2]},
+		{name: "exclude wins over a parent include", globs: []string{"pkg", "!a_test.go"}, want: paths[1:2]},
+		{name: "nothing matches", globs: []string{"*.rs"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := searchWorkspace(search.Options{Pattern: "needle"}, tt.globs)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, line := range strings.Split(output, "\n") {
+				if path, _, found := strings.Cut(line, ":1:"); found {
+					got = append(got, path)
+				}
+			}
+			want := append([]string(nil), tt.want...)
+			sort.Strings(got)
+			sort.Strings(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("searched %v, want %v\n%s", got, want, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"caia-ai-cli/pkg/config"
+)
+
+// recentInputLimit is how many user messages are used to judge relevance
+const recentInputLimit = 5
+
+// estimateTokens approximates the token count of text at four characters per token
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// describeFile formats a single index entry for the system prompt
+func describeFile(file FileInfo) string {
+	if file.IsDir {
+		return fmt.Sprintf("\n- Directory: %s\n", file.Path)
+	}
+
+	if file.Language == "Excel" {
+		var b strings.Builder
+		b.WriteString(fmt.Sprintf("\n- Excel file: %s (Modified: %s)\n",
+			file.Path,
+			file.ModTime.Format("2006-01-02 15:04:05")))
+		if len(file.SheetNames) > 0 {
+			b.WriteString("  Sheets:\n")
+			for _, sheet := range file.SheetNames {
+				rows, ok := file.RowCount[sheet]
+				if !ok {
+					// Counting timed out while indexing
+					b.WriteString(fmt.Sprintf("    - %s\n", sheet))
+					continue
+				}
+				b.WriteString(fmt.Sprintf("    - %s (%d rows)\n", sheet, rows))
+			}
+		}
+		return b.String()
+	}
+
+	details := []string{formatSize(file.Size)}
+	if file.Encoding != "" {
+		details = append(details, file.Encoding)
+	}
+	if len(file.SHA256) >= shortHashLen {
+		details = append(details, "sha256 "+file.SHA256[:shortHashLen])
+	}
+
+	if file.Binary {
+		return fmt.Sprintf("\n- Binary file: %s (%s, Modified: %s)\n",
+			file.Path,
+			strings.Join(details, ", "),
+			file.ModTime.Format("2006-01-02 15:04:05"))
+	}
+
+	if file.Table != nil {
+		return describeTable(file, details)
+	}
+
+	language := file.Language
+	if language == "" {
+		language = "unknown"
+	}
+	return fmt.Sprintf("\n- File: %s (Type: %s, %d lines, %s, Modified: %s)\n",
+		file.Path,
+		language,
+		file.Lines,
+		strings.Join(details, ", "),
+		file.ModTime.Format("2006-01-02 15:04:05"))
+}
+
+// describeTable formats a CSV file with its columns and their types
+func describeTable(file FileInfo, details []string) string {
+	var b strings.Builder
+	rows := fmt.Sprintf("%d rows, no header row", file.Table.Rows)
+	if file.Table.Header {
+		rows = fmt.Sprintf("%d rows plus a header row", file.Table.Rows)
+	}
+	b.WriteString(fmt.Sprintf("\n- %s file: %s (%s, %s, Modified: %s)\n",
+		file.Language,
+		file.Path,
+		rows,
+		strings.Join(details, ", "),
+		file.ModTime.Format("2006-01-02 15:04:05")))
+
+	var columns []string
+	for i, column := range file.Table.Columns {
+		if i == maxListedColumns {
+			columns = append(columns, fmt.Sprintf("and %d more", len(file.Table.Columns)-i))
+			break
+		}
+		columns = append(columns, fmt.Sprintf("%s (%s)", column.Name, column.Type))
+	}
+	if len(columns) > 0 {
+		b.WriteString("  Columns: " + strings.Join(columns, ", ") + "\n")
+	}
+	return b.String()
+}
+
+const (
+	// shortHashLen is how many hex digits of a file's hash the summary shows
+	shortHashLen = 8
+	// maxListedColumns is how many columns of a CSV file the summary names
+	maxListedColumns = 20
+)
+
+// formatSize formats a byte count for people, e.g. 14.2 KB
+func formatSize(size int64) string {
+	switch {
+	case size < 1<<10:
+		return fmt.Sprintf("%d B", size)
+	case size < 1<<20:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	}
+}
+
+// buildWorkspaceInfo describes the indexed workspace files for the system prompt
+func buildWorkspaceInfo(focus string) string {
+	files := indexedFiles()
+	budget := config.GetWorkspaceTokenBudget()
+
+	// Leave part of the budget for declarations when there are any
+	listingBudget := budget
+	for _, file := range files {
+		if len(file.Symbols) > 0 {
+			listingBudget = budget - budget/symbolShare
+			break
+		}
+	}
+
+	listing := summarizeWorkspace(files, focus, listingBudget)
+	return listing + summarizeSymbols(files, focus, budget-estimateTokens(listing))
+}
+
+// summarizeWorkspace lists files within roughly budget tokens. When the full
+// listing is too large, the files most relevant to focus and the most
+// recently modified ones are listed and the rest are collapsed into
+// per-directory counts, followed by a note on what was left out.
+func summarizeWorkspace(files []FileInfo, focus string, budget int) string {
+	var full strings.Builder
+	for _, file := range files {
+		full.WriteString(describeFile(file))
+	}
+	if estimateTokens(full.String()) <= budget {
+		return full.String()
+	}
+
+	var candidates []FileInfo
+	for _, file := range files {
+		if !file.IsDir {
+			candidates = append(candidates, file)
+		}
+	}
+	scores := scoreFiles(candidates, focus)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		si, sj := scores[candidates[i].Path], scores[candidates[j].Path]
+		if si != sj {
+			return si > sj
+		}
+		return candidates[i].ModTime.After(candidates[j].ModTime)
+	})
+
+	// Spend most of the budget on individual files and keep the rest for the
+	// directory counts
+	fileBudget := budget * 3 / 4
+	used := 0
+	var listed, elided []FileInfo
+	for _, file := range candidates {
+		cost := estimateTokens(describeFile(file))
+		if used+cost > fileBudget {
+			elided = append(elided, file)
+			continue
+		}
+		used += cost
+		listed = append(listed, file)
+	}
+
+	sort.Slice(listed, func(i, j int) bool { return listed[i].Path < listed[j].Path })
+
+	var b strings.Builder
+	for _, file := range listed {
+		b.WriteString(describeFile(file))
+	}
+	b.WriteString(collapseDirectories(elided, budget-used))
+	b.WriteString(fmt.Sprintf("\n(Listing shortened to fit the context budget: %d of %d files shown, "+
+		"%d omitted. Use the list tool to see the files in a directory.)\n",
+		len(listed), len(candidates), len(elided)))
+	return b.String()
+}
+
+// scoreFiles ranks files by how relevant they are to focus and how recently
+// they were modified
+func scoreFiles(files []FileInfo, focus string) map[string]int {
+	focus = strings.ToLower(focus)
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(focus, func(r rune) bool {
+		return !(r == '_' || r == '-' || r == '.' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}) {
+		words[w] = true
+	}
+
+	byAge := make([]FileInfo, len(files))
+	copy(byAge, files)
+	sort.Slice(byAge, func(i, j int) bool { return byAge[i].ModTime.After(byAge[j].ModTime) })
+
+	scores := make(map[string]int)
+	for rank, file := range byAge {
+		score := 0
+		path := strings.ToLower(filepath.ToSlash(file.Path))
+		name := strings.ToLower(file.Name)
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+
+		// Conversation relevance
+		switch {
+		case focus != "" && strings.Contains(focus, path):
+			score += 100
+		case words[name]:
+			score += 60
+		case len(stem) >= 3 && words[stem]:
+			score += 30
+		}
+		for _, dir := range strings.Split(filepath.ToSlash(filepath.Dir(path)), "/") {
+			if len(dir) >= 3 && words[dir] {
+				score += 5
+			}
+		}
+
+		// Recency: newest files score up to 20, anything touched today gets more
+		score += 20 * (len(byAge) - rank) / len(byAge)
+		if time.Since(file.ModTime) < 24*time.Hour {
+			score += 10
+		}
+
+		// Top-level files such as README and main entry points
+		if !strings.Contains(path, "/") {
+			score += 3
+		}
+		scores[file.Path] = score
+	}
+	return scores
+}
+
+// collapseDirectories summarizes elided files as per-directory counts within
+// budget tokens, falling back to top-level directories when needed
+func collapseDirectories(elided []FileInfo, budget int) string {
+	lines := directoryCounts(elided, 0)
+	if estimateTokens(strings.Join(lines, "")) > budget {
+		lines = directoryCounts(elided, 1)
+	}
+
+	// Keep the largest directories that fit
+	var b strings.Builder
+	used := 0
+	for _, line := range lines {
+		cost := estimateTokens(line)
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// directoryCounts groups files by directory, or by their first depth path
+// elements when depth is positive, largest groups first
+func directoryCounts(files []FileInfo, depth int) []string {
+	type group struct {
+		dir       string
+		count     int
+		languages map[string]int
+	}
+	groups := make(map[string]*group)
+
+	for _, file := range files {
+		dir := filepath.ToSlash(filepath.Dir(file.Path))
+		if depth > 0 {
+			parts := strings.Split(dir, "/")
+			if len(parts) > depth {
+				dir = strings.Join(parts[:depth], "/")
+			}
+		}
+		g, ok := groups[dir]
+		if !ok {
+			g = &group{dir: dir, languages: make(map[string]int)}
+			groups[dir] = g
+		}
+		g.count++
+		language := file.Language
+		if language == "" {
+			language = "other"
+		}
+		g.languages[language]++
+	}
+
+	var sorted []*group
+	for _, g := range groups {
+		sorted = append(sorted, g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].dir < sorted[j].dir
+	})
+
+	var lines []string
+	for _, g := range sorted {
+		var kinds []string
+		for language, n := range g.languages {
+			kinds = append(kinds, fmt.Sprintf("%d %s", n, language))
+		}
+		sort.Strings(kinds)
+		lines = append(lines, fmt.Sprintf("\n- Directory: %s (%d files not listed: %s)\n",
+			g.dir, g.count, strings.Join(kinds, ", ")))
+	}
+	return lines
+}
+
+// listDirectory returns the index entries below dir for the list tool
+func listDirectory(dir string) (string, error) {
+	dir = filepath.Clean(dir)
+	prefix := dir + string(filepath.Separator)
+
+	const maxEntries = 200
+	var b strings.Builder
+	count, total := 0, 0
+	for _, file := range indexedFiles() {
+		if file.Path == dir || (dir != "." && !strings.HasPrefix(file.Path, prefix)) {
+			continue
+		}
+		total++
+		if count < maxEntries {
+			b.WriteString(describeFile(file))
+			count++
+		}
+	}
+
+	if total == 0 {
+		return "", fmt.Errorf("no indexed files below %s", dir)
+	}
+	if total > count {
+		b.WriteString(fmt.Sprintf("\n(%d more entries not shown; list a subdirectory to see them.)\n", total-count))
+	}
+	return fmt.Sprintf("Files below %s:\n%s", dir, b.String()), nil
+}
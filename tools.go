@@ -0,0 +1,621 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"caia-ai-cli/pkg/txn"
+)
+
+// excelActionSchema is the JSON schema for a single ExcelAction
+var excelActionSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"type": map[string]interface{}{
+			"type":        "string",
+			"enum":        excelActionTypes,
+			"description": "The Excel action to perform",
+		},
+		"sheet": map[string]interface{}{
+			"type":        "string",
+			"description": "Name of the sheet the action applies to",
+		},
+		"cell": map[string]interface{}{
+			"type":        "string",
+			"description": "Cell reference such as A1 (set_cell, set_formula; freeze_panes freezes the rows above and columns left of it; add_chart places the chart there)",
+		},
+		"value": map[string]interface{}{
+			"type":        "string",
+			"description": "Cell value (set_cell only)",
+		},
+		"row": map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string"},
+			"description": "Row values appended after the last used row (add_row only)",
+		},
+		"formula": map[string]interface{}{
+			"type":        "string",
+			"description": "Formula such as =SUM(B2:B10) written to cell (set_formula only); read_range and export_csv return its calculated value",
+		},
+		"range": map[string]interface{}{
+			"type": "string",
+			"description": "Cell range in A1 notation such as A1:D10 (set_style, set_number_format, merge_cells, add_chart, sort_range; " +
+				"read_range reads the whole sheet without one)",
+		},
+		"style": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"bold":       map[string]interface{}{"type": "boolean"},
+				"italic":     map[string]interface{}{"type": "boolean"},
+				"underline":  map[string]interface{}{"type": "boolean"},
+				"font_size":  map[string]interface{}{"type": "number"},
+				"font_color": map[string]interface{}{"type": "string", "description": "Hex RGB such as #1F4E78"},
+				"fill_color": map[string]interface{}{"type": "string", "description": "Hex RGB background color"},
+				"align":      map[string]interface{}{"type": "string", "enum": []string{"left", "center", "right"}},
+				"valign":     map[string]interface{}{"type": "string", "enum": []string{"top", "center", "bottom"}},
+				"wrap_text":  map[string]interface{}{"type": "boolean"},
+				"border":     map[string]interface{}{"type": "boolean", "description": "Thin border on every side"},
+			},
+			"description": "Formatting added to the cells in range (set_style only)",
+		},
+		"format": map[string]interface{}{
+			"type": "string",
+			"description": "Number format code such as #,##0.00 or one of integer, decimal, currency, percent, " +
+				"date, datetime, text (set_number_format only)",
+		},
+		"columns": map[string]interface{}{
+			"type": "string",
+			"description": "Column or column range such as B or A:D (set_col_width, insert_cols, delete_cols). " +
+				"Inserted columns take these positions and the columns there move right",
+		},
+		"width": map[string]interface{}{
+			"type":        "number",
+			"description": "Column width in characters (set_col_width only)",
+		},
+		"limit": map[string]interface{}{
+			"type":        "integer",
+			"description": fmt.Sprintf("Most records to return, default %d, at most %d (read_range only)", defaultReadRows, maxReadRows),
+		},
+		"offset": map[string]interface{}{
+			"type":        "integer",
+			"description": "Records to skip, for reading further pages (read_range only)",
+		},
+		"header": map[string]interface{}{
+			"type": "boolean",
+			"description": "Whether the first row of the range is a header; detected from its contents " +
+				"when omitted (read_range, sort_range)",
+		},
+		"rows": map[string]interface{}{
+			"type": "string",
+			"description": "Row or row range such as 5 or 5:9 (insert_rows, delete_rows). Inserted rows take " +
+				"these positions and the rows there move down",
+		},
+		"new_name": map[string]interface{}{
+			"type":        "string",
+			"description": "New name of the sheet (rename_sheet only)",
+		},
+		"sort_keys": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"column":     map[string]interface{}{"type": "string", "description": "Column letter inside range"},
+					"descending": map[string]interface{}{"type": "boolean"},
+				},
+				"required": []string{"column"},
+			},
+			"description": "Columns to sort range by, the first key first (sort_range only). A header row " +
+				"stays in place",
+		},
+		"file": map[string]interface{}{
+			"type": "string",
+			"description": "CSV or TSV file to import into sheet starting at cell (default A1), or to export " +
+				"sheet to as displayed (import_csv, export_csv)",
+		},
+		"chart": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"type": map[string]interface{}{
+					"type": "string",
+					"enum": []string{"line", "bar", "column", "pie", "scatter"},
+				},
+				"title":        map[string]interface{}{"type": "string"},
+				"x_axis_title": map[string]interface{}{"type": "string"},
+				"y_axis_title": map[string]interface{}{"type": "string"},
+				"data_sheet": map[string]interface{}{
+					"type":        "string",
+					"description": "Sheet holding range, if not the sheet the chart is placed on",
+				},
+			},
+			"required": []string{"type"},
+			"description": "Chart of range, whose first row holds series names and first column categories, " +
+				"with one series per further column (pie charts use the first). It is placed with its " +
+				"top-left corner at cell (add_chart only)",
+		},
+	},
+	"required": []string{"type", "sheet"},
+}
+
+// fileToolSchema builds the input schema shared by the file tools
+func fileToolSchema(withContent bool) map[string]interface{} {
+	properties := map[string]interface{}{
+		"filename": map[string]interface{}{
+			"type":        "string",
+			"description": "Path of the file relative to the workspace root",
+		},
+		"actions": map[string]interface{}{
+			"type":        "array",
+			"items":       excelActionSchema,
+			"description": "Excel actions, only used for .xlsx, .xls, .csv and .tsv files",
+		},
+	}
+	if withContent {
+		properties["content"] = map[string]interface{}{
+			"type":        "string",
+			"description": "Complete file content, only used for non-Excel files",
+		}
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   []string{"filename"},
+	}
+}
+
+// patchToolSchema is the input schema for the patch tool
+var patchToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"filename": map[string]interface{}{
+			"type":        "string",
+			"description": "Path of the file relative to the workspace root",
+		},
+		"patches": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"search": map[string]interface{}{
+						"type":        "string",
+						"description": "Existing text to find, copied from the file",
+					},
+					"replace": map[string]interface{}{
+						"type":        "string",
+						"description": "Text that replaces the search text",
+					},
+				},
+				"required": []string{"search", "replace"},
+			},
+			"description": "Search/replace blocks applied in order",
+		},
+	},
+	"required": []string{"filename", "patches"},
+}
+
+// toolDefinitions returns the tools Claude can call to work with workspace files
+func toolDefinitions() []anthropic.ToolParam {
+	return []anthropic.ToolParam{
+		{
+			Name: anthropic.F("create"),
+			Description: anthropic.F("Create a new file in the workspace. For code and text files pass the full " +
+				"content. For Excel files pass a list of actions (create_sheet, set_cell, add_row) instead; " +
+				"import_csv fills a sheet from a CSV file. CSV and TSV files take either content or actions."),
+			InputSchema: anthropic.F(interface{}(fileToolSchema(true))),
+		},
+		{
+			Name: anthropic.F("edit"),
+			Description: anthropic.F("Edit an existing file in the workspace. For code and text files pass the " +
+				"complete new content, which replaces the file; prefer patch for changes to part of a file. " +
+				"For Excel files pass a list of actions " +
+				"(create_sheet, set_cell, add_row) to apply to the workbook; export_csv writes a sheet to a " +
+				"CSV file. CSV and TSV files take either content or the row, column, cell and sort actions."),
+			InputSchema: anthropic.F(interface{}(fileToolSchema(true))),
+		},
+		{
+			Name: anthropic.F("patch"),
+			Description: anthropic.F("Change part of an existing code or text file with search/replace blocks. " +
+				"Each search text must match exactly one location in the file; include a few surrounding " +
+				"lines to make it unique. Whitespace differences in indentation are tolerated. If any block " +
+				"cannot be matched nothing is changed and the failures are reported."),
+			InputSchema: anthropic.F(interface{}(patchToolSchema)),
+		},
+		{
+			Name: anthropic.F("read"),
+			Description: anthropic.F("Read a file from the workspace. For Excel files pass read_range actions " +
+				"naming the sheet and optionally an A1 range; rows come back as JSON records, a page at a time " +
+				"(use limit and offset for more). read_sheet is the same as read_range without a range. " +
+				"CSV and TSV files can be read the same way; sheet is ignored for them."),
+			InputSchema: anthropic.F(interface{}(fileToolSchema(false))),
+		},
+		{
+			Name: anthropic.F("list"),
+			Description: anthropic.F("List the indexed files and directories below a directory, with their " +
+				"types. Use it to explore parts of the workspace left out of the shortened listing."),
+			InputSchema: anthropic.F(interface{}(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"filename": map[string]interface{}{
+						"type":        "string",
+						"description": "Directory relative to the workspace root; use . for the root",
+					},
+				},
+				"required": []string{"filename"},
+			})),
+		},
+		{
+			Name: anthropic.F("search"),
+			Description: anthropic.F("Search the contents of the indexed text files for a regular expression " +
+				"or literal text. Returns the matching lines with line numbers and surrounding context, " +
+				"so you can find code without reading whole files."),
+			InputSchema: anthropic.F(interface{}(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"pattern": map[string]interface{}{
+						"type":        "string",
+						"description": "RE2 regular expression, or plain text when literal is set",
+					},
+					"literal": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Match the pattern as plain text",
+					},
+					"ignore_case": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Match regardless of case",
+					},
+					"paths": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Only search paths matching these .gitignore-style globs, e.g. *.go or src/; prefix with ! to exclude",
+					},
+					"context": map[string]interface{}{
+						"type":        "integer",
+						"description": "Lines of context around each match (default 2)",
+					},
+				},
+				"required": []string{"pattern"},
+			})),
+		},
+		{
+			Name: anthropic.F("delete"),
+			Description: anthropic.F("Delete a file or directory from the workspace. Deleting a directory that " +
+				"is not empty requires recursive to be true."),
+			InputSchema: anthropic.F(interface{}(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"filename": map[string]interface{}{
+						"type":        "string",
+						"description": "Path of the file or directory relative to the workspace root",
+					},
+					"recursive": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Delete a directory together with everything inside it",
+					},
+				},
+				"required": []string{"filename"},
+			})),
+		},
+		{
+			Name: anthropic.F("move"),
+			Description: anthropic.F("Rename or move a file or directory. If destination is an existing " +
+				"directory the source is moved into it. Existing files are never overwritten."),
+			InputSchema: anthropic.F(interface{}(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"filename": map[string]interface{}{
+						"type":        "string",
+						"description": "Current path relative to the workspace root",
+					},
+					"destination": map[string]interface{}{
+						"type":        "string",
+						"description": "New path relative to the workspace root",
+					},
+				},
+				"required": []string{"filename", "destination"},
+			})),
+		},
+		{
+			Name:        anthropic.F("mkdir"),
+			Description: anthropic.F("Create a directory, including any missing parent directories."),
+			InputSchema: anthropic.F(interface{}(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"filename": map[string]interface{}{
+						"type":        "string",
+						"description": "Path of the directory relative to the workspace root",
+					},
+				},
+				"required": []string{"filename"},
+			})),
+		},
+	}
+}
+
+// actionFromToolUse converts a tool_use block into an Action
+func actionFromToolUse(block anthropic.ContentBlock) (Action, error) {
+	var action Action
+	if err := json.Unmarshal(block.Input, &action); err != nil {
+		return action, fmt.Errorf("invalid input for tool %s: %v", block.Name, err)
+	}
+	action.Operation = block.Name
+
+	if action.Operation == "search" {
+		if action.Pattern == "" {
+			return action, fmt.Errorf("tool %s requires a pattern", block.Name)
+		}
+		return action, nil
+	}
+	if action.Filename == "" && action.Operation != "list" {
+		return action, fmt.Errorf("tool %s requires a filename", block.Name)
+	}
+	if (action.Operation == "create" || action.Operation == "edit") &&
+		action.Content == "" && len(action.Actions) == 0 {
+		return action, fmt.Errorf("tool %s requires content or actions", block.Name)
+	}
+	if (action.Operation == "move" || action.Operation == "rename") && action.Destination == "" {
+		return action, fmt.Errorf("tool %s requires a destination", block.Name)
+	}
+	if action.Operation == "patch" && len(action.Patches) == 0 {
+		return action, fmt.Errorf("tool %s requires at least one patch block", block.Name)
+	}
+	if isCSVFile(action.Filename) {
+		if err := prepareTableActions(&action); err != nil {
+			return action, fmt.Errorf("tool %s: %v", block.Name, err)
+		}
+	}
+	if err := validateExcelActions(action.Actions); err != nil {
+		return action, fmt.Errorf("tool %s: %v", block.Name, err)
+	}
+
+	return action, nil
+}
+
+// insideWorkspace reports whether an indexed path still resolves to a
+// file inside the workspace, since it may have been replaced by a symlink
+// after indexing
+func insideWorkspace(path string) bool {
+	if workspaceSandbox == nil {
+		return true
+	}
+	_, err := workspaceSandbox.Resolve(path)
+	return err == nil
+}
+
+// sandboxAction validates the action's paths against the workspace sandbox
+// and replaces them with clean workspace-relative paths
+func sandboxAction(action *Action) error {
+	// Searches only read indexed files, which are inside the sandbox
+	if action.Operation == "search" {
+		return nil
+	}
+
+	// Listing the workspace root is allowed
+	if action.Operation == "list" && (action.Filename == "." || action.Filename == "") {
+		action.Filename = "."
+		return nil
+	}
+
+	filename, err := workspaceSandbox.Resolve(action.Filename)
+	if err != nil {
+		return err
+	}
+	action.Filename = filename
+
+	if action.Destination != "" {
+		destination, err := workspaceSandbox.Resolve(action.Destination)
+		if err != nil {
+			return err
+		}
+		action.Destination = destination
+	}
+
+	// CSV files imported into or exported from workbooks
+	for i := range action.Actions {
+		if action.Actions[i].File == "" {
+			continue
+		}
+		file, err := workspaceSandbox.Resolve(action.Actions[i].File)
+		if err != nil {
+			return err
+		}
+		action.Actions[i].File = file
+	}
+	return nil
+}
+
+// describeAction summarizes an action for progress messages
+func describeAction(action Action) string {
+	switch action.Operation {
+	case "create":
+		if isExcelFile(action.Filename) {
+			return fmt.Sprintf("create Excel file: %s with %d sheet operations", action.Filename, len(action.Actions))
+		}
+		return fmt.Sprintf("create file: %s", action.Filename)
+	case "edit":
+		return fmt.Sprintf("edit file: %s", action.Filename)
+	case "patch":
+		return fmt.Sprintf("patch file: %s with %d blocks", action.Filename, len(action.Patches))
+	case "read":
+		return fmt.Sprintf("read file: %s", action.Filename)
+	case "list":
+		return fmt.Sprintf("list directory: %s", action.Filename)
+	case "search":
+		return fmt.Sprintf("search for: %s", action.Pattern)
+	case "delete":
+		return fmt.Sprintf("delete: %s", action.Filename)
+	case "move", "rename":
+		return fmt.Sprintf("move: %s -> %s", action.Filename, action.Destination)
+	case "mkdir":
+		return fmt.Sprintf("create directory: %s", action.Filename)
+	default:
+		return fmt.Sprintf("%s: %s", action.Operation, action.Filename)
+	}
+}
+
+// dropTruncatedToolCalls removes the tool_use blocks of a response that was
+// cut off at the output limit and whose input is therefore incomplete JSON.
+// Kept in the history, they would make every later request fail. It returns
+// the names of the dropped tools.
+func dropTruncatedToolCalls(message *anthropic.Message) []string {
+	if message.StopReason != anthropic.MessageStopReasonMaxTokens {
+		return nil
+	}
+	var dropped []string
+	content := message.Content[:0]
+	for _, block := range message.Content {
+		if block.Type == anthropic.ContentBlockTypeToolUse && !json.Valid(block.Input) {
+			dropped = append(dropped, block.Name)
+			continue
+		}
+		content = append(content, block)
+	}
+	message.Content = content
+	if len(dropped) > 0 {
+		fmt.Printf("\nThe response reached the output limit; dropped the incomplete %s call.\n",
+			strings.Join(dropped, ", "))
+	}
+	return dropped
+}
+
+// executeToolCalls runs every tool_use block in the message and returns the
+// matching tool_result blocks in the same order. All changes from the
+// response form one changeset that is applied atomically after every action
+// has been reviewed; if any write fails the whole changeset is rolled back.
+func executeToolCalls(message anthropic.Message) []anthropic.ContentBlockParamUnion {
+	var blocks []anthropic.ContentBlock
+	for _, block := range message.Content {
+		if block.Type == anthropic.ContentBlockTypeToolUse {
+			blocks = append(blocks, block)
+		}
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	results := make([]anthropic.ContentBlockParamUnion, len(blocks))
+	actions := make([]Action, len(blocks))
+	var changes []int // indexes of the actions that change the workspace
+
+	for i, block := range blocks {
+		action, err := actionFromToolUse(block)
+		if err != nil {
+			fmt.Printf("\nError parsing tool call: %v\n", err)
+			results[i] = anthropic.NewToolResultBlock(block.ID, err.Error(), true)
+			continue
+		}
+		if err := sandboxAction(&action); err != nil {
+			fmt.Printf("\nRefused %s: %v\n", action.Operation, err)
+			results[i] = anthropic.NewToolResultBlock(block.ID,
+				fmt.Sprintf("Refused: %v. Only paths inside the workspace that are not protected can be used.", err), true)
+			continue
+		}
+		actions[i] = action
+		if !isReadOnly(action.Operation) {
+			changes = append(changes, i)
+		}
+	}
+
+	// Preview the whole changeset before reviewing each action
+	if len(changes) > 1 {
+		fmt.Printf("\nClaude proposes a changeset of %d operations:\n", len(changes))
+		for _, i := range changes {
+			fmt.Printf("  - %s\n", describeAction(actions[i]))
+		}
+	}
+
+	tx := txn.New()
+	var staged []int
+	outputs := make([]string, len(blocks))
+
+	for i, block := range blocks {
+		if results[i] != nil {
+			continue
+		}
+		action := &actions[i]
+		fmt.Printf("\nPreparing to %s\n", describeAction(*action))
+
+		// Handle the operation with confirmation
+		output, err := handleOperation(action, tx)
+		switch {
+		case errors.Is(err, errOperationCancelled):
+			results[i] = anthropic.NewToolResultBlock(block.ID,
+				fmt.Sprintf("The user declined the %s operation on %s.", action.Operation, action.Filename), true)
+		case err != nil:
+			fmt.Printf("Error performing operation: %v\n", err)
+			results[i] = anthropic.NewToolResultBlock(block.ID,
+				fmt.Sprintf("Error performing %s on %s: %v", action.Operation, action.Filename, err), true)
+		case isReadOnly(action.Operation):
+			results[i] = anthropic.NewToolResultBlock(block.ID, output, false)
+		default:
+			outputs[i] = output
+			staged = append(staged, i)
+		}
+	}
+
+	if len(staged) > 0 {
+		commitErr := errOperationCancelled
+		if len(staged) == 1 || confirm(fmt.Sprintf("\nApply all %d approved changes? (y/n): ", len(staged))) {
+			var descriptions []string
+			for _, i := range staged {
+				descriptions = append(descriptions, describeAction(actions[i]))
+			}
+			commitErr = commitChangeset(strings.Join(descriptions, "; "), tx)
+		}
+
+		// Reads in the changeset may have seen changes that were not applied
+		for _, action := range actions {
+			settleRead(action)
+		}
+
+		for _, i := range staged {
+			action := actions[i]
+			switch {
+			case commitErr == nil:
+				rememberWritten(action)
+				fmt.Printf("Successfully handled operation for %s\n", action.Filename)
+				results[i] = anthropic.NewToolResultBlock(blocks[i].ID, outputs[i], false)
+			case errors.Is(commitErr, errOperationCancelled):
+				results[i] = anthropic.NewToolResultBlock(blocks[i].ID,
+					fmt.Sprintf("The user declined the changeset containing %s on %s.",
+						action.Operation, action.Filename), true)
+			default:
+				results[i] = anthropic.NewToolResultBlock(blocks[i].ID,
+					fmt.Sprintf("Not applied: the changeset failed and every change in it was rolled back: %v",
+						commitErr), true)
+			}
+		}
+
+		if errors.Is(commitErr, errOperationCancelled) {
+			fmt.Println("Changeset cancelled by user.")
+		} else if commitErr != nil {
+			fmt.Printf("Error applying changeset, all changes rolled back: %v\n", commitErr)
+		}
+	}
+
+	return results
+}
+
+// commitChangeset applies tx and records it in the undo journal. A failure to
+// snapshot the files prevents the changeset from being applied; a failure to
+// record it afterwards only produces a warning.
+func commitChangeset(description string, tx *txn.Tx) error {
+	if changeJournal == nil {
+		return tx.Commit()
+	}
+
+	pending, err := changeJournal.Begin(tx.Paths())
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if err := pending.Finish(description); err != nil {
+		fmt.Printf("Warning: changes applied but not recorded for undo: %v\n", err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// seenVersions maps each file Claude has seen in full to the SHA-256 of the
+// content it saw, from a read, an @mention or its own write. An edit replaces
+// the whole file, so it is refused when the file has changed since then.
+var (
+	versionsMu   sync.Mutex
+	seenVersions = make(map[string]string)
+)
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// rememberVersion records the content of path that Claude has seen
+func rememberVersion(path string, content []byte) {
+	versionsMu.Lock()
+	defer versionsMu.Unlock()
+	seenVersions[filepath.Clean(path)] = contentHash(content)
+}
+
+// forgetVersion drops what Claude has seen of path
+func forgetVersion(path string) {
+	versionsMu.Lock()
+	defer versionsMu.Unlock()
+	delete(seenVersions, filepath.Clean(path))
+}
+
+// forgetVersions drops everything, e.g. when the conversation is cleared
+func forgetVersions() {
+	versionsMu.Lock()
+	defer versionsMu.Unlock()
+	seenVersions = make(map[string]string)
+}
+
+// checkVersion returns an error when Claude has seen path and current, its
+// content now, differs from what it saw. Files Claude has not seen pass.
+func checkVersion(path string, current []byte) error {
+	versionsMu.Lock()
+	seen, ok := seenVersions[filepath.Clean(path)]
+	versionsMu.Unlock()
+	if !ok {
+		return nil
+	}
+	if now := contentHash(current); now != seen {
+		return fmt.Errorf("%s changed after you last read it (sha256 %s, now %s); read it again and base the edit on its current content",
+			path, seen[:shortHashLen], now[:shortHashLen])
+	}
+	return nil
+}
+
+// settleRead checks a read once its changeset is settled. The version it
+// recorded stays only while the file still has the content that was read,
+// since a read can see changes the user then declined.
+func settleRead(action Action) {
+	if action.Operation != "read" || action.seen == "" {
+		return
+	}
+	if content, err := os.ReadFile(action.Filename); err == nil && contentHash(content) == action.seen {
+		rememberVersion(action.Filename, content)
+		return
+	}
+	forgetVersion(action.Filename)
+}
+
+// rememberWritten updates the versions after a changeset committed: Claude
+// knows the content of what it wrote, unless the user approved only part of
+// it, moved files keep theirs and deleted files have none
+func rememberWritten(action Action) {
+	switch action.Operation {
+	case "create", "edit", "patch":
+		if isExcelFile(action.Filename) {
+			return
+		}
+		if action.partial {
+			forgetVersion(action.Filename)
+			return
+		}
+		if content, err := os.ReadFile(action.Filename); err == nil {
+			rememberVersion(action.Filename, content)
+		}
+	case "move", "rename":
+		// action.Destination is the final path, resolved when the move was staged
+		source, target := filepath.Clean(action.Filename), filepath.Clean(action.Destination)
+		versionsMu.Lock()
+		defer versionsMu.Unlock()
+		moved := make(map[string]string)
+		for path, seen := range seenVersions {
+			if inside(path, source) {
+				moved[filepath.Join(target, strings.TrimPrefix(path, source))] = seen
+				delete(seenVersions, path)
+			}
+		}
+		for path, seen := range moved {
+			seenVersions[path] = seen
+		}
+	case "delete":
+		versionsMu.Lock()
+		defer versionsMu.Unlock()
+		for path := range seenVersions {
+			if inside(path, filepath.Clean(action.Filename)) {
+				delete(seenVersions, path)
+			}
+		}
+	}
+}
+
+// inside reports whether path is dir or a path below it
+func inside(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"caia-ai-cli/pkg/txn"
+)
+
+func TestCheckVersion(t *testing.T) {
+	t.Cleanup(forgetVersions)
+	rememberVersion("./a.go", []byte("seen"))
+
+	tests := []struct {
+		name    string
+		path    string
+		current string
+		err     string // substring of the error, if one is expected
+	}{
+		{name: "unchanged", path: "a.go", current: "seen"},
+		{name: "same path spelled differently", path: "./a.go", current: "seen"},
+		{name: "never seen", path: "b.go", current: "anything"},
+		{
+			name:    "changed since it was seen",
+			path:    "a.go",
+			current: "changed",
+			err: "a.go changed after you last read it (sha256 " + contentHash([]byte("seen"))[:shortHashLen] +
+				", now " + contentHash([]byte("changed"))[:shortHashLen] + ")",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkVersion(tt.path, []byte(tt.current))
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("checkVersion() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("checkVersion() error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSettleRead(t *testing.T) {
+	tests := []struct {
+		name     string
+		staged   string // content staged before the read, if any
+		commit   bool
+		wantSeen string // content an edit may be based on afterwards
+	}{
+		{name: "unchanged file in a committed changeset", commit: true, wantSeen: "disk"},
+		{name: "unchanged file in a declined changeset", commit: false, wantSeen: "disk"},
+		{name: "staged change that was committed", staged: "staged", commit: true, wantSeen: "staged"},
+		{name: "staged change that was declined", staged: "staged", commit: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempWorkspace(t, map[string]string{"a.go": "disk"})
+			t.Cleanup(forgetVersions)
+
+			tx := txn.New()
+			if tt.staged != "" {
+				tx.WriteFile("a.go", []byte(tt.staged), 0644)
+			}
+			action := Action{Operation: "read", Filename: "a.go"}
+			if _, err := handleOperation(&action, tx); err != nil {
+				t.Fatalf("handleOperation() error = %v", err)
+			}
+			if tt.commit {
+				if err := tx.Commit(); err != nil {
+					t.Fatalf("Commit() error = %v", err)
+				}
+			}
+			settleRead(action)
+
+			// An edit of the file as it is on disk is only refused when
+			// Claude saw other content
+			current, err := os.ReadFile("a.go")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = checkVersion("a.go", current)
+			if tt.wantSeen == "" {
+				if err != nil {
+					t.Errorf("checkVersion() error = %v, want the declined read forgotten", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("checkVersion() error = %v", err)
+			}
+			if err := checkVersion("a.go", []byte("other")); err == nil {
+				t.Errorf("checkVersion() of other content passed, want the read of %q remembered", tt.wantSeen)
+			}
+		})
+	}
+}
+
+func TestRememberWritten(t *testing.T) {
+	inTempWorkspace(t, map[string]string{"a.go": "written", "b.go": "b"})
+	t.Cleanup(forgetVersions)
+
+	rememberWritten(Action{Operation: "edit", Filename: "a.go"})
+	if err := checkVersion("a.go", []byte("written")); err != nil {
+		t.Errorf("checkVersion() after a write error = %v", err)
+	}
+
+	rememberWritten(Action{Operation: "edit", Filename: "a.go", partial: true})
+	if err := checkVersion("a.go", []byte("other")); err != nil {
+		t.Errorf("checkVersion() after a partial write error = %v, want the version forgotten", err)
+	}
+
+	rememberVersion("dir/c.go", []byte("c"))
+	rememberWritten(Action{Operation: "delete", Filename: "dir"})
+	if err := checkVersion("dir/c.go", []byte("other")); err != nil {
+		t.Errorf("checkVersion() after deleting its directory error = %v, want the version forgotten", err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"caia-ai-cli/pkg/config"
+	"caia-ai-cli/pkg/watch"
+)
+
+const (
+	// watchDebounce is how long the workspace must be quiet before reindexing
+	watchDebounce = 500 * time.Millisecond
+	// watchPollInterval is how often the polling fallback checks directories
+	watchPollInterval = 2 * time.Second
+)
+
+// watchWorkspace reindexes the workspace in the background whenever files
+// change, so edits made outside the CLI show up without /index. It returns
+// nil when watching is disabled with CAIA_WATCH=off.
+func watchWorkspace() *watch.Watcher {
+	mode := config.GetWatchMode()
+	if mode == "off" {
+		return nil
+	}
+
+	w := watch.New(watchDebounce, watchPollInterval, mode == "poll")
+	w.SetDirs(indexedDirs())
+
+	go func() {
+		for batch := range w.Events {
+			if !affectsIndex(batch) {
+				continue
+			}
+			// Errors are reported by the next /index or operation instead of
+			// interrupting the prompt
+			if err := indexWorkspace(context.Background(), false); err != nil {
+				continue
+			}
+			w.SetDirs(indexedDirs())
+		}
+	}()
+	return w
+}
+
+// affectsIndex reports whether any changed path is outside the directories
+// the index always skips, such as the CLI's own .caia directory
+func affectsIndex(paths []string) bool {
+	for _, path := range paths {
+		first := strings.SplitN(filepath.ToSlash(path), "/", 2)[0]
+		if first != ".git" && first != ".caia" {
+			return true
+		}
+	}
+	return false
+}